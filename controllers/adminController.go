@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+	"github.com/harshadixit12/service-catalog-api/resources"
+)
+
+// Environment variable holding the number of days soft deleted rows are kept for, before they can be purged
+const purgeRetentionDaysEnv = "PURGE_RETENTION_DAYS"
+
+const defaultPurgeRetentionDays = 30
+
+// Permanently removes the services and versions of the caller's organization,
+// which were soft deleted longer than the retention period ago.
+func PurgeDeleted(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	retentionDays := defaultPurgeRetentionDays
+	if configured := os.Getenv(purgeRetentionDaysEnv); configured != "" {
+		days, err := strconv.Atoi(configured)
+		if err != nil || days < 0 {
+			fmt.Printf("Invalid %s: %q\n", purgeRetentionDaysEnv, configured)
+			resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to purge deleted rows."})
+			return
+		}
+		retentionDays = days
+	}
+
+	cutoff := time.Now().UTC().AddDate(0, 0, -retentionDays)
+	result, err := repository.PurgeDeleted(orgID.(int), cutoff)
+
+	if err != nil {
+		fmt.Printf("Error purging deleted rows: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to purge deleted rows."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, result, gin.H{"RetentionDays": retentionDays, "DeletedBefore": cutoff})
+}
+
+// Reports the duplicate service and version names of the caller's organization.
+// Databases created before names were unique might contain duplicates, which must be renamed or deleted
+// before the unique indexes can be created.
+func GetDuplicateNames(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	duplicates, err := repository.FindDuplicateNames(orgID.(int))
+
+	if err != nil {
+		fmt.Printf("Error finding duplicate names: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to find duplicate names."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, duplicates, nil)
+}
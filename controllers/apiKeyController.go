@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+	"github.com/harshadixit12/service-catalog-api/resources"
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Mints a new API key for the caller's organization.
+// The key is only returned in this response - we store its hash.
+func CreateAPIKey(c *gin.Context) {
+	userID, userExists := c.Get("userID")
+	orgID, orgExists := c.Get("organizationID")
+	if !userExists || !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	var apiKeyRequestInstance resources.APIKeyRequestBody
+
+	if err := c.ShouldBindJSON(&apiKeyRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	if apiKeyRequestInstance.ExpiresAt != nil && !apiKeyRequestInstance.ExpiresAt.After(time.Now()) {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid expires_at - must be in the future."})
+		return
+	}
+
+	key, keyHash, err := repository.GenerateAPIKey()
+	if err != nil {
+		fmt.Printf("Error generating API key: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to create API key."})
+		return
+	}
+
+	apiKey := repository.APIKey{
+		Name:           apiKeyRequestInstance.Name,
+		Prefix:         key[:10],
+		KeyHash:        keyHash,
+		UserID:         userID.(int),
+		OrganizationID: orgID.(int),
+	}
+	if apiKeyRequestInstance.ExpiresAt != nil {
+		expiresAt := apiKeyRequestInstance.ExpiresAt.UTC()
+		apiKey.ExpiresAt = &expiresAt
+	}
+
+	createdAPIKey, err := repository.CreateAPIKey(&apiKey)
+
+	if err != nil {
+		fmt.Printf("Error creating API key: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to create API key."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusCreated, struct {
+		*repository.APIKey
+		Key string
+	}{createdAPIKey, key}, nil)
+}
+
+// Lists the API keys of the caller's organization
+func GetAPIKeys(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	apiKeys, err := repository.GetAPIKeys(orgID.(int))
+
+	if err != nil {
+		fmt.Printf("Error loading API keys: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load API keys."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, apiKeys, nil)
+}
+
+// Revokes an API key of the caller's organization
+func RevokeAPIKey(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	apiKeyULID, err := ulid.Parse(c.Param("keyId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The API key ID is invalid."})
+		return
+	}
+
+	revokedAPIKey, err := repository.RevokeAPIKey(orgID.(int), apiKeyULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "API key not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error revoking API key: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to revoke API key."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, revokedAPIKey, nil)
+}
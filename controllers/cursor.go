@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/harshadixit12/service-catalog-api/repository"
+)
+
+var errInvalidCursor = errors.New("cursor is invalid, or was issued for a different list")
+
+// Contents of a pagination cursor. Cursors are opaque to clients - base64 encoded JSON, signed with HMAC-SHA256
+// so they can't be forged to craft arbitrary queries.
+type cursorToken struct {
+	Scope    string        `json:"s"`           // List the cursor belongs to, for example the versions of one service
+	Sort     string        `json:"o"`           // Sort order the keyset values belong to, like -version_count,name
+	Values   []interface{} `json:"v"`           // Sort key values of the row the page starts after (or ends before)
+	Backward bool          `json:"b,omitempty"` // True for cursors to the previous page
+}
+
+var (
+	cursorSecret     []byte
+	cursorSecretOnce sync.Once
+)
+
+// Loads the key cursors are signed with, from the PAGINATION_CURSOR_SECRET environment variable.
+// Without it, a random key is used - so cursors stop working when the server restarts, or across instances.
+func getCursorSecret() []byte {
+	cursorSecretOnce.Do(func() {
+		if secret := os.Getenv("PAGINATION_CURSOR_SECRET"); secret != "" {
+			cursorSecret = []byte(secret)
+			return
+		}
+
+		fmt.Println("PAGINATION_CURSOR_SECRET is not set, signing pagination cursors with a random key.")
+		cursorSecret = make([]byte, 32)
+		if _, err := rand.Read(cursorSecret); err != nil {
+			panic(fmt.Sprintf("unable to generate cursor signing key: %v", err))
+		}
+	})
+
+	return cursorSecret
+}
+
+// Encodes and signs a cursor
+func encodeCursor(token cursorToken) string {
+	payload, _ := json.Marshal(token)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + signCursor(encoded)
+}
+
+// Verifies and decodes a cursor, and checks it belongs to the given list.
+func decodeCursor(cursor string, scope string) (*cursorToken, error) {
+	encoded, signature, found := strings.Cut(cursor, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(signCursor(encoded))) {
+		return nil, errInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	// Keep numbers as they were encoded, so integer sort values are not turned into floats
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	var token cursorToken
+	if err := decoder.Decode(&token); err != nil || token.Scope != scope {
+		return nil, errInvalidCursor
+	}
+
+	for i, value := range token.Values {
+		if number, ok := value.(json.Number); ok {
+			if integer, err := number.Int64(); err == nil {
+				token.Values[i] = integer
+			} else {
+				token.Values[i] = number.String()
+			}
+		}
+	}
+
+	return &token, nil
+}
+
+func signCursor(encoded string) string {
+	mac := hmac.New(sha256.New, getCursorSecret())
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Adds next_cursor and prev_cursor to the meta of a page, for the rows around it which exist.
+// keysetValues returns the sort key values of the row at the given index of the page.
+func addPageCursors(meta map[string]interface{}, token cursorToken, pageLength int, hasMore bool, hasPrevious bool, keysetValues func(int) []interface{}) {
+	meta["next_cursor"] = nil
+	meta["prev_cursor"] = nil
+
+	if pageLength == 0 {
+		return
+	}
+
+	hasNext := hasMore
+	if token.Backward {
+		// Paging backwards, hasMore is about the rows before the page - and we came from the rows after it,
+		// unless this is the last page
+		hasNext, hasPrevious = token.Values != nil, hasMore
+	}
+
+	if hasNext {
+		next := token
+		next.Values, next.Backward = keysetValues(pageLength-1), false
+		meta["next_cursor"] = encodeCursor(next)
+	}
+
+	if hasPrevious {
+		previous := token
+		previous.Values, previous.Backward = keysetValues(0), true
+		meta["prev_cursor"] = encodeCursor(previous)
+	}
+}
+
+// Reads the cursor query parameter of a list request. Returns nil if there is none, and errInvalidCursor
+// if the cursor is invalid, or was issued for another list or sort order than requested.
+func parseCursorParam(cursor string, scope string, sortFields []repository.SortField, sortRequested bool) (*cursorToken, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	token, err := decodeCursor(cursor, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if sortRequested && token.Sort != repository.FormatSort(sortFields) {
+		return nil, fmt.Errorf("cursor was issued for sort=%s", token.Sort)
+	}
+
+	return token, nil
+}
+
+// Keyset of the cursor, for the repository
+func (token *cursorToken) keyset() *repository.Keyset {
+	if token == nil {
+		return nil
+	}
+	return &repository.Keyset{Values: token.Values, Backward: token.Backward}
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+	"github.com/harshadixit12/service-catalog-api/resources"
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Limit on how far dependencies are listed from a service, so a single request can't walk an arbitrarily deep graph
+const maxDependencyDepth = 10
+
+// Lists the services a service depends on (direction=upstream, the default) or the services depending on it
+// (direction=downstream), transitively up to depth dependencies away
+func GetServiceDependencies(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	direction := c.DefaultQuery("direction", repository.DependencyUpstream)
+	if direction != repository.DependencyUpstream && direction != repository.DependencyDownstream {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid direction - must be one of [upstream, downstream]."})
+		return
+	}
+
+	depth, err := strconv.Atoi(c.DefaultQuery("depth", "1"))
+	if err != nil || depth < 1 || depth > maxDependencyDepth {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Invalid depth - must be between 1 and %d.", maxDependencyDepth)})
+		return
+	}
+
+	graph, err := repository.GetServiceDependencies(orgID.(int), serviceULID.String(), direction, depth)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error loading dependencies: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load dependencies."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, graph, gin.H{"Direction": direction, "Depth": depth})
+}
+
+// Lists the services which break if a service goes down - every service depending on it, directly or transitively
+func GetServiceBlastRadius(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	graph, err := repository.GetServiceBlastRadius(orgID.(int), serviceULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error loading blast radius: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load the blast radius."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, graph, gin.H{"AffectedServices": len(graph.Nodes)})
+}
+
+// Declares that a service depends on another service, optionally pinned to a version range.
+// Declaring an existing dependency again replaces its version range.
+func SetServiceDependency(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, dependencyULID, ok := parseDependencyParams(c)
+	if !ok {
+		return
+	}
+
+	var dependencyRequestInstance resources.DependencyRequestBody
+
+	// The body is optional, for dependencies on any version
+	if err := c.ShouldBindJSON(&dependencyRequestInstance); err != nil && !errors.Is(err, io.EOF) {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	if dependencyRequestInstance.VersionRange != "" && !repository.IsValidVersionRange(dependencyRequestInstance.VersionRange) {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid version_range - must be a semantic version range, like ^1.2.0 or >=1.0.0 <2.0.0."})
+		return
+	}
+
+	dependency, err := repository.SetServiceDependency(orgID.(int), serviceULID.String(), dependencyULID.String(), dependencyRequestInstance.VersionRange)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+		return
+	}
+
+	if sendIfDependencyCycle(c, err) {
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error saving dependency: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to save the dependency."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, dependency, nil)
+}
+
+// Removes the dependency of a service on another service
+func DeleteServiceDependency(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, dependencyULID, ok := parseDependencyParams(c)
+	if !ok {
+		return
+	}
+
+	err := repository.DeleteServiceDependency(orgID.(int), serviceULID.String(), dependencyULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Dependency not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error deleting dependency: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to delete the dependency."})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Parses the service ID, and the ID of the service it depends on, from the path
+func parseDependencyParams(c *gin.Context) (ulid.ULID, ulid.ULID, bool) {
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return ulid.ULID{}, ulid.ULID{}, false
+	}
+
+	dependencyULID, err := ulid.Parse(c.Param("dependencyId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The dependency ID is invalid."})
+		return ulid.ULID{}, ulid.ULID{}, false
+	}
+
+	return serviceULID, dependencyULID, true
+}
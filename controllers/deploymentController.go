@@ -0,0 +1,306 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+	"github.com/harshadixit12/service-catalog-api/resources"
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Records a deployment of a version of a service to an environment, by the caller.
+// Environments after the first one of the promotion pipeline are reached through promotions, which check their gates -
+// only admins can deploy to them directly, for example to fix an incident.
+func CreateDeployment(c *gin.Context) {
+	userID, userExists := c.Get("userID")
+	orgID, orgExists := c.Get("organizationID")
+	userRole, roleExists := c.Get("userRole")
+	if !userExists || !orgExists || !roleExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	var deploymentRequestInstance resources.DeploymentRequestBody
+
+	if err := c.ShouldBindJSON(&deploymentRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	versionULID, err := ulid.Parse(deploymentRequestInstance.VersionID)
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid version_id - must be a version ID."})
+		return
+	}
+
+	environmentULID, err := ulid.Parse(deploymentRequestInstance.EnvironmentID)
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid environment_id - must be an environment ID."})
+		return
+	}
+
+	environment, err := repository.GetEnvironmentByID(orgID.(int), environmentULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Version, environment or rolled back deployment not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error loading environment: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to record the deployment."})
+		return
+	}
+
+	if environment.PipelinePosition != nil && *environment.PipelinePosition > 1 {
+		role, err := repository.GetEffectiveRole(orgID.(int), userID.(int), userRole.(string), serviceULID.String())
+		if err != nil {
+			fmt.Printf("Error loading role: %v\n", err)
+			resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to record the deployment."})
+			return
+		}
+
+		if !repository.RoleSatisfies(role, repository.RoleAdmin) {
+			resources.SendError(c, http.StatusForbidden, gin.H{"message": fmt.Sprintf("Versions reach %s through promotions - deploying to it directly requires the %s role.", environment.Name, repository.RoleAdmin)})
+			return
+		}
+	}
+
+	status := deploymentRequestInstance.Status
+	if status == "" {
+		status = repository.DeploymentSucceeded
+	}
+
+	deployedAt := time.Now().UTC()
+	if deploymentRequestInstance.DeployedAt != nil {
+		if deploymentRequestInstance.DeployedAt.After(deployedAt) {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid deployed_at - can not be in the future."})
+			return
+		}
+		deployedAt = deploymentRequestInstance.DeployedAt.UTC()
+	}
+
+	rollbackOfID := ""
+	if deploymentRequestInstance.RollbackOf != "" {
+		rollbackOfULID, err := ulid.Parse(deploymentRequestInstance.RollbackOf)
+		if err != nil {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid rollback_of - must be a deployment ID."})
+			return
+		}
+		rollbackOfID = rollbackOfULID.String()
+	}
+
+	deployment, err := repository.CreateDeployment(&repository.Deployment{
+		OrganizationID: orgID.(int),
+		ServiceID:      serviceULID.String(),
+		VersionID:      versionULID.String(),
+		EnvironmentID:  environmentULID.String(),
+		Status:         status,
+		UserID:         userID.(int),
+		DeployedAt:     deployedAt,
+		RollbackOfID:   rollbackOfID,
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Version, environment or rolled back deployment not found."})
+		return
+	}
+
+	if sendIfDeploymentNotAllowed(c, err) {
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error creating deployment: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to record the deployment."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusCreated, deployment, nil)
+}
+
+// Lists the deployment history of a service, newest first - optionally only to one environment
+func GetServiceDeployments(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size_limit", "25"))
+	pageNumber, _ := strconv.Atoi(c.DefaultQuery("page_number", "1"))
+
+	if pageNumber < 1 {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid page_number - must be greater than 1."})
+		return
+	}
+
+	if pageSize < 1 || pageSize > 100 {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid page_size_limit - must be greater than 1 and less than 101."})
+		return
+	}
+
+	environmentID := ""
+	if environment := c.Query("environment_id"); environment != "" {
+		environmentULID, err := ulid.Parse(environment)
+		if err != nil {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid environment_id - must be an environment ID."})
+			return
+		}
+		environmentID = environmentULID.String()
+	}
+
+	if _, err := repository.GetServiceByID(orgID.(int), serviceULID.String()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+			return
+		}
+		fmt.Printf("Error loading service: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load deployments."})
+		return
+	}
+
+	deployments, err := repository.GetServiceDeployments(orgID.(int), serviceULID.String(), environmentID, pageSize, pageNumber)
+
+	if err != nil {
+		fmt.Printf("Error loading deployments: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load deployments."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, deployments, gin.H{"PageNumber": pageNumber, "PageSize": len(deployments), "PageSizeLimit": pageSize})
+}
+
+// Lists what is currently deployed of a service to each environment of the organization
+func GetServiceCurrentDeployments(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	current, err := repository.GetServiceCurrentDeployments(orgID.(int), serviceULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error loading current deployments: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load deployments."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, current, nil)
+}
+
+// Loads a single deployment of a service
+func GetDeployment(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, deploymentULID, ok := parseDeploymentParams(c)
+	if !ok {
+		return
+	}
+
+	deployment, err := repository.GetDeployment(orgID.(int), serviceULID.String(), deploymentULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Deployment not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error loading deployment: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load deployment."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, deployment, nil)
+}
+
+// Finishes an in progress deployment, as succeeded or failed
+func FinishDeployment(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, deploymentULID, ok := parseDeploymentParams(c)
+	if !ok {
+		return
+	}
+
+	var statusRequestInstance resources.DeploymentStatusRequestBody
+
+	if err := c.ShouldBindJSON(&statusRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	deployment, err := repository.FinishDeployment(orgID.(int), serviceULID.String(), deploymentULID.String(), statusRequestInstance.Status)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Deployment not found."})
+		return
+	}
+
+	if sendIfDeploymentNotAllowed(c, err) {
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error finishing deployment: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to update the deployment."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, deployment, nil)
+}
+
+// Parses the service and deployment IDs from the path
+func parseDeploymentParams(c *gin.Context) (ulid.ULID, ulid.ULID, bool) {
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return ulid.ULID{}, ulid.ULID{}, false
+	}
+
+	deploymentULID, err := ulid.Parse(c.Param("deploymentId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The deployment ID is invalid."})
+		return ulid.ULID{}, ulid.ULID{}, false
+	}
+
+	return serviceULID, deploymentULID, true
+}
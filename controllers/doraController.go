@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+	"github.com/harshadixit12/service-catalog-api/resources"
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Bounds of the window DORA metrics are computed over, in days
+const (
+	defaultDORAWindowDays = 30
+	maxDORAWindowDays     = 365
+)
+
+// Computes the DORA metrics of a service, for its deployments to an environment over the last window_days days.
+// The environment defaults to the last environment of the organization's pipeline - production.
+func GetServiceDORAMetrics(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	environment, windowStart, meta, ok := parseDORAParams(c, orgID.(int))
+	if !ok {
+		return
+	}
+
+	metrics, err := repository.GetServiceDORAMetrics(orgID.(int), serviceULID.String(), environment.ID, windowStart)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error computing DORA metrics: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to compute the metrics."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, metrics, meta)
+}
+
+// Computes the DORA metrics across all services of the caller's organization, along with the metrics of each service
+// deployed over the last window_days days
+func GetOrganizationDORAMetrics(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	environment, windowStart, meta, ok := parseDORAParams(c, orgID.(int))
+	if !ok {
+		return
+	}
+
+	metrics, err := repository.GetOrganizationDORAMetrics(orgID.(int), environment.ID, windowStart)
+
+	if err != nil {
+		fmt.Printf("Error computing DORA metrics: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to compute the metrics."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, metrics, meta)
+}
+
+// Parses the window_days and environment_id query parameters, and loads the environment the metrics are computed for.
+// Returns the start of the window, and the meta describing the window.
+func parseDORAParams(c *gin.Context, organizationID int) (*repository.Environment, time.Time, gin.H, bool) {
+	windowDays, err := strconv.Atoi(c.DefaultQuery("window_days", strconv.Itoa(defaultDORAWindowDays)))
+	if err != nil || windowDays < 1 || windowDays > maxDORAWindowDays {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Invalid window_days - must be between 1 and %d.", maxDORAWindowDays)})
+		return nil, time.Time{}, nil, false
+	}
+
+	var environment *repository.Environment
+	if environmentParam := c.Query("environment_id"); environmentParam != "" {
+		environmentULID, err := ulid.Parse(environmentParam)
+		if err != nil {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid environment_id - must be an environment ID."})
+			return nil, time.Time{}, nil, false
+		}
+
+		environment, err = repository.GetEnvironmentByID(organizationID, environmentULID.String())
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			resources.SendError(c, http.StatusNotFound, gin.H{"message": "Environment not found."})
+			return nil, time.Time{}, nil, false
+		}
+	} else {
+		environment, err = repository.GetProductionEnvironment(organizationID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid environment_id - required, as the organization has no promotion pipeline."})
+			return nil, time.Time{}, nil, false
+		}
+	}
+
+	if err != nil {
+		fmt.Printf("Error loading environment: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to compute the metrics."})
+		return nil, time.Time{}, nil, false
+	}
+
+	windowEnd := time.Now().UTC()
+	windowStart := windowEnd.AddDate(0, 0, -windowDays)
+
+	meta := gin.H{
+		"EnvironmentID":   environment.ID,
+		"EnvironmentName": environment.Name,
+		"WindowDays":      windowDays,
+		"WindowStart":     windowStart,
+		"WindowEnd":       windowEnd,
+	}
+
+	return environment, windowStart, meta, true
+}
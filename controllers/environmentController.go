@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+	"github.com/harshadixit12/service-catalog-api/resources"
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Lists the environments of the caller's organization
+func GetEnvironments(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	environments, err := repository.GetEnvironments(orgID.(int))
+
+	if err != nil {
+		fmt.Printf("Error loading environments: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load environments."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, environments, nil)
+}
+
+// Creates an environment in the caller's organization
+func CreateEnvironment(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	var environmentRequestInstance resources.EnvironmentRequestBody
+
+	if err := c.ShouldBindJSON(&environmentRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	if !repository.IsValidEnvironmentName(environmentRequestInstance.Name) {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid name - must be lowercase letters, digits and \"-\", starting and ending with a letter or digit."})
+		return
+	}
+
+	environment, err := repository.CreateEnvironment(&repository.Environment{
+		OrganizationID: orgID.(int),
+		Name:           environmentRequestInstance.Name,
+		Description:    environmentRequestInstance.Description,
+	})
+
+	if sendIfDuplicateName(c, err) {
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error creating environment: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to create environment."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusCreated, environment, nil)
+}
+
+// Loads a single environment of the caller's organization
+func GetEnvironment(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	environmentULID, ok := parseEnvironmentParam(c)
+	if !ok {
+		return
+	}
+
+	environment, err := repository.GetEnvironmentByID(orgID.(int), environmentULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Environment not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error loading environment: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load environment."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, environment, nil)
+}
+
+// Lists what is currently deployed to an environment - the latest successfully deployed version of each service
+func GetEnvironmentDeployments(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	environmentULID, ok := parseEnvironmentParam(c)
+	if !ok {
+		return
+	}
+
+	if _, err := repository.GetEnvironmentByID(orgID.(int), environmentULID.String()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			resources.SendError(c, http.StatusNotFound, gin.H{"message": "Environment not found."})
+			return
+		}
+		fmt.Printf("Error loading environment: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load deployments."})
+		return
+	}
+
+	deployments, err := repository.GetEnvironmentCurrentDeployments(orgID.(int), environmentULID.String())
+
+	if err != nil {
+		fmt.Printf("Error loading deployments: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load deployments."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, deployments, nil)
+}
+
+// Sets the promotion pipeline of the caller's organization - the environments versions are promoted through, in order
+func SetEnvironmentPipeline(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	var pipelineRequestInstance resources.EnvironmentPipelineRequestBody
+
+	if err := c.ShouldBindJSON(&pipelineRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	environmentIDs := make([]string, len(pipelineRequestInstance.EnvironmentIDs))
+	seen := map[string]bool{}
+	for i, environmentID := range pipelineRequestInstance.EnvironmentIDs {
+		environmentULID, err := ulid.Parse(environmentID)
+		if err != nil {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid environment_ids - must be environment IDs."})
+			return
+		}
+		if seen[environmentULID.String()] {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid environment_ids - an environment can only be in the pipeline once."})
+			return
+		}
+		seen[environmentULID.String()] = true
+		environmentIDs[i] = environmentULID.String()
+	}
+
+	environments, err := repository.SetEnvironmentPipeline(orgID.(int), environmentIDs)
+
+	if errors.Is(err, repository.ErrDuplicatePipelineEnvironment) {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid environment_ids - an environment can only be in the pipeline once."})
+		return
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Environment not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error setting environment pipeline: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to set the pipeline."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, environments, nil)
+}
+
+// Sets the gates a version must pass before it is promoted to an environment
+func SetEnvironmentGates(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	environmentULID, ok := parseEnvironmentParam(c)
+	if !ok {
+		return
+	}
+
+	var gatesRequestInstance resources.EnvironmentGatesRequestBody
+
+	if err := c.ShouldBindJSON(&gatesRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	environment, err := repository.SetEnvironmentGates(orgID.(int), environmentULID.String(), *gatesRequestInstance.MinSoakMinutes, *gatesRequestInstance.RequiredApprovals)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Environment not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error setting environment gates: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to set the gates."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, environment, nil)
+}
+
+// Parses the environment ID from the path
+func parseEnvironmentParam(c *gin.Context) (ulid.ULID, bool) {
+	environmentULID, err := ulid.Parse(c.Param("environmentId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The environment ID is invalid."})
+		return ulid.ULID{}, false
+	}
+	return environmentULID, true
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+	"github.com/harshadixit12/service-catalog-api/resources"
+)
+
+// Sends a 409 Conflict response if err is a repository.DuplicateNameError, and reports whether it did.
+func sendIfDuplicateName(c *gin.Context, err error) bool {
+	var duplicateErr *repository.DuplicateNameError
+	if !errors.As(err, &duplicateErr) {
+		return false
+	}
+
+	body := gin.H{"message": duplicateErr.Error() + ".", "field": "name", "value": duplicateErr.Name}
+	if duplicateErr.ExistingID != "" {
+		body["existing_id"] = duplicateErr.ExistingID
+	}
+
+	resources.SendError(c, http.StatusConflict, body)
+	return true
+}
+
+// Sends an error response with the given status if err is a repository.InvalidVersionNameError, and reports whether it did.
+// Invalid names in a request are a 400, while existing versions blocking a change (like moving a service to semver mode) are a 409.
+func sendIfInvalidVersionName(c *gin.Context, err error, status int) bool {
+	var invalidNameErr *repository.InvalidVersionNameError
+	if !errors.As(err, &invalidNameErr) {
+		return false
+	}
+
+	resources.SendError(c, status, gin.H{"message": invalidNameErr.Error() + ".", "invalid_names": invalidNameErr.Names})
+	return true
+}
+
+// Sends an error response if err is a repository.InvalidTransitionError (409) or repository.InvalidLifecycleDatesError (400), and reports whether it did.
+func sendIfInvalidTransition(c *gin.Context, err error) bool {
+	var transitionErr *repository.InvalidTransitionError
+	if errors.As(err, &transitionErr) {
+		resources.SendError(c, http.StatusConflict, gin.H{"message": transitionErr.Error() + ".", "current_state": transitionErr.From, "allowed_states": transitionErr.Allowed})
+		return true
+	}
+
+	var datesErr *repository.InvalidLifecycleDatesError
+	if errors.As(err, &datesErr) {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": datesErr.Error() + "."})
+		return true
+	}
+
+	return false
+}
+
+// Sends a 422 Unprocessable Entity response if err is a repository.MetadataValidationError, and reports whether it did.
+// The response lists every failing value, with a JSON pointer to it in the request body.
+func sendIfInvalidMetadata(c *gin.Context, err error) bool {
+	var metadataErr *repository.MetadataValidationError
+	if !errors.As(err, &metadataErr) {
+		return false
+	}
+
+	errs := make([]gin.H, len(metadataErr.Errors))
+	for i, metadataError := range metadataErr.Errors {
+		errs[i] = gin.H{"path": metadataError.Path, "message": metadataError.Message}
+	}
+
+	resources.SendError(c, http.StatusUnprocessableEntity, gin.H{"message": metadataErr.Error() + ".", "errors": errs})
+	return true
+}
+
+// Sends a 409 Conflict response if err is a repository.DependencyCycleError, and reports whether it did
+func sendIfDependencyCycle(c *gin.Context, err error) bool {
+	var cycleErr *repository.DependencyCycleError
+	if !errors.As(err, &cycleErr) {
+		return false
+	}
+
+	resources.SendError(c, http.StatusConflict, gin.H{"message": cycleErr.Error() + ".", "cycle": cycleErr.Path})
+	return true
+}
+
+// Sends a 409 Conflict response if err is a repository.DeploymentNotAllowedError, and reports whether it did
+func sendIfDeploymentNotAllowed(c *gin.Context, err error) bool {
+	var notAllowedErr *repository.DeploymentNotAllowedError
+	if !errors.As(err, &notAllowedErr) {
+		return false
+	}
+
+	resources.SendError(c, http.StatusConflict, gin.H{"message": notAllowedErr.Error() + "."})
+	return true
+}
+
+// Sends a 409 Conflict response listing the failed gates if err is a repository.PromotionRejectedError, and reports whether it did.
+func sendIfPromotionRejected(c *gin.Context, err error) bool {
+	var rejectedErr *repository.PromotionRejectedError
+	if !errors.As(err, &rejectedErr) {
+		return false
+	}
+
+	resources.SendError(c, http.StatusConflict, gin.H{"message": "The promotion was rejected.", "reasons": rejectedErr.Reasons, "promotion_id": rejectedErr.PromotionID})
+	return true
+}
@@ -0,0 +1,404 @@
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harshadixit12/service-catalog-api/repository"
+)
+
+// Types of values a filter field can hold
+const (
+	filterTypeString = "string"
+	filterTypeInt    = "int"
+	filterTypeTime   = "time"
+	filterTypeJSON   = "json" // A JSON object, filtered on one of its top-level keys with field.key
+)
+
+// Limits on filter expressions, so a single request can't build an arbitrarily large query
+const (
+	maxFilterLength     = 2048
+	maxFilterConditions = 20
+	maxFilterDepth      = 5
+	maxFilterKeyLength  = 128
+)
+
+// Operators, longest first so that ">=" is not read as ">"
+var filterOperators = []string{
+	repository.FilterIn,
+	repository.FilterNotIn,
+	repository.FilterNotEqual,
+	repository.FilterGreaterOrEqual,
+	repository.FilterLessOrEqual,
+	repository.FilterNotLike,
+	repository.FilterEqual,
+	repository.FilterGreater,
+	repository.FilterLess,
+	repository.FilterLike,
+}
+
+// Parses a filter expression, for example name~pay*,version_count>=3|created_at>2025-01-01
+//
+//	expression := and ( "|" and )*          - any of the groups must match
+//	and        := term ( "," term )*        - all of the terms must match
+//	term       := "(" expression ")" | field [ "." key ] operator value
+//	value      := "(" item ( "," item )* ")" for =in= and =out=, item otherwise
+//	item       := "quoted \"string\"" | characters other than , | ( ) "
+//
+// Only the given fields are allowed, and values are converted to the type of their field.
+// Strings can be compared with ~ and !~, where * in the value matches any characters.
+// JSON fields are filtered on a top-level key, like metadata.tier=1 - quoted values are compared as strings,
+// and bare values as numbers or booleans when they look like one.
+func parseFilter(input string, fields map[string]string) (*repository.FilterExpression, error) {
+	if len(input) > maxFilterLength {
+		return nil, fmt.Errorf("- too long, must be at most %d characters", maxFilterLength)
+	}
+
+	parser := filterParser{input: input, fields: fields}
+
+	expression, err := parser.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if parser.pos < len(parser.input) {
+		return nil, parser.errorf("unexpected %q", parser.input[parser.pos])
+	}
+
+	return expression, nil
+}
+
+type filterParser struct {
+	input      string
+	pos        int
+	fields     map[string]string
+	conditions int
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at position %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *filterParser) peek() byte {
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *filterParser) parseExpression(depth int) (*repository.FilterExpression, error) {
+	var groups []repository.FilterExpression
+
+	for {
+		group, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *group)
+
+		if p.peek() != '|' {
+			break
+		}
+		p.pos++
+	}
+
+	if len(groups) == 1 {
+		return &groups[0], nil
+	}
+	return &repository.FilterExpression{Or: groups}, nil
+}
+
+func (p *filterParser) parseAnd(depth int) (*repository.FilterExpression, error) {
+	var terms []repository.FilterExpression
+
+	for {
+		term, err := p.parseTerm(depth)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, *term)
+
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+
+	if len(terms) == 1 {
+		return &terms[0], nil
+	}
+	return &repository.FilterExpression{And: terms}, nil
+}
+
+func (p *filterParser) parseTerm(depth int) (*repository.FilterExpression, error) {
+	if p.peek() == '(' {
+		if depth >= maxFilterDepth {
+			return nil, p.errorf("too many nested groups - at most %d are allowed", maxFilterDepth)
+		}
+		p.pos++
+
+		expression, err := p.parseExpression(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek() != ')' {
+			return nil, p.errorf("expected \")\" to close the group")
+		}
+		p.pos++
+		return expression, nil
+	}
+
+	return p.parseCondition()
+}
+
+func (p *filterParser) parseCondition() (*repository.FilterExpression, error) {
+	p.conditions++
+	if p.conditions > maxFilterConditions {
+		return nil, p.errorf("too many conditions - at most %d are allowed", maxFilterConditions)
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && (isLowerLetter(p.input[p.pos]) || p.input[p.pos] == '_') {
+		p.pos++
+	}
+	field := p.input[start:p.pos]
+
+	if field == "" {
+		p.pos = start
+		if p.pos >= len(p.input) {
+			return nil, p.errorf("expected a field name, but the filter ended")
+		}
+		return nil, p.errorf("expected a field name, found %q", p.input[p.pos])
+	}
+
+	fieldType, ok := p.fields[field]
+	if !ok {
+		p.pos = start
+		return nil, p.errorf("unknown field %q - must be one of [%s]", field, strings.Join(filterFieldNames(p.fields), ", "))
+	}
+
+	key := ""
+	if fieldType == filterTypeJSON {
+		var err error
+		if key, err = p.parseKey(field); err != nil {
+			return nil, err
+		}
+	}
+
+	operator := ""
+	for _, candidate := range filterOperators {
+		if strings.HasPrefix(p.input[p.pos:], candidate) {
+			operator = candidate
+			break
+		}
+	}
+	if operator == "" {
+		name := field
+		if key != "" {
+			name += "." + key
+		}
+		return nil, p.errorf("expected an operator after %q - one of [%s]", name, strings.Join(filterOperators, " "))
+	}
+
+	if (operator == repository.FilterLike || operator == repository.FilterNotLike) && fieldType != filterTypeString && fieldType != filterTypeJSON {
+		return nil, p.errorf("operator %q is only supported for text fields", operator)
+	}
+	if (operator == repository.FilterIn || operator == repository.FilterNotIn) && fieldType == filterTypeTime {
+		return nil, p.errorf("operator %q is not supported for %q", operator, field)
+	}
+	p.pos += len(operator)
+
+	var values []interface{}
+	if operator == repository.FilterIn || operator == repository.FilterNotIn {
+		if p.peek() != '(' {
+			return nil, p.errorf("expected \"(\" to start the list of values for %q", operator)
+		}
+		p.pos++
+
+		for {
+			value, err := p.parseTypedValue(field, fieldType)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+		}
+
+		if p.peek() != ')' {
+			return nil, p.errorf("expected \",\" or \")\" in the list of values")
+		}
+		p.pos++
+	} else {
+		value, err := p.parseTypedValue(field, fieldType)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return &repository.FilterExpression{Column: field, Key: key, Operator: operator, Values: values}, nil
+}
+
+// Reads the "." and the top-level key after a JSON field
+func (p *filterParser) parseKey(field string) (string, error) {
+	if p.peek() != '.' {
+		return "", p.errorf("expected \".\" and a key after %q, for example %s.tier", field, field)
+	}
+	p.pos++
+
+	start := p.pos
+	for p.pos < len(p.input) && isFilterKeyChar(p.input[p.pos]) {
+		p.pos++
+	}
+	key := p.input[start:p.pos]
+
+	if key == "" {
+		return "", p.errorf("expected a key after \"%s.\" - keys are made of letters, digits, \"_\" and \"-\"", field)
+	}
+	if len(key) > maxFilterKeyLength {
+		p.pos = start
+		return "", p.errorf("key %q is too long, must be at most %d characters", key, maxFilterKeyLength)
+	}
+
+	return key, nil
+}
+
+// Reads a value, and converts it to the type of its field
+func (p *filterParser) parseTypedValue(field string, fieldType string) (interface{}, error) {
+	start := p.pos
+	quoted := p.peek() == '"'
+
+	raw, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	if fieldType == filterTypeJSON {
+		return convertJSONFilterValue(raw, quoted), nil
+	}
+
+	value, err := convertFilterValue(raw, fieldType)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid value %q for %q - %v", raw, field, err)
+	}
+
+	return value, nil
+}
+
+// Reads a quoted or bare value
+func (p *filterParser) parseValue() (string, error) {
+	if p.peek() == '"' {
+		p.pos++
+
+		var value strings.Builder
+		for p.pos < len(p.input) {
+			char := p.input[p.pos]
+			switch {
+			case char == '\\' && p.pos+1 < len(p.input):
+				value.WriteByte(p.input[p.pos+1])
+				p.pos += 2
+			case char == '"':
+				p.pos++
+				return value.String(), nil
+			default:
+				value.WriteByte(char)
+				p.pos++
+			}
+		}
+
+		return "", p.errorf("unterminated quoted value")
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && !strings.ContainsRune(`,|()"`, rune(p.input[p.pos])) {
+		p.pos++
+	}
+
+	if p.pos == start {
+		return "", p.errorf("expected a value - use \"\" for an empty value")
+	}
+
+	return p.input[start:p.pos], nil
+}
+
+// Converts a raw value to the type of its field
+func convertFilterValue(raw string, fieldType string) (interface{}, error) {
+	switch fieldType {
+	case filterTypeInt:
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		return value, nil
+	case filterTypeTime:
+		if value, err := time.Parse(time.RFC3339, raw); err == nil {
+			return value.UTC(), nil
+		}
+		if value, err := time.Parse(time.DateOnly, raw); err == nil {
+			return value, nil
+		}
+		return nil, fmt.Errorf("must be a date (2006-01-02) or an RFC 3339 timestamp (2006-01-02T15:04:05Z)")
+	}
+	return raw, nil
+}
+
+// Converts a raw value for a JSON field. Bare numbers and booleans are compared as such, everything else as a string.
+// Booleans become 1 and 0, which is how SQLite extracts them from JSON.
+func convertJSONFilterValue(raw string, quoted bool) interface{} {
+	if quoted {
+		return raw
+	}
+
+	switch raw {
+	case "true":
+		return 1
+	case "false":
+		return 0
+	}
+
+	if value, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return value
+	}
+	if value, err := strconv.ParseFloat(raw, 64); err == nil {
+		return value
+	}
+
+	return raw
+}
+
+func isLowerLetter(char byte) bool {
+	return char >= 'a' && char <= 'z'
+}
+
+func isFilterKeyChar(char byte) bool {
+	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || char == '_' || char == '-'
+}
+
+// Names of the fields, sorted, with the key placeholder for JSON fields
+func filterFieldNames(fields map[string]string) []string {
+	names := sortedKeys(fields)
+	for i, name := range names {
+		if fields[name] == filterTypeJSON {
+			names[i] = name + ".<key>"
+		}
+	}
+	return names
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
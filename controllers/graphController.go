@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+	"github.com/harshadixit12/service-catalog-api/resources"
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Exports the dependency graph of the caller's organization as JSON Graph Format (format=json, the default),
+// Graphviz DOT (format=dot) or a Mermaid flowchart (format=mermaid).
+// The graph can be scoped to the services around a root service, and to the services matching a label selector.
+func GetGraph(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	format := c.DefaultQuery("format", graphFormatJSON)
+	contentType, ok := graphContentTypes[format]
+	if !ok {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid format - must be one of [json, dot, mermaid]."})
+		return
+	}
+
+	scope := repository.GraphScope{Direction: repository.DependencyBoth, Depth: maxDependencyDepth}
+
+	if root := c.Query("root"); root != "" {
+		rootULID, err := ulid.Parse(root)
+		if err != nil {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid root - must be a service ID."})
+			return
+		}
+		scope.RootID = rootULID.String()
+	}
+
+	_, directionRequested := c.GetQuery("direction")
+	_, depthRequested := c.GetQuery("depth")
+	if scope.RootID == "" && (directionRequested || depthRequested) {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid direction and depth - they can only be used along with root."})
+		return
+	}
+
+	scope.Direction = c.DefaultQuery("direction", repository.DependencyBoth)
+	if scope.Direction != repository.DependencyUpstream && scope.Direction != repository.DependencyDownstream && scope.Direction != repository.DependencyBoth {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid direction - must be one of [upstream, downstream, both]."})
+		return
+	}
+
+	if depthRequested {
+		depth, err := strconv.Atoi(c.Query("depth"))
+		if err != nil || depth < 1 || depth > maxDependencyDepth {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Invalid depth - must be between 1 and %d.", maxDependencyDepth)})
+			return
+		}
+		scope.Depth = depth
+	}
+
+	if labelsParam := c.Query("labels"); labelsParam != "" {
+		labels, err := parseLabelSelector(labelsParam)
+		if err != nil {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid labels " + err.Error() + "."})
+			return
+		}
+		scope.Labels = labels
+	}
+
+	graph, err := repository.GetServiceGraph(orgID.(int), scope)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error loading dependency graph: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load the dependency graph."})
+		return
+	}
+
+	switch format {
+	case graphFormatDOT:
+		c.Data(http.StatusOK, contentType, []byte(renderDOTGraph(graph)))
+	case graphFormatMermaid:
+		c.Data(http.StatusOK, contentType, []byte(renderMermaidGraph(graph)))
+	default:
+		// The document is sent as is, without the standard response envelope, so graph tools can read it directly
+		c.JSON(http.StatusOK, renderJSONGraph(graph))
+	}
+}
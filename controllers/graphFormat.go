@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/harshadixit12/service-catalog-api/repository"
+)
+
+// Formats the dependency graph can be exported in
+const (
+	graphFormatJSON    = "json"    // JSON Graph Format - https://jsongraphformat.info
+	graphFormatDOT     = "dot"     // Graphviz DOT language
+	graphFormatMermaid = "mermaid" // Mermaid flowchart
+)
+
+// Content types of the graph formats. Mermaid has no registered media type, so it is sent as plain text.
+var graphContentTypes = map[string]string{
+	graphFormatJSON:    "application/json; charset=utf-8",
+	graphFormatDOT:     "text/vnd.graphviz; charset=utf-8",
+	graphFormatMermaid: "text/plain; charset=utf-8",
+}
+
+// Document in the JSON Graph Format, version 2
+type jsonGraphDocument struct {
+	Graph jsonGraph `json:"graph"`
+}
+
+type jsonGraph struct {
+	Directed bool                     `json:"directed"`
+	Type     string                   `json:"type"`
+	Nodes    map[string]jsonGraphNode `json:"nodes"`
+	Edges    []jsonGraphEdge          `json:"edges"`
+}
+
+type jsonGraphNode struct {
+	Label    string                 `json:"label"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+type jsonGraphEdge struct {
+	Source   string                 `json:"source"`
+	Target   string                 `json:"target"`
+	Relation string                 `json:"relation"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// Converts the graph to the JSON Graph Format. Nodes are keyed by the ULIDs of the services, and labelled with their names.
+func renderJSONGraph(graph *repository.ServiceGraph) jsonGraphDocument {
+	document := jsonGraphDocument{Graph: jsonGraph{
+		Directed: true,
+		Type:     "service-dependencies",
+		Nodes:    make(map[string]jsonGraphNode, len(graph.Nodes)),
+		Edges:    make([]jsonGraphEdge, len(graph.Edges)),
+	}}
+
+	for _, node := range graph.Nodes {
+		document.Graph.Nodes[node.ID] = jsonGraphNode{Label: node.Name, Metadata: map[string]interface{}{
+			"deprecated":          len(node.DeprecatedVersions) > 0,
+			"deprecated_versions": node.DeprecatedVersions,
+		}}
+	}
+
+	for i, edge := range graph.Edges {
+		document.Graph.Edges[i] = jsonGraphEdge{Source: edge.ServiceID, Target: edge.DependsOnServiceID, Relation: "depends_on", Metadata: map[string]interface{}{
+			"version_range": edge.VersionRange,
+		}}
+	}
+
+	return document
+}
+
+// Renders the graph in the Graphviz DOT language. Services with deprecated versions are drawn dashed, listing those versions.
+func renderDOTGraph(graph *repository.ServiceGraph) string {
+	var out strings.Builder
+
+	out.WriteString("digraph services {\n")
+	out.WriteString("  rankdir=LR;\n")
+	out.WriteString("  node [shape=box];\n")
+
+	for _, node := range graph.Nodes {
+		if len(node.DeprecatedVersions) == 0 {
+			fmt.Fprintf(&out, "  %s [label=%s];\n", dotQuote(node.ID), dotQuote(node.Name))
+			continue
+		}
+		label := node.Name + "\ndeprecated: " + strings.Join(node.DeprecatedVersions, ", ")
+		fmt.Fprintf(&out, "  %s [label=%s, style=dashed, color=orange];\n", dotQuote(node.ID), dotQuote(label))
+	}
+
+	for _, edge := range graph.Edges {
+		if edge.VersionRange == "" {
+			fmt.Fprintf(&out, "  %s -> %s;\n", dotQuote(edge.ServiceID), dotQuote(edge.DependsOnServiceID))
+			continue
+		}
+		fmt.Fprintf(&out, "  %s -> %s [label=%s];\n", dotQuote(edge.ServiceID), dotQuote(edge.DependsOnServiceID), dotQuote(edge.VersionRange))
+	}
+
+	out.WriteString("}\n")
+	return out.String()
+}
+
+// Renders the graph as a Mermaid flowchart. Services with deprecated versions get the deprecated class, listing those versions.
+func renderMermaidGraph(graph *repository.ServiceGraph) string {
+	var out strings.Builder
+
+	out.WriteString("flowchart LR\n")
+
+	var deprecated []string
+	for _, node := range graph.Nodes {
+		label := mermaidEscape(node.Name)
+		if len(node.DeprecatedVersions) > 0 {
+			label += "<br/>deprecated: " + mermaidEscape(strings.Join(node.DeprecatedVersions, ", "))
+			deprecated = append(deprecated, node.ID)
+		}
+		fmt.Fprintf(&out, "  %s[\"%s\"]\n", node.ID, label)
+	}
+
+	for _, edge := range graph.Edges {
+		if edge.VersionRange == "" {
+			fmt.Fprintf(&out, "  %s --> %s\n", edge.ServiceID, edge.DependsOnServiceID)
+			continue
+		}
+		fmt.Fprintf(&out, "  %s -->|\"%s\"| %s\n", edge.ServiceID, mermaidEscape(edge.VersionRange), edge.DependsOnServiceID)
+	}
+
+	if len(deprecated) > 0 {
+		out.WriteString("  classDef deprecated stroke:#f80,stroke-dasharray:5 5\n")
+		fmt.Fprintf(&out, "  class %s deprecated\n", strings.Join(deprecated, ","))
+	}
+
+	return out.String()
+}
+
+// Quotes a string as a DOT identifier
+func dotQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+// Escapes the characters which end or break a quoted Mermaid label, using Mermaid's entity codes
+func mermaidEscape(value string) string {
+	return strings.NewReplacer(`"`, "#quot;", "\n", " ", "<", "#lt;", ">", "#gt;").Replace(value)
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+	"github.com/harshadixit12/service-catalog-api/resources"
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Lists the labels of a service
+func GetServiceLabels(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	if _, err := repository.GetServiceByID(orgID.(int), serviceULID.String()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+			return
+		}
+		fmt.Printf("Error loading service: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load labels."})
+		return
+	}
+
+	labels, err := repository.GetServiceLabels(orgID.(int), serviceULID.String())
+
+	if err != nil {
+		fmt.Printf("Error loading labels: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load labels."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, labels, nil)
+}
+
+// Creates or replaces a label of a service, for example PUT /services/:serviceId/labels/tier with {"value": "1"}
+func SetServiceLabel(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	// Keys can have a prefix with a slash, like example.com/tier, so the route matches the rest of the path
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if !repository.IsValidLabelKey(key) {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid label key - must be up to 63 letters, digits, \"-\", \"_\" and \".\", starting and ending with a letter or digit, with an optional DNS subdomain prefix like example.com/."})
+		return
+	}
+
+	var labelRequestInstance resources.LabelRequestBody
+
+	if err := c.ShouldBindJSON(&labelRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	if !repository.IsValidLabelValue(labelRequestInstance.Value) {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid label value - must be empty, or up to 63 letters, digits, \"-\", \"_\" and \".\", starting and ending with a letter or digit."})
+		return
+	}
+
+	label, err := repository.SetServiceLabel(orgID.(int), serviceULID.String(), key, labelRequestInstance.Value)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error setting label: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to set label."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, label, nil)
+}
+
+// Removes a label from a service
+func DeleteServiceLabel(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	err = repository.DeleteServiceLabel(orgID.(int), serviceULID.String(), strings.TrimPrefix(c.Param("key"), "/"))
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service or label not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error removing label: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to remove label."})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/harshadixit12/service-catalog-api/repository"
+)
+
+// Limits on label selectors, so a single request can't join the labels table an arbitrary number of times
+const (
+	maxLabelSelectorLength       = 2048
+	maxLabelSelectorRequirements = 20
+)
+
+// Parses a Kubernetes style label selector, for example tier in (1,2),env!=dev,!legacy
+//
+//	selector    := requirement ( "," requirement )*   - all of the requirements must match
+//	requirement := "!" key                            - the label is not set
+//	             | key                                - the label is set, to any value
+//	             | key ( "=" | "==" | "!=" ) value
+//	             | key ( "in" | "notin" ) "(" value ( "," value )* ")"
+//
+// Spaces are allowed around keys, values and operators. != and notin also match services without the label.
+func parseLabelSelector(input string) ([]repository.LabelRequirement, error) {
+	if len(input) > maxLabelSelectorLength {
+		return nil, fmt.Errorf("- too long, must be at most %d characters", maxLabelSelectorLength)
+	}
+
+	parser := labelSelectorParser{input: input}
+
+	var requirements []repository.LabelRequirement
+	for {
+		if len(requirements) == maxLabelSelectorRequirements {
+			return nil, parser.errorf("too many requirements - at most %d are allowed", maxLabelSelectorRequirements)
+		}
+
+		requirement, err := parser.parseRequirement()
+		if err != nil {
+			return nil, err
+		}
+		requirements = append(requirements, *requirement)
+
+		parser.skipSpaces()
+		if parser.peek() != ',' {
+			break
+		}
+		parser.pos++
+	}
+
+	if parser.pos < len(parser.input) {
+		return nil, parser.errorf("unexpected %q", parser.input[parser.pos])
+	}
+
+	return requirements, nil
+}
+
+type labelSelectorParser struct {
+	input string
+	pos   int
+}
+
+func (p *labelSelectorParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at position %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *labelSelectorParser) peek() byte {
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *labelSelectorParser) skipSpaces() {
+	for p.peek() == ' ' {
+		p.pos++
+	}
+}
+
+// Reads a run of the characters keys and values are made of
+func (p *labelSelectorParser) parseWord() string {
+	start := p.pos
+	for p.pos < len(p.input) && isLabelChar(p.input[p.pos]) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *labelSelectorParser) parseRequirement() (*repository.LabelRequirement, error) {
+	p.skipSpaces()
+
+	if p.peek() == '!' {
+		p.pos++
+		p.skipSpaces()
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		return &repository.LabelRequirement{Key: key, Operator: repository.LabelDoesNotExist}, nil
+	}
+
+	key, err := p.parseKey()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+
+	operator := ""
+	switch {
+	case p.peek() == 0 || p.peek() == ',':
+		return &repository.LabelRequirement{Key: key, Operator: repository.LabelExists}, nil
+	case strings.HasPrefix(p.input[p.pos:], "=="):
+		operator, p.pos = repository.LabelEquals, p.pos+2
+	case strings.HasPrefix(p.input[p.pos:], "="):
+		operator, p.pos = repository.LabelEquals, p.pos+1
+	case strings.HasPrefix(p.input[p.pos:], "!="):
+		operator, p.pos = repository.LabelNotEquals, p.pos+2
+	default:
+		start := p.pos
+		switch word := p.parseWord(); word {
+		case repository.LabelIn, repository.LabelNotIn:
+			operator = word
+		default:
+			p.pos = start
+			return nil, p.errorf("expected an operator after %q - one of [= == != in notin]", key)
+		}
+	}
+
+	p.skipSpaces()
+
+	if operator != repository.LabelIn && operator != repository.LabelNotIn {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return &repository.LabelRequirement{Key: key, Operator: operator, Values: []string{value}}, nil
+	}
+
+	if p.peek() != '(' {
+		return nil, p.errorf("expected \"(\" to start the list of values for %q", operator)
+	}
+	p.pos++
+
+	var values []string
+	for {
+		p.skipSpaces()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		p.skipSpaces()
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+
+	if p.peek() != ')' {
+		return nil, p.errorf("expected \",\" or \")\" in the list of values")
+	}
+	p.pos++
+
+	return &repository.LabelRequirement{Key: key, Operator: operator, Values: values}, nil
+}
+
+func (p *labelSelectorParser) parseKey() (string, error) {
+	start := p.pos
+	key := p.parseWord()
+
+	if key == "" {
+		if p.pos >= len(p.input) {
+			return "", p.errorf("expected a label key, but the selector ended")
+		}
+		return "", p.errorf("expected a label key, found %q", p.input[p.pos])
+	}
+
+	if !repository.IsValidLabelKey(key) {
+		p.pos = start
+		return "", p.errorf("invalid label key %q", key)
+	}
+
+	return key, nil
+}
+
+// Reads a value, which can be empty - for example env= matches services with an empty env label
+func (p *labelSelectorParser) parseValue() (string, error) {
+	start := p.pos
+	value := p.parseWord()
+
+	if !repository.IsValidLabelValue(value) {
+		p.pos = start
+		return "", p.errorf("invalid label value %q", value)
+	}
+
+	return value, nil
+}
+
+func isLabelChar(char byte) bool {
+	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || strings.IndexByte("-_./", char) >= 0
+}
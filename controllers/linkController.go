@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+	"github.com/harshadixit12/service-catalog-api/resources"
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Lists the links of a service
+func GetServiceLinks(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	if _, err := repository.GetServiceByID(orgID.(int), serviceULID.String()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+			return
+		}
+		fmt.Printf("Error loading service: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load links."})
+		return
+	}
+
+	links, err := repository.GetServiceLinks(orgID.(int), serviceULID.String())
+
+	if err != nil {
+		fmt.Printf("Error loading links: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load links."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, links, nil)
+}
+
+// Loads a single link of a service
+func GetServiceLink(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, linkULID, ok := parseLinkParams(c)
+	if !ok {
+		return
+	}
+
+	if _, err := repository.GetServiceByID(orgID.(int), serviceULID.String()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+			return
+		}
+		fmt.Printf("Error loading service: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load link."})
+		return
+	}
+
+	link, err := repository.GetServiceLink(orgID.(int), serviceULID.String(), linkULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Link not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error loading link: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load link."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, link, nil)
+}
+
+// Adds a link to a service
+func CreateServiceLink(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	linkRequestInstance, ok := bindLinkRequest(c)
+	if !ok {
+		return
+	}
+
+	link, err := repository.CreateServiceLink(&repository.ServiceLink{
+		ServiceID:      serviceULID.String(),
+		OrganizationID: orgID.(int),
+		Type:           linkRequestInstance.Type,
+		Title:          linkRequestInstance.Title,
+		URL:            linkRequestInstance.URL,
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error creating link: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to create link."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusCreated, link, nil)
+}
+
+// Replaces the type, title and URL of a link
+func UpdateServiceLink(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, linkULID, ok := parseLinkParams(c)
+	if !ok {
+		return
+	}
+
+	linkRequestInstance, ok := bindLinkRequest(c)
+	if !ok {
+		return
+	}
+
+	link, err := repository.UpdateServiceLink(orgID.(int), serviceULID.String(), linkULID.String(), linkRequestInstance.Type, linkRequestInstance.Title, linkRequestInstance.URL)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service or link not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error updating link: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to update link."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, link, nil)
+}
+
+// Removes a link from a service
+func DeleteServiceLink(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, linkULID, ok := parseLinkParams(c)
+	if !ok {
+		return
+	}
+
+	err := repository.DeleteServiceLink(orgID.(int), serviceULID.String(), linkULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service or link not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error removing link: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to remove link."})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Parses the service and link IDs in the path. Sends a 400 response if either is invalid, and reports whether both are valid.
+func parseLinkParams(c *gin.Context) (ulid.ULID, ulid.ULID, bool) {
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return ulid.ULID{}, ulid.ULID{}, false
+	}
+
+	linkULID, err := ulid.Parse(c.Param("linkId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The link ID is invalid."})
+		return ulid.ULID{}, ulid.ULID{}, false
+	}
+
+	return serviceULID, linkULID, true
+}
+
+// Binds and validates the body of a link request. Sends a 400 response if it is invalid, and reports whether it is valid.
+func bindLinkRequest(c *gin.Context) (*resources.LinkRequestBody, bool) {
+	var linkRequestInstance resources.LinkRequestBody
+
+	if err := c.ShouldBindJSON(&linkRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return nil, false
+	}
+
+	if !repository.IsValidLinkURL(linkRequestInstance.URL) {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid url - must be an absolute http or https URL.", "field": "url", "value": linkRequestInstance.URL})
+		return nil, false
+	}
+
+	return &linkRequestInstance, true
+}
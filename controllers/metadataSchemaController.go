@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+	"github.com/harshadixit12/service-catalog-api/resources"
+)
+
+// Loads the JSON Schema the metadata of the caller's organization's services must match
+func GetServiceMetadataSchema(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	schema, err := repository.GetServiceMetadataSchema(orgID.(int))
+
+	if err != nil {
+		fmt.Printf("Error loading metadata schema: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load the metadata schema."})
+		return
+	}
+
+	if schema == nil {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "The organization has no metadata schema."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, schema, nil)
+}
+
+// Registers the JSON Schema the metadata of the caller's organization's services must match, replacing the previous one.
+// The request body is the schema itself.
+func SetServiceMetadataSchema(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	var schema repository.JSONMap
+
+	if err := c.ShouldBindJSON(&schema); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	if schema == nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The schema must be a JSON object."})
+		return
+	}
+
+	err := repository.SetServiceMetadataSchema(orgID.(int), schema)
+
+	var invalidSchemaErr *repository.InvalidSchemaError
+	if errors.As(err, &invalidSchemaErr) {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The schema is invalid - " + invalidSchemaErr.Error() + "."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error saving metadata schema: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to save the metadata schema."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, schema, nil)
+}
+
+// Removes the metadata schema of the caller's organization, so any metadata is accepted again
+func DeleteServiceMetadataSchema(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	if err := repository.SetServiceMetadataSchema(orgID.(int), nil); err != nil {
+		fmt.Printf("Error removing metadata schema: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to remove the metadata schema."})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
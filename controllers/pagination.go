@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/resources"
+)
+
+// Reads the include_total_count query parameter, and reports whether it is valid.
+// Counting is on by default, and can be turned off for huge lists.
+func parseIncludeTotalCount(c *gin.Context) (bool, bool) {
+	include, err := strconv.ParseBool(c.DefaultQuery("include_total_count", "true"))
+	if err != nil {
+		return false, false
+	}
+	return include, true
+}
+
+// Adds the total number of rows in the list, and the number of pages, to the meta of a page
+func addTotalCount(meta gin.H, totalCount int64, pageSize int) {
+	meta["total_count"] = totalCount
+	meta["total_pages"] = (totalCount + int64(pageSize) - 1) / int64(pageSize)
+}
+
+// Builds the links to the first, previous, next and last pages of a list, from the cursors in the meta of a page,
+// and a cursor to the end of the list. The links keep the other query parameters of the request, like filters and the page size.
+func pageLinks(c *gin.Context, meta gin.H, lastCursor cursorToken) resources.Links {
+	link := func(cursor string) *string {
+		query := c.Request.URL.Query()
+		query.Del("cursor")
+		query.Del("page_number")
+		query.Del("sort_field")
+		query.Del("sort_order")
+		if cursor != "" {
+			// The cursor carries the sort order
+			query.Del("sort")
+			query.Set("cursor", cursor)
+		} else {
+			query.Set("sort", lastCursor.Sort)
+		}
+
+		target := c.Request.URL.Path
+		if encoded := query.Encode(); encoded != "" {
+			target += "?" + encoded
+		}
+		return &target
+	}
+
+	links := resources.Links{First: link(""), Last: link(encodeCursor(lastCursor))}
+
+	if next, ok := meta["next_cursor"].(string); ok {
+		links.Next = link(next)
+	}
+	if prev, ok := meta["prev_cursor"].(string); ok {
+		links.Prev = link(prev)
+	}
+
+	return links
+}
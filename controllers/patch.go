@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/harshadixit12/service-catalog-api/resources"
+)
+
+// Applies the patch in the request body to the JSON representation of a resource (current), and decodes the
+// patched document into target, which is then validated using its binding tags.
+// The patch format is picked using the Content-Type header - JSON Merge Patch or JSON Patch.
+// On failure, returns the HTTP status to respond with, along with an error that can be shown to the user.
+func applyPatch(c *gin.Context, current interface{}, target interface{}) (int, error) {
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("unable to read request body")
+	}
+
+	document, err := json.Marshal(current)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("unable to apply patch")
+	}
+
+	var patched []byte
+	switch c.ContentType() {
+	case resources.MergePatchMediaType:
+		if !json.Valid(patch) {
+			return http.StatusBadRequest, fmt.Errorf("request body is not a valid JSON merge patch")
+		}
+		patched, err = jsonpatch.MergePatch(document, patch)
+		if err != nil {
+			return http.StatusBadRequest, fmt.Errorf("request body is not a valid JSON merge patch: %v", err)
+		}
+	case resources.JSONPatchMediaType:
+		operations, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return http.StatusBadRequest, fmt.Errorf("request body is not a valid JSON patch: %v", err)
+		}
+		patched, err = operations.Apply(document)
+		if err != nil {
+			return http.StatusUnprocessableEntity, fmt.Errorf("unable to apply JSON patch: %v", err)
+		}
+	default:
+		return http.StatusUnsupportedMediaType, fmt.Errorf("Content-Type must be one of [%s, %s]", resources.MergePatchMediaType, resources.JSONPatchMediaType)
+	}
+
+	// Patches can only touch the fields which are part of the request body of the resource
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("patched document is invalid: %v", err)
+	}
+
+	if err := binding.Validator.ValidateStruct(target); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	return http.StatusOK, nil
+}
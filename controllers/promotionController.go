@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+	"github.com/harshadixit12/service-catalog-api/resources"
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Promotes a version of a service to the next environment of the pipeline, by the caller.
+// Rejected promotions are recorded, and answered with the gates the version failed.
+func PromoteVersion(c *gin.Context) {
+	userID, userExists := c.Get("userID")
+	orgID, orgExists := c.Get("organizationID")
+	if !userExists || !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	var promotionRequestInstance resources.PromotionRequestBody
+
+	if err := c.ShouldBindJSON(&promotionRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	versionULID, err := ulid.Parse(promotionRequestInstance.VersionID)
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid version_id - must be a version ID."})
+		return
+	}
+
+	environmentULID, err := ulid.Parse(promotionRequestInstance.EnvironmentID)
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid environment_id - must be an environment ID."})
+		return
+	}
+
+	status := promotionRequestInstance.Status
+	if status == "" {
+		status = repository.DeploymentSucceeded
+	}
+
+	promotion, err := repository.PromoteVersion(&repository.Promotion{
+		OrganizationID:  orgID.(int),
+		ServiceID:       serviceULID.String(),
+		VersionID:       versionULID.String(),
+		ToEnvironmentID: environmentULID.String(),
+		UserID:          userID.(int),
+	}, status)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Version or environment not found."})
+		return
+	}
+
+	if sendIfPromotionRejected(c, err) {
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error promoting version: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to promote the version."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusCreated, promotion, nil)
+}
+
+// Lists the promotion history of a service, newest first - including rejected promotions
+func GetServicePromotions(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size_limit", "25"))
+	pageNumber, _ := strconv.Atoi(c.DefaultQuery("page_number", "1"))
+
+	if pageNumber < 1 {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid page_number - must be greater than 1."})
+		return
+	}
+
+	if pageSize < 1 || pageSize > 100 {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid page_size_limit - must be greater than 1 and less than 101."})
+		return
+	}
+
+	if _, err := repository.GetServiceByID(orgID.(int), serviceULID.String()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+			return
+		}
+		fmt.Printf("Error loading service: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load promotions."})
+		return
+	}
+
+	promotions, err := repository.GetServicePromotions(orgID.(int), serviceULID.String(), pageSize, pageNumber)
+
+	if err != nil {
+		fmt.Printf("Error loading promotions: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load promotions."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, promotions, gin.H{"PageNumber": pageNumber, "PageSize": len(promotions), "PageSizeLimit": pageSize})
+}
+
+// Approves a version of a service for promotion to an environment, by the caller
+func ApproveVersion(c *gin.Context) {
+	userID, userExists := c.Get("userID")
+	orgID, orgExists := c.Get("organizationID")
+	if !userExists || !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, versionULID, ok := parseVersionParams(c)
+	if !ok {
+		return
+	}
+
+	var approvalRequestInstance resources.ApprovalRequestBody
+
+	if err := c.ShouldBindJSON(&approvalRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	environmentULID, err := ulid.Parse(approvalRequestInstance.EnvironmentID)
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid environment_id - must be an environment ID."})
+		return
+	}
+
+	approval, err := repository.ApproveVersion(&repository.VersionApproval{
+		OrganizationID: orgID.(int),
+		ServiceID:      serviceULID.String(),
+		VersionID:      versionULID.String(),
+		EnvironmentID:  environmentULID.String(),
+		UserID:         userID.(int),
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Version or environment not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error approving version: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to approve the version."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusCreated, approval, nil)
+}
+
+// Lists the promotion approvals of a version of a service
+func GetVersionApprovals(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, versionULID, ok := parseVersionParams(c)
+	if !ok {
+		return
+	}
+
+	approvals, err := repository.GetVersionApprovals(orgID.(int), serviceULID.String(), versionULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Version not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error loading approvals: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load approvals."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, approvals, nil)
+}
+
+// Parses the service and version IDs from the path
+func parseVersionParams(c *gin.Context) (ulid.ULID, ulid.ULID, bool) {
+	serviceULID, serviceErr := ulid.Parse(c.Param("serviceId"))
+	versionULID, versionErr := ulid.Parse(c.Param("versionId"))
+	if serviceErr != nil || versionErr != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID or version ID is invalid."})
+		return ulid.ULID{}, ulid.ULID{}, false
+	}
+
+	return serviceULID, versionULID, true
+}
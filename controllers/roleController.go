@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+	"github.com/harshadixit12/service-catalog-api/resources"
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Lists the users of the caller's organization, along with their roles
+func GetUsers(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	users, err := repository.GetUsers(orgID.(int))
+
+	if err != nil {
+		fmt.Printf("Error loading users: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load users."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, users, nil)
+}
+
+// Updates the organization wide role of a user
+func SetUserRole(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The user ID is invalid."})
+		return
+	}
+
+	var roleRequestInstance resources.RoleRequestBody
+
+	if err := c.ShouldBindJSON(&roleRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	user, err := repository.SetUserRole(orgID.(int), userID, roleRequestInstance.Role)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "User not found."})
+		return
+	}
+
+	if errors.Is(err, repository.ErrLastAdmin) {
+		resources.SendError(c, http.StatusConflict, gin.H{"message": "The user is the only admin of the organization - make another user an admin first."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error updating user role: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to update user role."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, user, nil)
+}
+
+// Lists the per-service role overrides of a service
+func GetServiceRoles(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	if _, err := repository.GetServiceByID(orgID.(int), serviceULID.String()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+			return
+		}
+		fmt.Printf("Error loading service: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load role assignments."})
+		return
+	}
+
+	assignments, err := repository.GetServiceRoleAssignments(orgID.(int), serviceULID.String())
+
+	if err != nil {
+		fmt.Printf("Error loading role assignments: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load role assignments."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, assignments, nil)
+}
+
+// Creates or replaces the role override of a user for a service
+func SetServiceRole(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The user ID is invalid."})
+		return
+	}
+
+	var roleRequestInstance resources.RoleRequestBody
+
+	if err := c.ShouldBindJSON(&roleRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	assignment, err := repository.SetServiceRole(orgID.(int), serviceULID.String(), userID, roleRequestInstance.Role)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service or user not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error assigning service role: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to assign role."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, assignment, nil)
+}
+
+// Removes the role override of a user for a service, so their organization wide role applies again
+func DeleteServiceRole(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The user ID is invalid."})
+		return
+	}
+
+	err = repository.DeleteServiceRole(orgID.(int), serviceULID.String(), userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Role assignment not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error removing service role: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to remove role assignment."})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
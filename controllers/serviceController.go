@@ -1,40 +1,35 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/harshadixit12/service-catalog-api/repository"
 	"github.com/harshadixit12/service-catalog-api/resources"
+	"github.com/harshadixit12/service-catalog-api/webhooks"
 
 	"github.com/gin-gonic/gin"
 	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
 )
 
-// List of fields supported for filtering
+// List of fields supported for filtering, along with the type of their values
 // Ideally, this should be available for other controllers to use as well.
-var allowedFilterFields = map[string]bool{
-	"name":        true,
-	"description": true,
+var allowedFilterFields = map[string]string{
+	"id":            filterTypeString,
+	"name":          filterTypeString,
+	"description":   filterTypeString,
+	"created_at":    filterTypeTime,
+	"updated_at":    filterTypeTime,
+	"version_count": filterTypeInt,
+	"metadata":      filterTypeJSON,
 }
 
-var allowedSortFields = map[string]bool{
-	"ID":            true,
-	"id":            true,
-	"Name":          true,
-	"name":          true,
-	"created_at":    true,
-	"updated_at":    true,
-	"version_count": true,
-}
-
-var allowedSortOrder = map[string]bool{
-	"asc":  true,
-	"desc": true,
-	"ASC":  true,
-	"DESC": true,
-}
+// Fields supported by the original filter_field parameter, kept for older clients
+var legacyFilterFields = map[string]bool{"name": true, "description": true}
 
 func GetServices(c *gin.Context) {
 	_, userExists := c.Get("userID")
@@ -46,8 +41,6 @@ func GetServices(c *gin.Context) {
 
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size_limit", "25"))
 	pageNumber, _ := strconv.Atoi(c.DefaultQuery("page_number", "1"))
-	sortField := c.DefaultQuery("sort_field", "ID")  // Default sort field
-	sortOrder := c.DefaultQuery("sort_order", "asc") // Default sort order
 	filterField := c.DefaultQuery("filter_field", "")
 	filterValue := c.DefaultQuery("filter_value", "")
 
@@ -61,24 +54,85 @@ func GetServices(c *gin.Context) {
 		return
 	}
 
-	if !allowedSortFields[sortField] {
-		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid sort_field - must be one of [id, name, created_at, updated_at, version_count]."})
+	includeTotalCount, ok := parseIncludeTotalCount(c)
+	if !ok {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid include_total_count - must be true or false."})
+		return
+	}
+
+	sortFields, sortRequested, err := parseSort(c, repository.ServiceSortFields, "id")
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
 
-	if !allowedSortOrder[sortOrder] {
-		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid sort_order - must be one of [asc, desc]."})
+	// Cursors continue the list in the sort order they were issued for
+	cursor, err := parseCursorParam(c.Query("cursor"), fmt.Sprintf("services:%d", orgID.(int)), sortFields, sortRequested)
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid cursor - " + err.Error() + "."})
 		return
 	}
 
+	if cursor != nil {
+		if _, pageRequested := c.GetQuery("page_number"); pageRequested {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid page_number - can not be combined with a cursor."})
+			return
+		}
+		if sortFields, err = parseSortSpec(cursor.Sort, repository.ServiceSortFields); err != nil {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid cursor - " + errInvalidCursor.Error() + "."})
+			return
+		}
+	}
+
+	var filters []repository.FilterExpression
+
 	if filterField != "" || filterValue != "" {
-		if !allowedFilterFields[filterField] {
+		if !legacyFilterFields[filterField] {
 			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid filter_field: must be one of [name, description]"})
 			return
 		}
+		if filterValue != "" {
+			filters = append(filters, repository.FilterExpression{Column: filterField, Operator: repository.FilterEqual, Values: []interface{}{filterValue}})
+		}
+	}
+
+	if filterParam := c.Query("filter"); filterParam != "" {
+		filter, err := parseFilter(filterParam, allowedFilterFields)
+		if err != nil {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid filter " + err.Error() + "."})
+			return
+		}
+		filters = append(filters, *filter)
+	}
+
+	var filter repository.ServiceListFilter
+	if len(filters) > 0 {
+		filter.Expression = &repository.FilterExpression{And: filters}
+	}
+
+	if labelsParam := c.Query("labels"); labelsParam != "" {
+		filter.Labels, err = parseLabelSelector(labelsParam)
+		if err != nil {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid labels " + err.Error() + "."})
+			return
+		}
+	}
+
+	if ownerTeam := c.Query("owner_team"); ownerTeam != "" {
+		teamULID, err := ulid.Parse(ownerTeam)
+		if err != nil {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid owner_team - must be a team ID."})
+			return
+		}
+		filter.OwnerTeamID = teamULID.String()
 	}
 
-	services, err := repository.GetServices(orgID.(int), pageSize, pageNumber, sortField, sortOrder, filterField, filterValue)
+	services, hasMore, err := repository.GetServices(orgID.(int), pageSize, pageNumber, sortFields, filter, cursor.keyset())
+
+	if errors.Is(err, repository.ErrInvalidKeyset) {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid cursor - " + errInvalidCursor.Error() + "."})
+		return
+	}
 
 	if err != nil {
 		fmt.Printf("Error loading services: %v\n", err)
@@ -86,12 +140,72 @@ func GetServices(c *gin.Context) {
 		return
 	}
 
-	resources.SendSuccess(c, http.StatusOK, services, gin.H{"PageNumber": pageNumber, "PageSize": len(services), "PageSizeLimit": pageSize})
+	meta := gin.H{"PageSize": len(services), "PageSizeLimit": pageSize}
+	if cursor == nil {
+		meta["PageNumber"] = pageNumber
+		cursor = &cursorToken{Scope: fmt.Sprintf("services:%d", orgID.(int)), Sort: repository.FormatSort(sortFields)}
+	}
+	addPageCursors(meta, *cursor, len(services), hasMore, cursor.Values != nil || pageNumber > 1, func(i int) []interface{} {
+		return repository.ServiceKeysetValues(services[i], sortFields)
+	})
+
+	if includeTotalCount {
+		totalCount, err := repository.CountServices(orgID.(int), filter)
+		if err != nil {
+			fmt.Printf("Error counting services: %v\n", err)
+			resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to count services."})
+			return
+		}
+		addTotalCount(meta, totalCount, pageSize)
+	}
+
+	links := pageLinks(c, meta, cursorToken{Scope: fmt.Sprintf("services:%d", orgID.(int)), Sort: repository.FormatSort(sortFields), Backward: true})
+
+	resources.SendPage(c, http.StatusOK, services, meta, links)
+}
+
+// Searches services by name and description, most relevant first - for example /services/search?q=pay
+// Matched terms are highlighted in the results.
+func SearchServices(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size_limit", "25"))
+	pageNumber, _ := strconv.Atoi(c.DefaultQuery("page_number", "1"))
+
+	if query == "" {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Missing search query - q is required."})
+		return
+	}
+
+	if pageNumber < 1 {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid page_number - must be greater than 1."})
+		return
+	}
+
+	if pageSize < 1 || pageSize > 100 {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid page_size_limit - must be greater than 1 and less than 101."})
+		return
+	}
+
+	results, err := repository.SearchServices(orgID.(int), query, pageSize, pageNumber)
+
+	if err != nil {
+		fmt.Printf("Error searching services: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to search services."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, results, gin.H{"PageNumber": pageNumber, "PageSize": len(results), "PageSizeLimit": pageSize})
 }
 
 func GetServiceByID(c *gin.Context) {
 	_, userExists := c.Get("userID")
-	_, orgExists := c.Get("organizationID")
+	orgID, orgExists := c.Get("organizationID")
 	if !userExists || !orgExists {
 		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
 		return
@@ -107,7 +221,12 @@ func GetServiceByID(c *gin.Context) {
 		return
 	}
 
-	service, err := repository.GetServiceByID(serviceULID.String())
+	service, err := repository.GetServiceByID(orgID.(int), serviceULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+		return
+	}
 
 	if err != nil {
 		fmt.Printf("Error loading service: %v\n", err)
@@ -115,13 +234,20 @@ func GetServiceByID(c *gin.Context) {
 		return
 	}
 
+	service.Links, err = repository.GetServiceLinks(orgID.(int), service.ID)
+
+	if err != nil {
+		fmt.Printf("Error loading links: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load service."})
+		return
+	}
+
 	resources.SendSuccess(c, http.StatusOK, service, nil)
 }
 
 func CreateService(c *gin.Context) {
 	userID, userExists := c.Get("userID")
 	orgID, orgExists := c.Get("organizationID")
-	fmt.Printf("%s %s", userID, orgID)
 	if !userExists || !orgExists {
 		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
 		return
@@ -134,15 +260,173 @@ func CreateService(c *gin.Context) {
 		return
 	}
 
-	service := repository.Service{Name: serviceRequestInstance.Name, Description: serviceRequestInstance.Description, UserID: 1, OrganizationID: 1}
+	service := repository.Service{Name: serviceRequestInstance.Name, Description: serviceRequestInstance.Description, VersioningScheme: serviceRequestInstance.VersioningScheme, Metadata: serviceRequestInstance.Metadata, UserID: userID.(int), OrganizationID: orgID.(int)}
 
 	createdService, err := repository.CreateService(&service)
 
+	if sendIfDuplicateName(c, err) || sendIfInvalidMetadata(c, err) {
+		return
+	}
+
 	if err != nil {
 		fmt.Printf("Error creating service: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to create service."})
 		return
 	}
 
+	webhooks.Publish(orgID.(int), repository.EventServiceCreated, createdService)
+
 	resources.SendSuccess(c, http.StatusCreated, createdService, nil)
 }
+
+// Replaces the name, description, versioning scheme and metadata of a service
+func UpdateService(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Service ID is not valid."})
+		return
+	}
+
+	var serviceRequestInstance resources.ServiceRequestBody
+
+	if err := c.ShouldBindJSON(&serviceRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	saveService(c, orgID.(int), serviceULID.String(), serviceRequestInstance)
+}
+
+// Partially updates a service, using either a JSON Merge Patch or a JSON Patch document
+func PatchService(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Service ID is not valid."})
+		return
+	}
+
+	service, err := repository.GetServiceByID(orgID.(int), serviceULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error loading service: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to update service."})
+		return
+	}
+
+	current := resources.ServiceRequestBody{Name: service.Name, Description: service.Description, VersioningScheme: service.VersioningScheme, Metadata: service.Metadata}
+	var serviceRequestInstance resources.ServiceRequestBody
+
+	if status, err := applyPatch(c, current, &serviceRequestInstance); err != nil {
+		resources.SendError(c, status, gin.H{"message": err.Error()})
+		return
+	}
+
+	saveService(c, orgID.(int), serviceULID.String(), serviceRequestInstance)
+}
+
+// Saves the validated request body on the service, and sends the updated service
+func saveService(c *gin.Context, orgID int, serviceID string, serviceRequestInstance resources.ServiceRequestBody) {
+	updatedService, err := repository.UpdateService(orgID, serviceID, serviceRequestInstance.Name, serviceRequestInstance.Description, serviceRequestInstance.VersioningScheme, serviceRequestInstance.Metadata)
+
+	if sendIfDuplicateName(c, err) || sendIfInvalidVersionName(c, err, http.StatusConflict) || sendIfInvalidMetadata(c, err) {
+		return
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error updating service: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to update service."})
+		return
+	}
+
+	webhooks.Publish(orgID, repository.EventServiceUpdated, updatedService)
+
+	resources.SendSuccess(c, http.StatusOK, updatedService, nil)
+}
+
+// Soft deletes a service, along with its versions
+func DeleteService(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Service ID is not valid."})
+		return
+	}
+
+	err = repository.DeleteService(orgID.(int), serviceULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error deleting service: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to delete service."})
+		return
+	}
+
+	webhooks.Publish(orgID.(int), repository.EventServiceDeleted, gin.H{"ID": serviceULID.String()})
+
+	c.Status(http.StatusNoContent)
+}
+
+// Restores a soft deleted service, along with the versions deleted with it
+func RestoreService(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Service ID is not valid."})
+		return
+	}
+
+	restoredService, err := repository.RestoreService(orgID.(int), serviceULID.String())
+
+	if sendIfDuplicateName(c, err) {
+		return
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Deleted service not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error restoring service: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to restore service."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, restoredService, nil)
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+)
+
+// Most fields a list can be sorted by at once
+const maxSortFields = 5
+
+// Sort orders supported by the sort_order parameter
+var allowedSortOrder = map[string]bool{
+	"asc":  true,
+	"desc": true,
+	"ASC":  true,
+	"DESC": true,
+}
+
+// Reads the sort order of a list request, and reports whether the client asked for one. The order is given either as
+// sort=-version_count,name - a comma separated list of fields, with a "-" before descending fields - or using the older
+// sort_field and sort_order parameters, for a single field. Fields are validated against the whitelist of the list.
+func parseSort(c *gin.Context, allowed []string, defaultField string) ([]repository.SortField, bool, error) {
+	sortParam, sortRequested := c.GetQuery("sort")
+	sortField, sortFieldRequested := c.GetQuery("sort_field")
+	sortOrder, sortOrderRequested := c.GetQuery("sort_order")
+
+	if sortRequested && (sortFieldRequested || sortOrderRequested) {
+		return nil, false, errors.New("Invalid sort - can not be combined with sort_field and sort_order.")
+	}
+
+	if sortRequested {
+		fields, err := parseSortSpec(sortParam, allowed)
+		if err != nil {
+			return nil, false, fmt.Errorf("Invalid sort - %w.", err)
+		}
+		return fields, true, nil
+	}
+
+	if !sortFieldRequested {
+		sortField = defaultField
+	}
+	if !sortOrderRequested {
+		sortOrder = "asc"
+	}
+
+	// Older clients send some field names capitalized, like ID and Name
+	sortField = strings.ToLower(sortField)
+
+	if !slices.Contains(allowed, sortField) {
+		return nil, false, fmt.Errorf("Invalid sort_field - must be one of [%s].", strings.Join(allowed, ", "))
+	}
+
+	if !allowedSortOrder[sortOrder] {
+		return nil, false, errors.New("Invalid sort_order - must be one of [asc, desc].")
+	}
+
+	return []repository.SortField{{Name: sortField, Desc: strings.EqualFold(sortOrder, "desc")}}, sortFieldRequested || sortOrderRequested, nil
+}
+
+// Parses a comma separated list of sort fields, like -version_count,name
+func parseSortSpec(spec string, allowed []string) ([]repository.SortField, error) {
+	parts := strings.Split(spec, ",")
+	if len(parts) > maxSortFields {
+		return nil, fmt.Errorf("at most %d fields are allowed", maxSortFields)
+	}
+
+	fields := make([]repository.SortField, 0, len(parts))
+	for _, part := range parts {
+		field := repository.SortField{Name: part}
+		if name, found := strings.CutPrefix(part, "-"); found {
+			field = repository.SortField{Name: name, Desc: true}
+		} else if name, found := strings.CutPrefix(part, "+"); found {
+			field.Name = name
+		}
+
+		if field.Name == "" {
+			return nil, errors.New("empty field name")
+		}
+
+		if !slices.Contains(allowed, field.Name) {
+			return nil, fmt.Errorf("unknown field %q, must be one of [%s]", field.Name, strings.Join(allowed, ", "))
+		}
+
+		for _, previous := range fields {
+			if previous.Name == field.Name {
+				return nil, fmt.Errorf("field %q is repeated", field.Name)
+			}
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
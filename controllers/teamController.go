@@ -0,0 +1,343 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+	"github.com/harshadixit12/service-catalog-api/resources"
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Lists the teams of the caller's organization
+func GetTeams(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	teams, err := repository.GetTeams(orgID.(int))
+
+	if err != nil {
+		fmt.Printf("Error loading teams: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load teams."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, teams, nil)
+}
+
+// Creates a team in the caller's organization
+func CreateTeam(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	var teamRequestInstance resources.TeamRequestBody
+
+	if err := c.ShouldBindJSON(&teamRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	team, err := repository.CreateTeam(&repository.Team{
+		OrganizationID: orgID.(int),
+		Name:           teamRequestInstance.Name,
+		Description:    teamRequestInstance.Description,
+	})
+
+	if sendIfDuplicateName(c, err) {
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error creating team: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to create team."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusCreated, team, nil)
+}
+
+// Loads a single team by ID
+func GetTeam(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	teamULID, err := ulid.Parse(c.Param("teamId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The team ID is invalid."})
+		return
+	}
+
+	team, err := repository.GetTeamByID(orgID.(int), teamULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Team not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error loading team: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load team."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, team, nil)
+}
+
+// Lists the members of a team
+func GetTeamMembers(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	teamULID, err := ulid.Parse(c.Param("teamId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The team ID is invalid."})
+		return
+	}
+
+	if !checkTeamExists(c, orgID.(int), teamULID.String(), "Unable to load team members.") {
+		return
+	}
+
+	members, err := repository.GetTeamMembers(orgID.(int), teamULID.String())
+
+	if err != nil {
+		fmt.Printf("Error loading team members: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load team members."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, members, nil)
+}
+
+// Adds a user to a team
+func AddTeamMember(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	teamULID, err := ulid.Parse(c.Param("teamId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The team ID is invalid."})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The user ID is invalid."})
+		return
+	}
+
+	member, err := repository.AddTeamMember(orgID.(int), teamULID.String(), userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Team or user not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error adding team member: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to add team member."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, member, nil)
+}
+
+// Removes a user from a team
+func RemoveTeamMember(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	teamULID, err := ulid.Parse(c.Param("teamId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The team ID is invalid."})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The user ID is invalid."})
+		return
+	}
+
+	err = repository.RemoveTeamMember(orgID.(int), teamULID.String(), userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Team member not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error removing team member: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to remove team member."})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Lists the services a team owns or maintains, along with the role of the team for each
+func GetTeamServices(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	teamULID, err := ulid.Parse(c.Param("teamId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The team ID is invalid."})
+		return
+	}
+
+	if !checkTeamExists(c, orgID.(int), teamULID.String(), "Unable to load team services.") {
+		return
+	}
+
+	services, err := repository.GetTeamServices(orgID.(int), teamULID.String())
+
+	if err != nil {
+		fmt.Printf("Error loading team services: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load team services."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, services, nil)
+}
+
+// Loads the teams owning and maintaining a service
+func GetServiceOwners(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	if _, err := repository.GetServiceByID(orgID.(int), serviceULID.String()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+			return
+		}
+		fmt.Printf("Error loading service: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load service owners."})
+		return
+	}
+
+	owners, err := repository.GetServiceOwners(orgID.(int), serviceULID.String())
+
+	if err != nil {
+		fmt.Printf("Error loading service owners: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load service owners."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, owners, nil)
+}
+
+// Reassigns the ownership of a service - replaces its owner and maintainers
+func SetServiceOwners(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	var ownersRequestInstance resources.ServiceOwnersRequestBody
+
+	if err := c.ShouldBindJSON(&ownersRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	ownerTeamID := ""
+	if ownersRequestInstance.OwnerTeamID != "" {
+		teamULID, err := ulid.Parse(ownersRequestInstance.OwnerTeamID)
+		if err != nil {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid owner_team_id - must be a team ID."})
+			return
+		}
+		ownerTeamID = teamULID.String()
+	}
+
+	maintainerTeamIDs := make([]string, len(ownersRequestInstance.MaintainerTeamIDs))
+	for i, teamID := range ownersRequestInstance.MaintainerTeamIDs {
+		teamULID, err := ulid.Parse(teamID)
+		if err != nil {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid maintainer_team_ids - must be team IDs."})
+			return
+		}
+		maintainerTeamIDs[i] = teamULID.String()
+	}
+
+	owners, err := repository.SetServiceOwners(orgID.(int), serviceULID.String(), ownerTeamID, maintainerTeamIDs)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+		return
+	}
+
+	var invalidOwnersErr *repository.InvalidOwnersError
+	if errors.As(err, &invalidOwnersErr) {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid owners - " + invalidOwnersErr.Error() + "."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error setting service owners: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to set service owners."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, owners, nil)
+}
+
+// Reports whether the team exists in the organization. If it does not, a 404 response is sent (or a 500 if it can't be loaded).
+func checkTeamExists(c *gin.Context, organizationID int, teamID string, failureMessage string) bool {
+	_, err := repository.GetTeamByID(organizationID, teamID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Team not found."})
+		return false
+	}
+
+	if err != nil {
+		fmt.Printf("Error loading team: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": failureMessage})
+		return false
+	}
+
+	return true
+}
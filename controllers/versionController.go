@@ -1,21 +1,24 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/harshadixit12/service-catalog-api/repository"
 	"github.com/harshadixit12/service-catalog-api/resources"
+	"github.com/harshadixit12/service-catalog-api/webhooks"
 	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
 )
 
 func CreateVersion(c *gin.Context) {
 	// Load user and organization IDs from auth
 	userID, userExists := c.Get("userID")
 	orgID, orgExists := c.Get("organizationID")
-	fmt.Printf("%s %s", userID, orgID)
 	if !userExists || !orgExists {
 		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
 		return
@@ -36,20 +39,38 @@ func CreateVersion(c *gin.Context) {
 		return
 	}
 
-	version := repository.Version{Name: versionRequestInstance.Name, ServiceID: serviceULID.String(), UserID: userID.(int), OrganizationID: orgID.(int)}
+	version := repository.Version{Name: versionRequestInstance.Name, ServiceID: serviceULID.String(), UserID: userID.(int), OrganizationID: orgID.(int), Metadata: versionRequestInstance.Metadata}
 
 	createdVersion, err := repository.CreateVersion(&version)
 
+	if sendIfDuplicateName(c, err) || sendIfInvalidVersionName(c, err, http.StatusBadRequest) {
+		return
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+		return
+	}
+
 	if err != nil {
 		fmt.Printf("Error creating service: %v\n", err)
 		resources.SendError(c, http.StatusInternalServerError, gin.H{"error": "Unable to create version."})
 		return
 	}
 
+	webhooks.Publish(orgID.(int), repository.EventVersionCreated, createdVersion)
+
 	resources.SendSuccess(c, http.StatusCreated, createdVersion, nil)
 }
 
 func GetServiceVersions(c *gin.Context) {
+	_, userExists := c.Get("userID")
+	orgID, orgExists := c.Get("organizationID")
+	if !userExists || !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
 	serviceULID, err := ulid.Parse(c.Param("serviceId"))
 
 	if err != nil {
@@ -70,13 +91,67 @@ func GetServiceVersions(c *gin.Context) {
 		return
 	}
 
+	includeTotalCount, ok := parseIncludeTotalCount(c)
+	if !ok {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid include_total_count - must be true or false."})
+		return
+	}
+
+	sortFields, sortRequested, err := parseSort(c, repository.VersionSortFields, "id")
 	if err != nil {
 		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
 
-	version := repository.Version{ServiceID: serviceULID.String()}
-	versions, err := repository.GetServiceVersions(version, pageNumber, pageSize)
+	// Cursors continue the list in the sort order they were issued for
+	cursorScope := "versions:" + serviceULID.String()
+	cursor, err := parseCursorParam(c.Query("cursor"), cursorScope, sortFields, sortRequested)
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid cursor - " + err.Error() + "."})
+		return
+	}
+
+	if cursor != nil {
+		if _, pageRequested := c.GetQuery("page_number"); pageRequested {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid page_number - can not be combined with a cursor."})
+			return
+		}
+		if sortFields, err = parseSortSpec(cursor.Sort, repository.VersionSortFields); err != nil {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid cursor - " + errInvalidCursor.Error() + "."})
+			return
+		}
+	}
+
+	// Comma separated list of states, for example state=active,deprecated
+	var states []string
+	if stateParam := c.Query("state"); stateParam != "" {
+		states = strings.Split(stateParam, ",")
+		for _, state := range states {
+			if !repository.IsValidVersionState(state) {
+				resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid state - must be a comma separated list of [active, deprecated, yanked, retired]."})
+				return
+			}
+		}
+	}
+
+	// Services of other organizations are reported as not found
+	if _, err := repository.GetServiceByID(orgID.(int), serviceULID.String()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			resources.SendError(c, http.StatusNotFound, gin.H{"message": "Service not found."})
+			return
+		}
+		fmt.Printf("Error loading service: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to fetch service versions."})
+		return
+	}
+
+	version := repository.Version{ServiceID: serviceULID.String(), OrganizationID: orgID.(int)}
+	versions, hasMore, err := repository.GetServiceVersions(version, states, pageNumber, pageSize, sortFields, cursor.keyset())
+
+	if errors.Is(err, repository.ErrInvalidKeyset) {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid cursor - " + errInvalidCursor.Error() + "."})
+		return
+	}
 
 	if err != nil {
 		fmt.Printf("Error fetching services: %v\n", err)
@@ -84,5 +159,282 @@ func GetServiceVersions(c *gin.Context) {
 		return
 	}
 
-	resources.SendSuccess(c, http.StatusOK, versions, gin.H{"PageNumber": pageNumber, "PageSize": len(versions), "PageSizeLimit": pageSize})
+	meta := gin.H{"PageSize": len(versions), "PageSizeLimit": pageSize}
+	if cursor == nil {
+		meta["PageNumber"] = pageNumber
+		cursor = &cursorToken{Scope: cursorScope, Sort: repository.FormatSort(sortFields)}
+	}
+	addPageCursors(meta, *cursor, len(versions), hasMore, cursor.Values != nil || pageNumber > 1, func(i int) []interface{} {
+		return repository.VersionKeysetValues(versions[i], sortFields)
+	})
+
+	if includeTotalCount {
+		totalCount, err := repository.CountServiceVersions(version, states)
+		if err != nil {
+			fmt.Printf("Error counting versions: %v\n", err)
+			resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to count versions."})
+			return
+		}
+		addTotalCount(meta, totalCount, pageSize)
+	}
+
+	links := pageLinks(c, meta, cursorToken{Scope: cursorScope, Sort: repository.FormatSort(sortFields), Backward: true})
+
+	resources.SendPage(c, http.StatusOK, versions, meta, links)
+}
+
+// Soft deletes a version of a service
+func DeleteVersion(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, serviceErr := ulid.Parse(c.Param("serviceId"))
+	versionULID, versionErr := ulid.Parse(c.Param("versionId"))
+	if serviceErr != nil || versionErr != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID or version ID is invalid."})
+		return
+	}
+
+	err := repository.DeleteVersion(orgID.(int), serviceULID.String(), versionULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Version not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error deleting version: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to delete version."})
+		return
+	}
+
+	webhooks.Publish(orgID.(int), repository.EventVersionDeleted, gin.H{"ID": versionULID.String(), "ServiceID": serviceULID.String()})
+
+	c.Status(http.StatusNoContent)
+}
+
+// Restores a soft deleted version of a service
+func RestoreVersion(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, serviceErr := ulid.Parse(c.Param("serviceId"))
+	versionULID, versionErr := ulid.Parse(c.Param("versionId"))
+	if serviceErr != nil || versionErr != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID or version ID is invalid."})
+		return
+	}
+
+	restoredVersion, err := repository.RestoreVersion(orgID.(int), serviceULID.String(), versionULID.String())
+
+	if sendIfDuplicateName(c, err) || sendIfInvalidVersionName(c, err, http.StatusConflict) {
+		return
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Deleted version not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error restoring version: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to restore version."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, restoredVersion, nil)
+}
+
+// Loads a single version of a service, by ID
+func GetVersion(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, serviceErr := ulid.Parse(c.Param("serviceId"))
+	versionULID, versionErr := ulid.Parse(c.Param("versionId"))
+	if serviceErr != nil || versionErr != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID or version ID is invalid."})
+		return
+	}
+
+	version, err := repository.GetVersionByID(orgID.(int), serviceULID.String(), versionULID.String())
+
+	sendVersion(c, version, err)
+}
+
+// Loads a single version of a service, by name - for example /services/:serviceId/versions/by-name/v1.2.0
+func GetVersionByName(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	version, err := repository.GetVersionByName(orgID.(int), serviceULID.String(), c.Param("versionName"))
+
+	sendVersion(c, version, err)
+}
+
+// Replaces the name and metadata of a version
+func UpdateVersion(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, serviceErr := ulid.Parse(c.Param("serviceId"))
+	versionULID, versionErr := ulid.Parse(c.Param("versionId"))
+	if serviceErr != nil || versionErr != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID or version ID is invalid."})
+		return
+	}
+
+	var versionRequestInstance resources.VersionUpdateRequestBody
+
+	if err := c.ShouldBindJSON(&versionRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	updatedVersion, err := repository.UpdateVersion(orgID.(int), serviceULID.String(), versionULID.String(), versionRequestInstance.Name, versionRequestInstance.Metadata)
+
+	if err == nil {
+		webhooks.Publish(orgID.(int), repository.EventVersionUpdated, updatedVersion)
+	}
+
+	sendVersion(c, updatedVersion, err)
+}
+
+// Partially updates a version, using either a JSON Merge Patch or a JSON Patch document
+func PatchVersion(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, serviceErr := ulid.Parse(c.Param("serviceId"))
+	versionULID, versionErr := ulid.Parse(c.Param("versionId"))
+	if serviceErr != nil || versionErr != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID or version ID is invalid."})
+		return
+	}
+
+	version, err := repository.GetVersionByID(orgID.(int), serviceULID.String(), versionULID.String())
+	if err != nil {
+		sendVersion(c, version, err)
+		return
+	}
+
+	current := resources.VersionUpdateRequestBody{Name: version.Name, Metadata: version.Metadata}
+	var versionRequestInstance resources.VersionUpdateRequestBody
+
+	if status, err := applyPatch(c, current, &versionRequestInstance); err != nil {
+		resources.SendError(c, status, gin.H{"message": err.Error()})
+		return
+	}
+
+	updatedVersion, err := repository.UpdateVersion(orgID.(int), serviceULID.String(), versionULID.String(), versionRequestInstance.Name, versionRequestInstance.Metadata)
+
+	if err == nil {
+		webhooks.Publish(orgID.(int), repository.EventVersionUpdated, updatedVersion)
+	}
+
+	sendVersion(c, updatedVersion, err)
+}
+
+// Moves a version to another lifecycle state, for example to deprecate it with a sunset date
+func TransitionVersion(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, serviceErr := ulid.Parse(c.Param("serviceId"))
+	versionULID, versionErr := ulid.Parse(c.Param("versionId"))
+	if serviceErr != nil || versionErr != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID or version ID is invalid."})
+		return
+	}
+
+	var transitionRequestInstance resources.VersionTransitionRequestBody
+
+	if err := c.ShouldBindJSON(&transitionRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	version, err := repository.TransitionVersion(orgID.(int), serviceULID.String(), versionULID.String(), transitionRequestInstance.State, transitionRequestInstance.DeprecatedAt, transitionRequestInstance.SunsetAt)
+
+	if err == nil {
+		webhooks.Publish(orgID.(int), repository.EventVersionUpdated, version)
+	}
+
+	sendVersion(c, version, err)
+}
+
+// Sends a version loaded from the repository, or the matching error response.
+// Deprecated versions come with Deprecation (RFC 9745) and Sunset (RFC 8594) headers, so clients can warn their users.
+func sendVersion(c *gin.Context, version *repository.Version, err error) {
+	if sendIfDuplicateName(c, err) || sendIfInvalidVersionName(c, err, http.StatusBadRequest) || sendIfInvalidTransition(c, err) {
+		return
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Version not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error processing version: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to process version request."})
+		return
+	}
+
+	if version.State == repository.VersionStateDeprecated {
+		if version.DeprecatedAt != nil {
+			c.Header("Deprecation", fmt.Sprintf("@%d", version.DeprecatedAt.Unix()))
+		}
+		if version.SunsetAt != nil {
+			c.Header("Sunset", version.SunsetAt.UTC().Format(http.TimeFormat))
+		}
+	}
+
+	resources.SendSuccess(c, http.StatusOK, version, nil)
+}
+
+// Loads the highest stable version of a service, by semantic precedence. Pre-releases are skipped.
+func GetLatestVersion(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	serviceULID, err := ulid.Parse(c.Param("serviceId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The service ID is invalid."})
+		return
+	}
+
+	version, err := repository.GetLatestVersion(orgID.(int), serviceULID.String())
+
+	sendVersion(c, version, err)
 }
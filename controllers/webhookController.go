@@ -0,0 +1,335 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+	"github.com/harshadixit12/service-catalog-api/resources"
+	"github.com/harshadixit12/service-catalog-api/webhooks"
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Lists the webhook subscriptions of the caller's organization
+func GetWebhooks(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	subscriptions, err := repository.GetWebhookSubscriptions(orgID.(int))
+
+	if err != nil {
+		fmt.Printf("Error loading webhooks: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load webhooks."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, subscriptions, nil)
+}
+
+// Subscribes a URL to catalog change events of the caller's organization.
+// The signing secret is only returned here, so the receiver can be configured with it.
+func CreateWebhook(c *gin.Context) {
+	userID, userExists := c.Get("userID")
+	orgID, orgExists := c.Get("organizationID")
+	if !userExists || !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	webhookRequestInstance, ok := bindWebhookRequest(c)
+	if !ok {
+		return
+	}
+
+	secret, err := repository.GenerateWebhookSecret()
+	if err != nil {
+		fmt.Printf("Error generating webhook secret: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to create webhook."})
+		return
+	}
+
+	active := webhookRequestInstance.Active == nil || *webhookRequestInstance.Active
+
+	subscription, err := repository.CreateWebhookSubscription(&repository.WebhookSubscription{
+		OrganizationID: orgID.(int),
+		URL:            webhookRequestInstance.URL,
+		Description:    webhookRequestInstance.Description,
+		Events:         webhookRequestInstance.Events,
+		Secret:         secret,
+		Active:         active,
+		UserID:         userID.(int),
+	})
+
+	if err != nil {
+		fmt.Printf("Error creating webhook: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to create webhook."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusCreated, struct {
+		*repository.WebhookSubscription
+		Secret string
+	}{subscription, secret}, nil)
+}
+
+// Loads a single webhook subscription of the caller's organization
+func GetWebhook(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	webhookULID, ok := parseWebhookParam(c)
+	if !ok {
+		return
+	}
+
+	subscription, err := repository.GetWebhookSubscription(orgID.(int), webhookULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Webhook not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error loading webhook: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load webhook."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, subscription, nil)
+}
+
+// Replaces the URL, description, events and state of a webhook subscription
+func UpdateWebhook(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	webhookULID, ok := parseWebhookParam(c)
+	if !ok {
+		return
+	}
+
+	webhookRequestInstance, ok := bindWebhookRequest(c)
+	if !ok {
+		return
+	}
+
+	active := webhookRequestInstance.Active == nil || *webhookRequestInstance.Active
+
+	subscription, err := repository.UpdateWebhookSubscription(orgID.(int), webhookULID.String(), webhookRequestInstance.URL, webhookRequestInstance.Description, webhookRequestInstance.Events, active)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Webhook not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error updating webhook: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to update webhook."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, subscription, nil)
+}
+
+// Deletes a webhook subscription, along with its delivery history
+func DeleteWebhook(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	webhookULID, ok := parseWebhookParam(c)
+	if !ok {
+		return
+	}
+
+	err := repository.DeleteWebhookSubscription(orgID.(int), webhookULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Webhook not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error deleting webhook: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to delete webhook."})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Lists the deliveries of a webhook subscription, newest first
+func GetWebhookDeliveries(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	webhookULID, ok := parseWebhookParam(c)
+	if !ok {
+		return
+	}
+
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size_limit", "25"))
+	pageNumber, _ := strconv.Atoi(c.DefaultQuery("page_number", "1"))
+
+	if pageNumber < 1 {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid page_number - must be greater than 1."})
+		return
+	}
+
+	if pageSize < 1 || pageSize > 100 {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid page_size_limit - must be greater than 1 and less than 101."})
+		return
+	}
+
+	if _, err := repository.GetWebhookSubscription(orgID.(int), webhookULID.String()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			resources.SendError(c, http.StatusNotFound, gin.H{"message": "Webhook not found."})
+			return
+		}
+		fmt.Printf("Error loading webhook: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load deliveries."})
+		return
+	}
+
+	deliveries, err := repository.GetWebhookDeliveries(orgID.(int), webhookULID.String(), pageSize, pageNumber)
+
+	if err != nil {
+		fmt.Printf("Error loading deliveries: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load deliveries."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, deliveries, gin.H{"PageNumber": pageNumber, "PageSize": len(deliveries), "PageSizeLimit": pageSize})
+}
+
+// Loads a single delivery of a webhook subscription, along with its attempt history
+func GetWebhookDelivery(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	webhookULID, deliveryULID, ok := parseWebhookDeliveryParams(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := repository.GetWebhookDelivery(orgID.(int), webhookULID.String(), deliveryULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Delivery not found."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error loading delivery: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to load delivery."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, delivery, nil)
+}
+
+// Sends a delivery again right away, with a fresh set of retries - for example, once a broken receiver is fixed
+func RedeliverWebhookDelivery(c *gin.Context) {
+	orgID, orgExists := c.Get("organizationID")
+	if !orgExists {
+		resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+		return
+	}
+
+	webhookULID, deliveryULID, ok := parseWebhookDeliveryParams(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := webhooks.Redeliver(orgID.(int), webhookULID.String(), deliveryULID.String())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resources.SendError(c, http.StatusNotFound, gin.H{"message": "Delivery not found."})
+		return
+	}
+
+	if errors.Is(err, repository.ErrWebhookDeliveryInProgress) {
+		resources.SendError(c, http.StatusConflict, gin.H{"message": "The delivery is being sent - try again once it is done."})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error redelivering webhook: %v\n", err)
+		resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to redeliver."})
+		return
+	}
+
+	resources.SendSuccess(c, http.StatusOK, delivery, nil)
+}
+
+// Parses the webhook ID from the path
+func parseWebhookParam(c *gin.Context) (ulid.ULID, bool) {
+	webhookULID, err := ulid.Parse(c.Param("webhookId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The webhook ID is invalid."})
+		return ulid.ULID{}, false
+	}
+	return webhookULID, true
+}
+
+// Parses the webhook and delivery IDs from the path
+func parseWebhookDeliveryParams(c *gin.Context) (ulid.ULID, ulid.ULID, bool) {
+	webhookULID, ok := parseWebhookParam(c)
+	if !ok {
+		return ulid.ULID{}, ulid.ULID{}, false
+	}
+
+	deliveryULID, err := ulid.Parse(c.Param("deliveryId"))
+	if err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "The delivery ID is invalid."})
+		return ulid.ULID{}, ulid.ULID{}, false
+	}
+
+	return webhookULID, deliveryULID, true
+}
+
+// Binds and validates the body of a webhook request. Sends a 400 response if it is invalid, and reports whether it is valid.
+func bindWebhookRequest(c *gin.Context) (*resources.WebhookRequestBody, bool) {
+	var webhookRequestInstance resources.WebhookRequestBody
+
+	if err := c.ShouldBindJSON(&webhookRequestInstance); err != nil {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return nil, false
+	}
+
+	if !repository.IsValidLinkURL(webhookRequestInstance.URL) {
+		resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid url - must be an absolute http or https URL.", "field": "url", "value": webhookRequestInstance.URL})
+		return nil, false
+	}
+
+	for _, event := range webhookRequestInstance.Events {
+		if !repository.IsValidWebhookEvent(event) {
+			resources.SendError(c, http.StatusBadRequest, gin.H{"message": "Invalid events - must be some of [" + strings.Join(repository.WebhookEvents, ", ") + "].", "field": "events", "value": event})
+			return nil, false
+		}
+	}
+
+	return &webhookRequestInstance, true
+}
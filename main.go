@@ -10,23 +10,117 @@ import (
 	"github.com/harshadixit12/service-catalog-api/middleware"
 	"github.com/harshadixit12/service-catalog-api/repository"
 	"github.com/harshadixit12/service-catalog-api/resources"
+	"github.com/harshadixit12/service-catalog-api/webhooks"
 
 	"github.com/gin-gonic/gin"
 )
 
 func setupRouter() *gin.Engine {
 	r := gin.Default()
-	r.Use(middleware.AuthMiddleware())
 
+	// Health check, does not require authentication
 	r.GET("/ping", func(c *gin.Context) {
 		resources.SendSuccess(c, http.StatusOK, gin.H{"message": "pong"}, nil)
 	})
 
-	r.GET("/services", controllers.GetServices)
-	r.POST("/services", controllers.CreateService)
-	r.GET("/services/:serviceId", controllers.GetServiceByID)
-	r.GET("/services/:serviceId/versions", controllers.GetServiceVersions)
-	r.POST("/services/:serviceId/versions", controllers.CreateVersion)
+	// All the catalog routes require an authenticated user
+	api := r.Group("/")
+	api.Use(middleware.AuthMiddleware())
+
+	api.GET("/services", controllers.GetServices)
+	api.POST("/services", middleware.RequireRole(repository.RoleEditor), controllers.CreateService)
+	api.GET("/services/search", controllers.SearchServices)
+	api.GET("/services/:serviceId", controllers.GetServiceByID)
+	api.PUT("/services/:serviceId", middleware.RequireRole(repository.RoleEditor), controllers.UpdateService)
+	api.PATCH("/services/:serviceId", middleware.RequireRole(repository.RoleEditor), controllers.PatchService)
+	api.DELETE("/services/:serviceId", middleware.RequireRole(repository.RoleEditor), controllers.DeleteService)
+	api.POST("/services/:serviceId/restore", middleware.RequireRole(repository.RoleEditor), controllers.RestoreService)
+	api.GET("/services/:serviceId/labels", controllers.GetServiceLabels)
+	api.PUT("/services/:serviceId/labels/*key", middleware.RequireRole(repository.RoleEditor), controllers.SetServiceLabel)
+	api.DELETE("/services/:serviceId/labels/*key", middleware.RequireRole(repository.RoleEditor), controllers.DeleteServiceLabel)
+	api.GET("/services/:serviceId/links", controllers.GetServiceLinks)
+	api.POST("/services/:serviceId/links", middleware.RequireRole(repository.RoleEditor), controllers.CreateServiceLink)
+	api.GET("/services/:serviceId/links/:linkId", controllers.GetServiceLink)
+	api.PUT("/services/:serviceId/links/:linkId", middleware.RequireRole(repository.RoleEditor), controllers.UpdateServiceLink)
+	api.DELETE("/services/:serviceId/links/:linkId", middleware.RequireRole(repository.RoleEditor), controllers.DeleteServiceLink)
+	api.GET("/services/:serviceId/owners", controllers.GetServiceOwners)
+	api.PUT("/services/:serviceId/owners", middleware.RequireRole(repository.RoleEditor), controllers.SetServiceOwners)
+	api.GET("/services/:serviceId/dependencies", controllers.GetServiceDependencies)
+	api.PUT("/services/:serviceId/dependencies/:dependencyId", middleware.RequireRole(repository.RoleEditor), controllers.SetServiceDependency)
+	api.DELETE("/services/:serviceId/dependencies/:dependencyId", middleware.RequireRole(repository.RoleEditor), controllers.DeleteServiceDependency)
+	api.GET("/services/:serviceId/blast-radius", controllers.GetServiceBlastRadius)
+	api.GET("/services/:serviceId/deployments", controllers.GetServiceDeployments)
+	api.POST("/services/:serviceId/deployments", middleware.RequireRole(repository.RoleEditor), controllers.CreateDeployment)
+	api.GET("/services/:serviceId/deployments/current", controllers.GetServiceCurrentDeployments)
+	api.GET("/services/:serviceId/deployments/:deploymentId", controllers.GetDeployment)
+	api.PUT("/services/:serviceId/deployments/:deploymentId/status", middleware.RequireRole(repository.RoleEditor), controllers.FinishDeployment)
+	api.GET("/services/:serviceId/metrics/dora", controllers.GetServiceDORAMetrics)
+	api.GET("/services/:serviceId/promotions", controllers.GetServicePromotions)
+	api.POST("/services/:serviceId/promotions", middleware.RequireRole(repository.RoleEditor), controllers.PromoteVersion)
+	api.GET("/services/:serviceId/versions", controllers.GetServiceVersions)
+	api.POST("/services/:serviceId/versions", middleware.RequireRole(repository.RoleEditor), controllers.CreateVersion)
+	api.GET("/services/:serviceId/versions/by-name/:versionName", controllers.GetVersionByName)
+	api.GET("/services/:serviceId/versions/latest", controllers.GetLatestVersion)
+	api.GET("/services/:serviceId/versions/:versionId", controllers.GetVersion)
+	api.PUT("/services/:serviceId/versions/:versionId", middleware.RequireRole(repository.RoleEditor), controllers.UpdateVersion)
+	api.PATCH("/services/:serviceId/versions/:versionId", middleware.RequireRole(repository.RoleEditor), controllers.PatchVersion)
+	api.DELETE("/services/:serviceId/versions/:versionId", middleware.RequireRole(repository.RoleEditor), controllers.DeleteVersion)
+	api.POST("/services/:serviceId/versions/:versionId/restore", middleware.RequireRole(repository.RoleEditor), controllers.RestoreVersion)
+	api.POST("/services/:serviceId/versions/:versionId/transitions", middleware.RequireRole(repository.RoleEditor), controllers.TransitionVersion)
+	api.GET("/services/:serviceId/versions/:versionId/approvals", controllers.GetVersionApprovals)
+	api.POST("/services/:serviceId/versions/:versionId/approvals", middleware.RequireRole(repository.RoleEditor), controllers.ApproveVersion)
+
+	api.GET("/graph", controllers.GetGraph)
+
+	api.GET("/metrics/dora", controllers.GetOrganizationDORAMetrics)
+
+	api.GET("/environments", controllers.GetEnvironments)
+	api.GET("/environments/:environmentId", controllers.GetEnvironment)
+	api.GET("/environments/:environmentId/deployments", controllers.GetEnvironmentDeployments)
+
+	api.GET("/teams", controllers.GetTeams)
+	api.GET("/teams/:teamId", controllers.GetTeam)
+	api.GET("/teams/:teamId/members", controllers.GetTeamMembers)
+	api.GET("/teams/:teamId/services", controllers.GetTeamServices)
+
+	api.GET("/organization/service-metadata-schema", controllers.GetServiceMetadataSchema)
+
+	// Admin routes
+	admin := api.Group("/", middleware.RequireRole(repository.RoleAdmin))
+
+	admin.GET("/api-keys", controllers.GetAPIKeys)
+	admin.POST("/api-keys", controllers.CreateAPIKey)
+	admin.DELETE("/api-keys/:keyId", controllers.RevokeAPIKey)
+
+	admin.GET("/users", controllers.GetUsers)
+	admin.PUT("/users/:userId/role", controllers.SetUserRole)
+	admin.GET("/services/:serviceId/roles", controllers.GetServiceRoles)
+	admin.PUT("/services/:serviceId/roles/:userId", controllers.SetServiceRole)
+	admin.DELETE("/services/:serviceId/roles/:userId", controllers.DeleteServiceRole)
+
+	admin.POST("/teams", controllers.CreateTeam)
+	admin.PUT("/teams/:teamId/members/:userId", controllers.AddTeamMember)
+	admin.DELETE("/teams/:teamId/members/:userId", controllers.RemoveTeamMember)
+
+	admin.POST("/environments", controllers.CreateEnvironment)
+	admin.PUT("/environments/pipeline", controllers.SetEnvironmentPipeline)
+	admin.PUT("/environments/:environmentId/gates", controllers.SetEnvironmentGates)
+
+	admin.PUT("/organization/service-metadata-schema", controllers.SetServiceMetadataSchema)
+	admin.DELETE("/organization/service-metadata-schema", controllers.DeleteServiceMetadataSchema)
+
+	admin.GET("/webhooks", controllers.GetWebhooks)
+	admin.POST("/webhooks", controllers.CreateWebhook)
+	admin.GET("/webhooks/:webhookId", controllers.GetWebhook)
+	admin.PUT("/webhooks/:webhookId", controllers.UpdateWebhook)
+	admin.DELETE("/webhooks/:webhookId", controllers.DeleteWebhook)
+	admin.GET("/webhooks/:webhookId/deliveries", controllers.GetWebhookDeliveries)
+	admin.GET("/webhooks/:webhookId/deliveries/:deliveryId", controllers.GetWebhookDelivery)
+	admin.POST("/webhooks/:webhookId/deliveries/:deliveryId/redeliver", controllers.RedeliverWebhookDelivery)
+
+	admin.POST("/admin/purge", controllers.PurgeDeleted)
+	admin.GET("/admin/duplicates", controllers.GetDuplicateNames)
+
 	return r
 }
 
@@ -40,6 +134,9 @@ func main() {
 	}
 	fmt.Printf("SQLite database initialized successfully at: %s", utcTime.String())
 
+	// Sends webhook deliveries in the background, checking for retries every 10 seconds
+	webhooks.Start(10 * time.Second)
+
 	router := setupRouter()
 
 	router.Run("localhost:8080")
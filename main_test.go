@@ -2,19 +2,57 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
 	"encoding/json"
+	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/harshadixit12/service-catalog-api/repository"
 	"github.com/harshadixit12/service-catalog-api/resources"
+	"github.com/harshadixit12/service-catalog-api/webhooks"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+const testJWTSecret = "service-catalog-test-secret"
+
+func TestMain(m *testing.M) {
+	// Tests authenticate using HS256 tokens signed with a test secret
+	os.Setenv("AUTH_JWT_HS256_SECRET", testJWTSecret)
+	os.Exit(m.Run())
+}
+
+// Signs an HS256 access token for the given user and organization
+func signTestToken(t *testing.T, userID int, organizationID int) string {
+	claims := jwt.MapClaims{
+		"sub":    strconv.Itoa(userID),
+		"org_id": organizationID,
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatalf("Failed to sign test token: %v", err)
+	}
+
+	return token
+}
+
 func setupTestRepository(t *testing.T) *gorm.DB {
 	// Create an in-memory database
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
@@ -23,7 +61,7 @@ func setupTestRepository(t *testing.T) *gorm.DB {
 	}
 
 	// Migrate the schema (create tables in the in-memory database)
-	err = db.AutoMigrate(&repository.Service{}, &repository.Version{}, &repository.Organization{}, &repository.User{})
+	err = repository.Migrate(db)
 	if err != nil {
 		t.Fatalf("Failed to migrate schema: %v", err)
 	}
@@ -34,7 +72,7 @@ func setupTestRepository(t *testing.T) *gorm.DB {
 		t.Fatalf("Error creating org: %v\n", orgResult.Error)
 	}
 
-	userResult := db.Create(&repository.User{Name: "Poppy Corp.", Email: "user_1@poppycorp.com", OrganizationID: 1})
+	userResult := db.Create(&repository.User{Name: "Poppy Corp.", Email: "user_1@poppycorp.com", OrganizationID: 1, Role: repository.RoleAdmin})
 	if userResult.Error != nil {
 		t.Fatalf("Error creating user: %v\n", userResult.Error)
 	}
@@ -81,6 +119,7 @@ func TestServiceCreation(t *testing.T) {
 
 	requestBody, _ := json.Marshal(serviceRequest)
 	req, _ := http.NewRequest("POST", "/services", bytes.NewBuffer(requestBody))
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, 1, 1))
 	router.ServeHTTP(w, req)
 
 	if w.Code != http.StatusCreated {
@@ -113,7 +152,7 @@ func TestGetServiceByID(t *testing.T) {
 	repository.DBInstance = dbInstance
 	router := setupRouter()
 
-	createdService := repository.Service{Name: "New Test service", Description: "Service used in tests."}
+	createdService := repository.Service{Name: "New Test service", Description: "Service used in tests.", UserID: 1, OrganizationID: 1}
 	result, err := repository.CreateService(&createdService)
 
 	if err != nil {
@@ -123,6 +162,7 @@ func TestGetServiceByID(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	req, _ := http.NewRequest("GET", "/services/"+result.ID, nil)
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, 1, 1))
 	router.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
@@ -154,7 +194,7 @@ func TestCreateServiceVersion(t *testing.T) {
 	repository.DBInstance = dbInstance
 	router := setupRouter()
 
-	createdService := repository.Service{Name: "New Test service", Description: "Service used in tests."}
+	createdService := repository.Service{Name: "New Test service", Description: "Service used in tests.", UserID: 1, OrganizationID: 1}
 	result, err := repository.CreateService(&createdService)
 
 	if err != nil {
@@ -166,6 +206,7 @@ func TestCreateServiceVersion(t *testing.T) {
 	versionRequest := resources.VersionRequestBody{Name: "v1.0.0"}
 	versionRequestBody, _ := json.Marshal(versionRequest)
 	req, _ := http.NewRequest("POST", "/services/"+result.ID+"/versions", bytes.NewBuffer(versionRequestBody))
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, 1, 1))
 	router.ServeHTTP(w, req)
 
 	if w.Code != http.StatusCreated {
@@ -194,8 +235,8 @@ func TestGetServiceList(t *testing.T) {
 	repository.DBInstance = dbInstance
 	router := setupRouter()
 
-	serviceFirst := repository.Service{Name: "New Test service - 1", Description: "Service used in tests."}
-	serviceSecond := repository.Service{Name: "New Test service - 2", Description: "Service used in tests."}
+	serviceFirst := repository.Service{Name: "New Test service - 1", Description: "Service used in tests.", UserID: 1, OrganizationID: 1}
+	serviceSecond := repository.Service{Name: "New Test service - 2", Description: "Service used in tests.", UserID: 1, OrganizationID: 1}
 	_, errFirst := repository.CreateService(&serviceFirst)
 	_, errSecond := repository.CreateService(&serviceSecond)
 
@@ -207,6 +248,7 @@ func TestGetServiceList(t *testing.T) {
 
 	// We will test the pagination by specifying page size as 1
 	req, _ := http.NewRequest("GET", "/services?page_size=1", nil)
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, 1, 1))
 	router.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
@@ -236,7 +278,7 @@ func TestGetServiceVersionsList(t *testing.T) {
 	repository.DBInstance = dbInstance
 	router := setupRouter()
 
-	service := repository.Service{Name: "New Test service - 1", Description: "Service used in tests."}
+	service := repository.Service{Name: "New Test service - 1", Description: "Service used in tests.", UserID: 1, OrganizationID: 1}
 
 	createdService, err := repository.CreateService(&service)
 
@@ -244,8 +286,8 @@ func TestGetServiceVersionsList(t *testing.T) {
 		t.Fatalf(`Failed to create service in DB for test`)
 	}
 
-	version := repository.Version{Name: "v1.0.0", ServiceID: createdService.ID}
-	secondVersion := repository.Version{Name: "v2.0.0", ServiceID: createdService.ID}
+	version := repository.Version{Name: "v1.0.0", ServiceID: createdService.ID, UserID: 1, OrganizationID: 1}
+	secondVersion := repository.Version{Name: "v2.0.0", ServiceID: createdService.ID, UserID: 1, OrganizationID: 1}
 
 	_, err = repository.CreateVersion(&version)
 
@@ -263,6 +305,7 @@ func TestGetServiceVersionsList(t *testing.T) {
 
 	// We will test the pagination by specifying page size as 1
 	req, _ := http.NewRequest("GET", "/services/"+createdService.ID+"/versions?page_size=1", nil)
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, 1, 1))
 	router.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
@@ -286,3 +329,2589 @@ func TestGetServiceVersionsList(t *testing.T) {
 	assert.Contains(t, jsonMeta, "PageNumber", "Response Meta should contain 'PageNumber'")
 	assert.Equal(t, 1, int(jsonMeta["PageNumber"].(float64)))
 }
+
+func TestRequestWithoutTokenIsRejected(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/services", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+}
+
+func TestRequestWithInvalidTokenIsRejected(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	expiredToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "1", "org_id": 1, "exp": time.Now().Add(-time.Hour).Unix(),
+	}).SignedString([]byte(testJWTSecret))
+	wrongSecretToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "1", "org_id": 1, "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("not-the-secret"))
+
+	invalidTokens := map[string]string{
+		"expired":           expiredToken,
+		"wrong secret":      wrongSecretToken,
+		"unknown user":      signTestToken(t, 42, 1),
+		"wrong org":         signTestToken(t, 1, 2),
+		"malformed payload": "not-a-jwt",
+	}
+
+	for name, token := range invalidTokens {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/services", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "Expected %s token to be rejected", name)
+	}
+}
+
+func TestRS256TokenFromJWKSFile(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+
+	keySet, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes()),
+		}},
+	})
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, keySet, 0600); err != nil {
+		t.Fatalf("Failed to write JWKS file: %v", err)
+	}
+	t.Setenv("AUTH_JWKS_FILE", jwksFile)
+
+	router := setupRouter()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub": "1", "org_id": 1, "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = "test-key"
+	signedToken, err := token.SignedString(privateKey)
+	if err != nil {
+		t.Fatalf("Failed to sign RS256 token: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/services", nil)
+	req.Header.Set("Authorization", "Bearer "+signedToken)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// Parses the standard JSON response body
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	var jsonResponse map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &jsonResponse); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return jsonResponse
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	service, err := repository.CreateService(&repository.Service{Name: "Payments", UserID: 1, OrganizationID: 1})
+	if err != nil {
+		t.Fatalf(`Failed to create service in DB for test`)
+	}
+
+	// Mint a key
+	w := httptest.NewRecorder()
+	requestBody, _ := json.Marshal(resources.APIKeyRequestBody{Name: "ci-pipeline"})
+	req, _ := http.NewRequest("POST", "/api-keys", bytes.NewBuffer(requestBody))
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, 1, 1))
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf(`Expected HTTP 201 Created from POST /api-keys, received %d instead`, w.Code)
+	}
+
+	createdKey := decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Contains(t, createdKey, "Key", "Response should contain the API key")
+	assert.NotContains(t, createdKey, "KeyHash", "Response should not contain the key hash")
+	apiKey := createdKey["Key"].(string)
+
+	// Use the key to create a version
+	w = httptest.NewRecorder()
+	versionRequestBody, _ := json.Marshal(resources.VersionRequestBody{Name: "v1.0.0"})
+	req, _ = http.NewRequest("POST", "/services/"+service.ID+"/versions", bytes.NewBuffer(versionRequestBody))
+	req.Header.Set("Authorization", "ApiKey "+apiKey)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// The key is listed
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api-keys", nil)
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, 1, 1))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	listedKeys := decodeResponse(t, w)["data"].([]interface{})
+	assert.Equal(t, 1, len(listedKeys))
+	assert.NotNil(t, listedKeys[0].(map[string]interface{})["LastUsedAt"])
+
+	// Revoke the key, and it can no longer be used
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/api-keys/"+createdKey["ID"].(string), nil)
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, 1, 1))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/services", nil)
+	req.Header.Set("Authorization", "ApiKey "+apiKey)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestExpiredAPIKeyIsRejected(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	key, keyHash, _ := repository.GenerateAPIKey()
+	expiredAt := time.Now().Add(-time.Minute).UTC()
+	_, err := repository.CreateAPIKey(&repository.APIKey{Name: "expired", Prefix: key[:10], KeyHash: keyHash, UserID: 1, OrganizationID: 1, ExpiresAt: &expiredAt})
+	if err != nil {
+		t.Fatalf(`Failed to create API key in DB for test`)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/services", nil)
+	req.Header.Set("Authorization", "ApiKey "+key)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+// Creates another organization with a single user, and returns their IDs
+func createTestTenant(t *testing.T, db *gorm.DB, name string) (int, int) {
+	organization := repository.Organization{Name: name}
+	if err := db.Create(&organization).Error; err != nil {
+		t.Fatalf("Error creating org: %v\n", err)
+	}
+
+	user := repository.User{Name: name, Email: "user@" + name + ".com", OrganizationID: organization.ID, Role: repository.RoleAdmin}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("Error creating user: %v\n", err)
+	}
+
+	return organization.ID, user.ID
+}
+
+func TestTenantIsolation(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	otherOrgID, otherUserID := createTestTenant(t, dbInstance, "acme")
+	otherToken := signTestToken(t, otherUserID, otherOrgID)
+
+	service, err := repository.CreateService(&repository.Service{Name: "Payments", UserID: 1, OrganizationID: 1})
+	if err != nil {
+		t.Fatalf(`Failed to create service in DB for test`)
+	}
+	if _, err := repository.CreateVersion(&repository.Version{Name: "v1.0.0", ServiceID: service.ID, UserID: 1, OrganizationID: 1}); err != nil {
+		t.Fatalf(`Failed to create version in DB for test`)
+	}
+
+	// The other tenant can neither read the service nor its versions
+	for _, path := range []string{"/services/" + service.ID, "/services/" + service.ID + "/versions"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+otherToken)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code, "Expected GET %s to return 404 for another tenant", path)
+	}
+
+	// The other tenant cannot add versions to the service
+	w := httptest.NewRecorder()
+	versionRequestBody, _ := json.Marshal(resources.VersionRequestBody{Name: "v6.6.6"})
+	req, _ := http.NewRequest("POST", "/services/"+service.ID+"/versions", bytes.NewBuffer(versionRequestBody))
+	req.Header.Set("Authorization", "Bearer "+otherToken)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	reloadedService, _ := repository.GetServiceByID(1, service.ID)
+	assert.Equal(t, 1, reloadedService.VersionCount)
+
+	// Services list only contains services of the caller's organization
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/services", nil)
+	req.Header.Set("Authorization", "Bearer "+otherToken)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 0, len(decodeResponse(t, w)["data"].([]interface{})))
+}
+
+func TestCreatedServiceBelongsToCaller(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	otherOrgID, otherUserID := createTestTenant(t, dbInstance, "acme")
+
+	w := httptest.NewRecorder()
+	requestBody, _ := json.Marshal(resources.ServiceRequestBody{Name: "Orders"})
+	req, _ := http.NewRequest("POST", "/services", bytes.NewBuffer(requestBody))
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, otherUserID, otherOrgID))
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf(`Expected HTTP 201 Created from POST /services, received %d instead`, w.Code)
+	}
+
+	receivedService := decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Equal(t, otherOrgID, int(receivedService["OrganizationID"].(float64)))
+	assert.Equal(t, otherUserID, int(receivedService["UserID"].(float64)))
+
+	_, err := repository.GetServiceByID(1, receivedService["ID"].(string))
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestViewerCannotWriteToCatalog(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	viewer := repository.User{Name: "Viewer", Email: "viewer@poppycorp.com", OrganizationID: 1, Role: repository.RoleViewer}
+	if err := dbInstance.Create(&viewer).Error; err != nil {
+		t.Fatalf("Error creating user: %v\n", err)
+	}
+	viewerToken := signTestToken(t, viewer.ID, 1)
+
+	service, err := repository.CreateService(&repository.Service{Name: "Payments", UserID: 1, OrganizationID: 1})
+	if err != nil {
+		t.Fatalf(`Failed to create service in DB for test`)
+	}
+
+	w := httptest.NewRecorder()
+	serviceRequestBody, _ := json.Marshal(resources.ServiceRequestBody{Name: "Orders"})
+	req, _ := http.NewRequest("POST", "/services", bytes.NewBuffer(serviceRequestBody))
+	req.Header.Set("Authorization", "Bearer "+viewerToken)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	versionRequestBody, _ := json.Marshal(resources.VersionRequestBody{Name: "v1.0.0"})
+	req, _ = http.NewRequest("POST", "/services/"+service.ID+"/versions", bytes.NewBuffer(versionRequestBody))
+	req.Header.Set("Authorization", "Bearer "+viewerToken)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Viewers can still read
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/services/"+service.ID, nil)
+	req.Header.Set("Authorization", "Bearer "+viewerToken)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// And cannot manage roles
+	w = httptest.NewRecorder()
+	roleRequestBody, _ := json.Marshal(resources.RoleRequestBody{Role: repository.RoleAdmin})
+	req, _ = http.NewRequest("PUT", "/users/"+strconv.Itoa(viewer.ID)+"/role", bytes.NewBuffer(roleRequestBody))
+	req.Header.Set("Authorization", "Bearer "+viewerToken)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAdminManagesRoleAssignments(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	viewer := repository.User{Name: "Viewer", Email: "viewer@poppycorp.com", OrganizationID: 1}
+	if err := dbInstance.Create(&viewer).Error; err != nil {
+		t.Fatalf("Error creating user: %v\n", err)
+	}
+	assert.Equal(t, repository.RoleViewer, viewer.Role, "Users should be viewers by default")
+	viewerToken := signTestToken(t, viewer.ID, 1)
+
+	ownedService, _ := repository.CreateService(&repository.Service{Name: "Payments", UserID: 1, OrganizationID: 1})
+	otherService, _ := repository.CreateService(&repository.Service{Name: "Orders", UserID: 1, OrganizationID: 1})
+
+	// Make the viewer an editor of a single service
+	w := httptest.NewRecorder()
+	roleRequestBody, _ := json.Marshal(resources.RoleRequestBody{Role: repository.RoleEditor})
+	req, _ := http.NewRequest("PUT", "/services/"+ownedService.ID+"/roles/"+strconv.Itoa(viewer.ID), bytes.NewBuffer(roleRequestBody))
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, 1, 1))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	versionRequestBody, _ := json.Marshal(resources.VersionRequestBody{Name: "v1.0.0"})
+	expectedCodes := map[string]int{ownedService.ID: http.StatusCreated, otherService.ID: http.StatusForbidden}
+	for serviceID, expectedCode := range expectedCodes {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", "/services/"+serviceID+"/versions", bytes.NewBuffer(versionRequestBody))
+		req.Header.Set("Authorization", "Bearer "+viewerToken)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, expectedCode, w.Code)
+	}
+
+	// Removing the override takes the permission away again
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/services/"+ownedService.ID+"/roles/"+strconv.Itoa(viewer.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, 1, 1))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// Promote the viewer to an organization wide editor
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/users/"+strconv.Itoa(viewer.ID)+"/role", bytes.NewBuffer(roleRequestBody))
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, 1, 1))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/services/"+otherService.ID+"/versions", bytes.NewBuffer(versionRequestBody))
+	req.Header.Set("Authorization", "Bearer "+viewerToken)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Invalid roles are rejected
+	w = httptest.NewRecorder()
+	invalidRoleRequestBody, _ := json.Marshal(resources.RoleRequestBody{Role: "owner"})
+	req, _ = http.NewRequest("PUT", "/users/"+strconv.Itoa(viewer.ID)+"/role", bytes.NewBuffer(invalidRoleRequestBody))
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, 1, 1))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The only admin can't stop being an admin, until there is another admin
+	assert.Equal(t, http.StatusConflict, sendRequest(t, router, "PUT", "/users/1/role", `{"role": "editor"}`, 1).Code)
+	admin, _ := repository.GetUserByID(1)
+	assert.Equal(t, repository.RoleAdmin, admin.Role)
+
+	assert.Equal(t, http.StatusOK, sendRequest(t, router, "PUT", "/users/"+strconv.Itoa(viewer.ID)+"/role", `{"role": "admin"}`, 1).Code)
+	assert.Equal(t, http.StatusOK, sendRequest(t, router, "PUT", "/users/1/role", `{"role": "editor"}`, 1).Code)
+	assert.Equal(t, http.StatusConflict, sendRequest(t, router, "PUT", "/users/"+strconv.Itoa(viewer.ID)+"/role", `{"role": "viewer"}`, viewer.ID).Code)
+}
+
+func TestUpdateService(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	service, err := repository.CreateService(&repository.Service{Name: "Payments", Description: "Old description", UserID: 1, OrganizationID: 1})
+	if err != nil {
+		t.Fatalf(`Failed to create service in DB for test`)
+	}
+	lastUpdatedAt := time.Now().Add(-time.Hour).UTC()
+	dbInstance.Model(service).UpdateColumn("updated_at", lastUpdatedAt)
+
+	w := httptest.NewRecorder()
+	requestBody, _ := json.Marshal(resources.ServiceRequestBody{Name: "Payments gateway"})
+	req, _ := http.NewRequest("PUT", "/services/"+service.ID, bytes.NewBuffer(requestBody))
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, 1, 1))
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf(`Expected HTTP 200 OK from PUT /services/:id, received %d instead`, w.Code)
+	}
+
+	receivedService := decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Equal(t, "Payments gateway", receivedService["Name"])
+	assert.Equal(t, "", receivedService["Description"], "PUT should replace the description as well")
+
+	updatedService, _ := repository.GetServiceByID(1, service.ID)
+	assert.True(t, updatedService.UpdatedAt.After(lastUpdatedAt), "UpdatedAt should be bumped")
+	assert.Equal(t, "Payments gateway", updatedService.Name)
+
+	// Same validation rules as creating a service
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/services/"+service.ID, bytes.NewBufferString(`{"name": ""}`))
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, 1, 1))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The versioning scheme is kept when it is left out
+	w = sendRequest(t, router, "PUT", "/services/"+service.ID, `{"name": "Payments gateway", "versioning_scheme": "semver"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = sendRequest(t, router, "PUT", "/services/"+service.ID, `{"name": "Payments gateway", "description": "Handles card payments"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, repository.VersioningSchemeSemver, decodeResponse(t, w)["data"].(map[string]interface{})["VersioningScheme"])
+
+	updatedService, _ = repository.GetServiceByID(1, service.ID)
+	assert.Equal(t, repository.VersioningSchemeSemver, updatedService.VersioningScheme)
+}
+
+func TestPatchService(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	service, err := repository.CreateService(&repository.Service{Name: "Payments", Description: "Old description", UserID: 1, OrganizationID: 1})
+	if err != nil {
+		t.Fatalf(`Failed to create service in DB for test`)
+	}
+
+	patchCases := []struct {
+		name                string
+		contentType         string
+		patch               string
+		expectedCode        int
+		expectedName        string
+		expectedDescription string
+	}{
+		{"merge patch", resources.MergePatchMediaType, `{"description": "Handles card payments"}`, http.StatusOK, "Payments", "Handles card payments"},
+		{"merge patch removing a field", resources.MergePatchMediaType, `{"description": null}`, http.StatusOK, "Payments", ""},
+		{"json patch", resources.JSONPatchMediaType, `[{"op": "replace", "path": "/name", "value": "payments-gateway"}]`, http.StatusOK, "payments-gateway", ""},
+		{"json patch with failing test", resources.JSONPatchMediaType, `[{"op": "test", "path": "/name", "value": "orders"}]`, http.StatusUnprocessableEntity, "payments-gateway", ""},
+		{"invalid name", resources.MergePatchMediaType, `{"name": ""}`, http.StatusBadRequest, "payments-gateway", ""},
+		{"unknown field", resources.JSONPatchMediaType, `[{"op": "add", "path": "/version_count", "value": 10}]`, http.StatusBadRequest, "payments-gateway", ""},
+		{"malformed patch", resources.JSONPatchMediaType, `{"op": "replace"}`, http.StatusBadRequest, "payments-gateway", ""},
+		{"unsupported content type", "application/json", `{"name": "orders"}`, http.StatusUnsupportedMediaType, "payments-gateway", ""},
+	}
+
+	for _, patchCase := range patchCases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PATCH", "/services/"+service.ID, bytes.NewBufferString(patchCase.patch))
+		req.Header.Set("Authorization", "Bearer "+signTestToken(t, 1, 1))
+		req.Header.Set("Content-Type", patchCase.contentType)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, patchCase.expectedCode, w.Code, patchCase.name)
+
+		updatedService, _ := repository.GetServiceByID(1, service.ID)
+		assert.Equal(t, patchCase.expectedName, updatedService.Name, patchCase.name)
+		assert.Equal(t, patchCase.expectedDescription, updatedService.Description, patchCase.name)
+	}
+
+	// Services of other organizations cannot be patched
+	otherOrgID, otherUserID := createTestTenant(t, dbInstance, "acme")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/services/"+service.ID, bytes.NewBufferString(`{"name": "hijacked"}`))
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, otherUserID, otherOrgID))
+	req.Header.Set("Content-Type", resources.MergePatchMediaType)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// Sends a request with a JSON body (if not empty) as the given user of the default organization
+func sendRequest(t *testing.T, router http.Handler, method string, path string, body string, userID int) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, userID, 1))
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestDeleteAndRestoreVersion(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	service, _ := repository.CreateService(&repository.Service{Name: "Payments", UserID: 1, OrganizationID: 1})
+	version, _ := repository.CreateVersion(&repository.Version{Name: "v1.0.0", ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+	repository.CreateVersion(&repository.Version{Name: "v2.0.0", ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+
+	w := sendRequest(t, router, "DELETE", "/services/"+service.ID+"/versions/"+version.ID, "", 1)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	reloadedService, _ := repository.GetServiceByID(1, service.ID)
+	assert.Equal(t, 1, reloadedService.VersionCount)
+
+	w = sendRequest(t, router, "GET", "/services/"+service.ID+"/versions", "", 1)
+	listedVersions := decodeResponse(t, w)["data"].([]interface{})
+	assert.Equal(t, 1, len(listedVersions))
+	assert.Equal(t, "v2.0.0", listedVersions[0].(map[string]interface{})["Name"])
+
+	// Deleting again is a 404
+	w = sendRequest(t, router, "DELETE", "/services/"+service.ID+"/versions/"+version.ID, "", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = sendRequest(t, router, "POST", "/services/"+service.ID+"/versions/"+version.ID+"/restore", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	reloadedService, _ = repository.GetServiceByID(1, service.ID)
+	assert.Equal(t, 2, reloadedService.VersionCount)
+}
+
+func TestDeleteAndRestoreService(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	service, _ := repository.CreateService(&repository.Service{Name: "Payments", UserID: 1, OrganizationID: 1})
+	deletedEarlier, _ := repository.CreateVersion(&repository.Version{Name: "v1.0.0", ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+	repository.CreateVersion(&repository.Version{Name: "v2.0.0", ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+	repository.DeleteVersion(1, service.ID, deletedEarlier.ID)
+
+	w := sendRequest(t, router, "DELETE", "/services/"+service.ID, "", 1)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = sendRequest(t, router, "GET", "/services/"+service.ID, "", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var activeVersions int64
+	dbInstance.Model(&repository.Version{}).Where("service_id = ? AND deleted_at IS NULL", service.ID).Count(&activeVersions)
+	assert.Equal(t, int64(0), activeVersions, "Versions should be deleted along with the service")
+
+	w = sendRequest(t, router, "POST", "/services/"+service.ID+"/restore", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Only the versions deleted along with the service are restored
+	w = sendRequest(t, router, "GET", "/services/"+service.ID+"/versions", "", 1)
+	listedVersions := decodeResponse(t, w)["data"].([]interface{})
+	assert.Equal(t, 1, len(listedVersions))
+	assert.Equal(t, "v2.0.0", listedVersions[0].(map[string]interface{})["Name"])
+
+	reloadedService, _ := repository.GetServiceByID(1, service.ID)
+	assert.Equal(t, 1, reloadedService.VersionCount)
+}
+
+func TestPurgeDeletedRows(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+	t.Setenv("PURGE_RETENTION_DAYS", "7")
+
+	editor := repository.User{Name: "Editor", Email: "editor@poppycorp.com", OrganizationID: 1, Role: repository.RoleEditor}
+	dbInstance.Create(&editor)
+
+	oldService, _ := repository.CreateService(&repository.Service{Name: "Legacy", UserID: 1, OrganizationID: 1})
+	repository.CreateVersion(&repository.Version{Name: "v1.0.0", ServiceID: oldService.ID, UserID: 1, OrganizationID: 1})
+	recentService, _ := repository.CreateService(&repository.Service{Name: "Payments", UserID: 1, OrganizationID: 1})
+	repository.DeleteService(1, oldService.ID)
+	repository.DeleteService(1, recentService.ID)
+
+	eightDaysAgo := time.Now().UTC().AddDate(0, 0, -8)
+	dbInstance.Model(&repository.Service{}).Where("id = ?", oldService.ID).Update("deleted_at", eightDaysAgo)
+	dbInstance.Model(&repository.Version{}).Where("service_id = ?", oldService.ID).Update("deleted_at", eightDaysAgo)
+
+	w := sendRequest(t, router, "POST", "/admin/purge", "", editor.ID)
+	assert.Equal(t, http.StatusForbidden, w.Code, "Only admins can purge")
+
+	w = sendRequest(t, router, "POST", "/admin/purge", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	purgeResult := decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Equal(t, 1, int(purgeResult["PurgedServices"].(float64)))
+	assert.Equal(t, 1, int(purgeResult["PurgedVersions"].(float64)))
+
+	var remainingServices int64
+	dbInstance.Model(&repository.Service{}).Count(&remainingServices)
+	assert.Equal(t, int64(1), remainingServices, "Recently deleted service should be kept")
+
+	w = sendRequest(t, router, "POST", "/services/"+recentService.ID+"/restore", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestGetAndUpdateSingleVersion(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	service, _ := repository.CreateService(&repository.Service{Name: "Payments", UserID: 1, OrganizationID: 1})
+	version, err := repository.CreateVersion(&repository.Version{Name: "v1.2.0", ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+	if err != nil {
+		t.Fatalf(`Failed to create version in DB for test`)
+	}
+
+	w := sendRequest(t, router, "GET", "/services/"+service.ID+"/versions/"+version.ID, "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "v1.2.0", decodeResponse(t, w)["data"].(map[string]interface{})["Name"])
+
+	w = sendRequest(t, router, "GET", "/services/"+service.ID+"/versions/by-name/v1.2.0", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, version.ID, decodeResponse(t, w)["data"].(map[string]interface{})["ID"])
+
+	w = sendRequest(t, router, "PUT", "/services/"+service.ID+"/versions/"+version.ID, `{"name": "v1.2.1", "metadata": {"commit": "abc123"}}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	updatedVersion := decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Equal(t, "v1.2.1", updatedVersion["Name"])
+	assert.Equal(t, "abc123", updatedVersion["Metadata"].(map[string]interface{})["commit"])
+
+	// Merge patch keeps the name, and adds to the metadata
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/services/"+service.ID+"/versions/"+version.ID, bytes.NewBufferString(`{"metadata": {"build": 42}}`))
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, 1, 1))
+	req.Header.Set("Content-Type", resources.MergePatchMediaType)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	reloadedVersion, _ := repository.GetVersionByID(1, service.ID, version.ID)
+	assert.Equal(t, "v1.2.1", reloadedVersion.Name)
+	assert.Equal(t, repository.JSONMap{"commit": "abc123", "build": float64(42)}, reloadedVersion.Metadata)
+
+	w = sendRequest(t, router, "GET", "/services/"+service.ID+"/versions/by-name/v1.2.0", "", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code, "Version should not be found by its old name")
+
+	// Soft deleted versions are not found
+	repository.DeleteVersion(1, service.ID, version.ID)
+
+	w = sendRequest(t, router, "GET", "/services/"+service.ID+"/versions/"+version.ID, "", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = sendRequest(t, router, "GET", "/services/"+service.ID+"/versions/by-name/v1.2.1", "", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = sendRequest(t, router, "PUT", "/services/"+service.ID+"/versions/"+version.ID, `{"name": "v1.2.2"}`, 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDuplicateServiceNamesAreRejected(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	existing, _ := repository.CreateService(&repository.Service{Name: "payments", UserID: 1, OrganizationID: 1})
+	other, _ := repository.CreateService(&repository.Service{Name: "orders", UserID: 1, OrganizationID: 1})
+
+	w := sendRequest(t, router, "POST", "/services", `{"name": "payments"}`, 1)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	conflict := decodeResponse(t, w)["error"].(map[string]interface{})
+	assert.Equal(t, "name", conflict["field"])
+	assert.Equal(t, "payments", conflict["value"])
+	assert.Equal(t, existing.ID, conflict["existing_id"])
+
+	w = sendRequest(t, router, "PUT", "/services/"+other.ID, `{"name": "payments"}`, 1)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Other organizations can use the same name
+	otherOrgID, otherUserID := createTestTenant(t, dbInstance, "acme")
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/services", bytes.NewBufferString(`{"name": "payments"}`))
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, otherUserID, otherOrgID))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Soft deleted services do not hold on to their name
+	repository.DeleteService(1, existing.ID)
+	w = sendRequest(t, router, "POST", "/services", `{"name": "payments"}`, 1)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = sendRequest(t, router, "POST", "/services/"+existing.ID+"/restore", "", 1)
+	assert.Equal(t, http.StatusConflict, w.Code, "Restoring should not create a duplicate")
+
+	// The unique index rejects duplicates which bypass the application checks
+	err := dbInstance.Create(&repository.Service{Name: "orders", UserID: 1, OrganizationID: 1}).Error
+	assert.ErrorContains(t, err, "UNIQUE constraint failed")
+}
+
+func TestDuplicateVersionNamesAreRejected(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	service, _ := repository.CreateService(&repository.Service{Name: "payments", UserID: 1, OrganizationID: 1})
+	otherService, _ := repository.CreateService(&repository.Service{Name: "orders", UserID: 1, OrganizationID: 1})
+	repository.CreateVersion(&repository.Version{Name: "v1.0.0", ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+	second, _ := repository.CreateVersion(&repository.Version{Name: "v1.1.0", ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+
+	w := sendRequest(t, router, "POST", "/services/"+service.ID+"/versions", `{"name": "v1.0.0"}`, 1)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, decodeResponse(t, w)["error"].(map[string]interface{})["message"], `"v1.0.0"`)
+
+	w = sendRequest(t, router, "PUT", "/services/"+service.ID+"/versions/"+second.ID, `{"name": "v1.0.0"}`, 1)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	reloadedService, _ := repository.GetServiceByID(1, service.ID)
+	assert.Equal(t, 2, reloadedService.VersionCount, "Rejected versions should not be counted")
+
+	// Other services can use the same version name
+	w = sendRequest(t, router, "POST", "/services/"+otherService.ID+"/versions", `{"name": "v1.0.0"}`, 1)
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestMigrationReportsExistingDuplicates(t *testing.T) {
+	// A database created before names were unique
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to in-memory SQLite database: %v", err)
+	}
+	db.AutoMigrate(&repository.Service{}, &repository.Version{}, &repository.Organization{}, &repository.User{})
+	db.Create(&repository.Organization{Name: "Poppy Corp."})
+	db.Create(&repository.User{Name: "Poppy Corp.", Email: "user_1@poppycorp.com", OrganizationID: 1})
+
+	first := repository.Service{Name: "payments", UserID: 1, OrganizationID: 1}
+	second := repository.Service{Name: "payments", UserID: 1, OrganizationID: 1}
+	db.Create(&first)
+	db.Create(&second)
+
+	// Migrating reports the duplicates instead of failing, and skips the index
+	if err := repository.Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate schema: %v", err)
+	}
+	db.Model(&repository.User{}).Where("id = 1").Update("role", repository.RoleAdmin)
+
+	var indexCount int64
+	db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'idx_services_organization_name_active'").Scan(&indexCount)
+	assert.Equal(t, int64(0), indexCount)
+
+	repository.DBInstance = db
+	router := setupRouter()
+
+	w := sendRequest(t, router, "GET", "/admin/duplicates", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	duplicates := decodeResponse(t, w)["data"].([]interface{})
+	assert.Equal(t, 1, len(duplicates))
+	duplicate := duplicates[0].(map[string]interface{})
+	assert.Equal(t, "services", duplicate["Table"])
+	assert.Equal(t, "payments", duplicate["Name"])
+	assert.Equal(t, 2, int(duplicate["Count"].(float64)))
+
+	// New duplicates are still rejected without the index
+	w = sendRequest(t, router, "POST", "/services", `{"name": "payments"}`, 1)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Once the duplicates are resolved, the index is created on the next migration
+	repository.DeleteService(1, second.ID)
+	if err := repository.Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate schema: %v", err)
+	}
+
+	db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'idx_services_organization_name_active'").Scan(&indexCount)
+	assert.Equal(t, int64(1), indexCount)
+}
+
+func TestMigrationMakesUsersBeforeRolesAdmins(t *testing.T) {
+	// A database created before users had roles
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to in-memory SQLite database: %v", err)
+	}
+	db.AutoMigrate(&repository.Organization{})
+	db.Exec("CREATE TABLE users (id integer PRIMARY KEY AUTOINCREMENT, name text, email text, organization_id integer, created_at datetime, updated_at datetime)")
+	db.Create(&repository.Organization{Name: "Poppy Corp."})
+	db.Exec("INSERT INTO users (name, email, organization_id) VALUES ('Writer', 'writer@poppycorp.com', 1)")
+
+	if err := repository.Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate schema: %v", err)
+	}
+
+	var user repository.User
+	db.First(&user, 1)
+	assert.Equal(t, repository.RoleAdmin, user.Role)
+
+	// Users added afterwards get the default role, and are left alone by later migrations
+	db.Create(&repository.User{Name: "Reader", Email: "reader@poppycorp.com", OrganizationID: 1})
+	if err := repository.Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate schema: %v", err)
+	}
+
+	var reader repository.User
+	db.Where("email = ?", "reader@poppycorp.com").First(&reader)
+	assert.Equal(t, repository.RoleViewer, reader.Role)
+
+	repository.DBInstance = db
+	router := setupRouter()
+
+	w := sendRequest(t, router, "POST", "/services", `{"name": "payments"}`, 1)
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestSemverVersionsAreOrderedByPrecedence(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	w := sendRequest(t, router, "POST", "/services", `{"name": "payments", "versioning_scheme": "semver"}`, 1)
+	if w.Code != http.StatusCreated {
+		t.Fatalf(`Expected HTTP 201 Created from POST /services, received %d instead`, w.Code)
+	}
+	serviceID := decodeResponse(t, w)["data"].(map[string]interface{})["ID"].(string)
+
+	// Precedence example from https://semver.org/#spec-item-11, plus build metadata and multi digit numbers
+	expectedOrder := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.9.0", "v1.10.0", "2.0.0+build.5", "3.0.0-rc.1"}
+	for _, i := range []int{7, 11, 2, 9, 0, 5, 10, 3, 8, 1, 6, 4} {
+		w = sendRequest(t, router, "POST", "/services/"+serviceID+"/versions", `{"name": "`+expectedOrder[i]+`"}`, 1)
+		assert.Equal(t, http.StatusCreated, w.Code, expectedOrder[i])
+	}
+
+	w = sendRequest(t, router, "GET", "/services/"+serviceID+"/versions?sort_field=semver&sort_order=asc", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	listedNames := []string{}
+	for _, version := range decodeResponse(t, w)["data"].([]interface{}) {
+		listedNames = append(listedNames, version.(map[string]interface{})["Name"].(string))
+	}
+	assert.Equal(t, expectedOrder, listedNames)
+
+	// Latest skips pre-releases
+	w = sendRequest(t, router, "GET", "/services/"+serviceID+"/versions/latest", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2.0.0+build.5", decodeResponse(t, w)["data"].(map[string]interface{})["Name"])
+
+	// Names which are not semantic versions are rejected
+	for _, name := range []string{"release-1", "1.0", "01.0.0", "1.0.0-", "1.0.0-alpha..1", "1.0.0-01", "1.0.0+"} {
+		w = sendRequest(t, router, "POST", "/services/"+serviceID+"/versions", `{"name": "`+name+`"}`, 1)
+		assert.Equal(t, http.StatusBadRequest, w.Code, name)
+	}
+}
+
+func TestSwitchingServiceToSemverMode(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	service, _ := repository.CreateService(&repository.Service{Name: "payments", UserID: 1, OrganizationID: 1})
+	assert.Equal(t, repository.VersioningSchemeFree, service.VersioningScheme)
+
+	repository.CreateVersion(&repository.Version{Name: "1.0.0", ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+	legacy, err := repository.CreateVersion(&repository.Version{Name: "legacy-build", ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+	if err != nil {
+		t.Fatalf(`Failed to create version in DB for test`)
+	}
+
+	// Free text names are allowed in free mode, and are skipped when looking for the latest version
+	w := sendRequest(t, router, "GET", "/services/"+service.ID+"/versions/latest", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1.0.0", decodeResponse(t, w)["data"].(map[string]interface{})["Name"])
+
+	w = sendRequest(t, router, "PUT", "/services/"+service.ID, `{"name": "payments", "versioning_scheme": "semver"}`, 1)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, []interface{}{"legacy-build"}, decodeResponse(t, w)["error"].(map[string]interface{})["invalid_names"])
+
+	repository.DeleteVersion(1, service.ID, legacy.ID)
+
+	w = sendRequest(t, router, "PUT", "/services/"+service.ID, `{"name": "payments", "versioning_scheme": "semver"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = sendRequest(t, router, "PUT", "/services/"+service.ID, `{"name": "payments", "versioning_scheme": "calver"}`, 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The deleted version cannot come back while the service is in semver mode
+	w = sendRequest(t, router, "POST", "/services/"+service.ID+"/versions/"+legacy.ID+"/restore", "", 1)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestVersionLifecycleTransitions(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	service, _ := repository.CreateService(&repository.Service{Name: "payments", UserID: 1, OrganizationID: 1})
+	version, err := repository.CreateVersion(&repository.Version{Name: "1.0.0", ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+	if err != nil {
+		t.Fatalf(`Failed to create version in DB for test`)
+	}
+	assert.Equal(t, repository.VersionStateActive, version.State)
+
+	path := "/services/" + service.ID + "/versions/" + version.ID
+
+	// Active versions don't come with lifecycle headers
+	w := sendRequest(t, router, "GET", path, "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Deprecation"))
+
+	w = sendRequest(t, router, "POST", path+"/transitions", `{"state": "deprecated", "deprecated_at": "2026-01-01T00:00:00Z", "sunset_at": "2025-06-01T00:00:00Z"}`, 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = sendRequest(t, router, "POST", path+"/transitions", `{"state": "deprecated", "deprecated_at": "2026-01-01T00:00:00Z", "sunset_at": "2026-06-01T00:00:00Z"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "deprecated", decodeResponse(t, w)["data"].(map[string]interface{})["State"])
+
+	w = sendRequest(t, router, "GET", path, "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "@1767225600", w.Header().Get("Deprecation"))
+	assert.Equal(t, "Mon, 01 Jun 2026 00:00:00 GMT", w.Header().Get("Sunset"))
+
+	w = sendRequest(t, router, "GET", "/services/"+service.ID+"/versions/by-name/1.0.0", "", 1)
+	assert.Equal(t, "@1767225600", w.Header().Get("Deprecation"))
+
+	// Dates can only be set when deprecating
+	w = sendRequest(t, router, "POST", path+"/transitions", `{"state": "retired", "sunset_at": "2026-06-01T00:00:00Z"}`, 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = sendRequest(t, router, "POST", path+"/transitions", `{"state": "archived"}`, 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = sendRequest(t, router, "POST", path+"/transitions", `{"state": "retired"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Retired versions stay retired
+	w = sendRequest(t, router, "POST", path+"/transitions", `{"state": "active"}`, 1)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "retired", decodeResponse(t, w)["error"].(map[string]interface{})["current_state"])
+}
+
+func TestFilterVersionsByState(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	service, _ := repository.CreateService(&repository.Service{Name: "payments", UserID: 1, OrganizationID: 1, VersioningScheme: repository.VersioningSchemeSemver})
+
+	versions := map[string]string{}
+	for _, name := range []string{"1.0.0", "1.1.0", "1.2.0", "2.0.0"} {
+		version, err := repository.CreateVersion(&repository.Version{Name: name, ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+		if err != nil {
+			t.Fatalf(`Failed to create version in DB for test`)
+		}
+		versions[name] = version.ID
+	}
+
+	repository.TransitionVersion(1, service.ID, versions["1.0.0"], repository.VersionStateDeprecated, nil, nil)
+	repository.TransitionVersion(1, service.ID, versions["1.1.0"], repository.VersionStateRetired, nil, nil)
+	repository.TransitionVersion(1, service.ID, versions["2.0.0"], repository.VersionStateYanked, nil, nil)
+
+	names := func(w *httptest.ResponseRecorder) []string {
+		var result []string
+		for _, version := range decodeResponse(t, w)["data"].([]interface{}) {
+			result = append(result, version.(map[string]interface{})["Name"].(string))
+		}
+		return result
+	}
+
+	w := sendRequest(t, router, "GET", "/services/"+service.ID+"/versions?state=active,deprecated&sort_field=semver", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"1.0.0", "1.2.0"}, names(w))
+
+	w = sendRequest(t, router, "GET", "/services/"+service.ID+"/versions?state=unknown", "", 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Yanked and retired versions are never the latest version
+	w = sendRequest(t, router, "GET", "/services/"+service.ID+"/versions/latest", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1.2.0", decodeResponse(t, w)["data"].(map[string]interface{})["Name"])
+}
+
+func TestSearchServices(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	otherOrgID, _ := createTestTenant(t, dbInstance, "Other Corp.")
+
+	gateway, _ := repository.CreateService(&repository.Service{Name: "payments-gateway", Description: "Charges cards", UserID: 1, OrganizationID: 1})
+	billing, _ := repository.CreateService(&repository.Service{Name: "billing", Description: "Creates invoices, and sends them to the payments gateway", UserID: 1, OrganizationID: 1})
+	payouts, _ := repository.CreateService(&repository.Service{Name: "payouts", Description: "Pays merchants", UserID: 1, OrganizationID: 1})
+	repository.CreateService(&repository.Service{Name: "notifications", Description: "Sends emails", UserID: 1, OrganizationID: 1})
+	repository.CreateService(&repository.Service{Name: "payments-ledger", UserID: 1, OrganizationID: otherOrgID})
+	repository.DeleteService(1, payouts.ID)
+
+	search := func(query string) []map[string]interface{} {
+		w := sendRequest(t, router, "GET", "/services/search?q="+query, "", 1)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var results []map[string]interface{}
+		for _, result := range decodeResponse(t, w)["data"].([]interface{}) {
+			results = append(results, result.(map[string]interface{}))
+		}
+		return results
+	}
+
+	// Prefix matches, with name matches ranked above description matches. Deleted services and other organizations are left out.
+	results := search("pay")
+	assert.Len(t, results, 2)
+	assert.Equal(t, gateway.ID, results[0]["ID"])
+	assert.Equal(t, billing.ID, results[1]["ID"])
+	assert.Contains(t, results[0]["NameHighlight"], "<mark>")
+	assert.Contains(t, results[1]["DescriptionSnippet"], "<mark>")
+	assert.Greater(t, results[0]["Score"], results[1]["Score"])
+
+	// All terms must match
+	results = search("pay+invoice")
+	assert.Len(t, results, 1)
+	assert.Equal(t, billing.ID, results[0]["ID"])
+
+	// Terms only match the start of words, and the whole matched words are highlighted
+	assert.Len(t, search("ments"), 0)
+	results = search("pay")
+	assert.Equal(t, "<mark>payments</mark>-gateway", results[0]["NameHighlight"])
+
+	// Long descriptions are cut down to the words around the match
+	repository.CreateService(&repository.Service{Name: "ledger", Description: "Keeps the books of every account, and records each movement of money between them, so balances can be audited at any time and reconciled with the bank statements", UserID: 1, OrganizationID: 1})
+	results = search("reconciled")
+	assert.Len(t, results, 1)
+	assert.Contains(t, results[0]["DescriptionSnippet"], "<mark>reconciled</mark>")
+	assert.True(t, strings.HasPrefix(results[0]["DescriptionSnippet"].(string), "…"))
+	assert.NotContains(t, results[0]["DescriptionSnippet"], "Keeps the books")
+
+	// The index follows updates to the services table
+	repository.UpdateService(1, billing.ID, "invoicing", "Creates invoices", repository.VersioningSchemeFree, nil)
+	assert.Len(t, search("pay"), 1)
+	assert.Len(t, search("invoicing"), 1)
+
+	w := sendRequest(t, router, "GET", "/services/search?q=pay&page_size_limit=1&page_number=2", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, decodeResponse(t, w)["data"], 0)
+
+	w = sendRequest(t, router, "GET", "/services/search", "", 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestFilterServicesWithExpressions(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	fixtures := []struct {
+		name         string
+		description  string
+		versionCount int
+		createdAt    time.Time
+	}{
+		{"payments-gateway", "Charges cards", 5, time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{"payouts", "Pays merchants, 100% of the time", 1, time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)},
+		{"billing", "Creates invoices", 3, time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{"notifications", "Sends emails", 0, time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)},
+	}
+
+	for _, fixture := range fixtures {
+		service, err := repository.CreateService(&repository.Service{Name: fixture.name, Description: fixture.description, UserID: 1, OrganizationID: 1})
+		if err != nil {
+			t.Fatalf(`Failed to create service in DB for test`)
+		}
+		dbInstance.Model(service).UpdateColumns(map[string]interface{}{"version_count": fixture.versionCount, "created_at": fixture.createdAt})
+	}
+
+	filter := func(expression string) *httptest.ResponseRecorder {
+		return sendRequest(t, router, "GET", "/services?sort_field=name&filter="+url.QueryEscape(expression), "", 1)
+	}
+
+	names := func(w *httptest.ResponseRecorder) []string {
+		assert.Equal(t, http.StatusOK, w.Code)
+		names := []string{}
+		for _, service := range decodeResponse(t, w)["data"].([]interface{}) {
+			names = append(names, service.(map[string]interface{})["Name"].(string))
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"payments-gateway", "payouts"}, names(filter("name~pay*")))
+	assert.Equal(t, []string{"payments-gateway"}, names(filter("name~pay*,version_count>=3,created_at>2025-01-01")))
+	assert.Equal(t, []string{"billing", "payments-gateway"}, names(filter("version_count>=3")))
+	assert.Equal(t, []string{"notifications", "payments-gateway"}, names(filter("created_at>=2025-01-01T00:00:00Z")))
+
+	// "," binds tighter than "|", and groups can be nested in parentheses
+	assert.Equal(t, []string{"notifications", "payments-gateway"}, names(filter("name~pay*,version_count>3|version_count=0")))
+	assert.Equal(t, []string{"payments-gateway"}, names(filter("name~pay*,(version_count>3|version_count=0)")))
+
+	assert.Equal(t, []string{"billing", "payouts"}, names(filter("name=in=(billing,payouts,unknown)")))
+	assert.Equal(t, []string{"notifications", "payments-gateway"}, names(filter("version_count=out=(1,3)")))
+	assert.Equal(t, []string{"billing", "notifications"}, names(filter("name!~pay*")))
+	assert.Equal(t, []string{"payouts"}, names(filter(`description~"*100%*"`)))
+	assert.Equal(t, []string{"billing"}, names(filter(`description="Creates invoices"`)))
+
+	// Values are always sent as query parameters
+	assert.Equal(t, []string{}, names(filter("name=billing' OR '1'='1")))
+
+	// The original filter_field and filter_value parameters still work
+	assert.Equal(t, []string{"billing"}, names(sendRequest(t, router, "GET", "/services?filter_field=name&filter_value=billing", "", 1)))
+	assert.Equal(t, http.StatusBadRequest, sendRequest(t, router, "GET", "/services?filter_field=id&filter_value=billing", "", 1).Code, "Only name and description can be used with filter_field")
+
+	for expression, message := range map[string]string{
+		"nme=billing":          `Invalid filter at position 1: unknown field "nme" - must be one of [created_at, description, id, metadata.<key>, name, updated_at, version_count].`,
+		"name":                 `Invalid filter at position 5: expected an operator after "name" - one of [=in= =out= != >= <= !~ = > < ~].`,
+		"version_count>three":  `Invalid filter at position 15: invalid value "three" for "version_count" - must be an integer.`,
+		"created_at>yesterday": `Invalid filter at position 12: invalid value "yesterday" for "created_at" - must be a date (2006-01-02) or an RFC 3339 timestamp (2006-01-02T15:04:05Z).`,
+		"version_count~3*":     `Invalid filter at position 14: operator "~" is only supported for text fields.`,
+		"name=billing,":        `Invalid filter at position 14: expected a field name, but the filter ended.`,
+		"(name=billing":        `Invalid filter at position 14: expected ")" to close the group.`,
+		"name=in=(billing":     `Invalid filter at position 17: expected "," or ")" in the list of values.`,
+		"name=billing)":        `Invalid filter at position 13: unexpected ')'.`,
+		"name=":                `Invalid filter at position 6: expected a value - use "" for an empty value.`,
+		`name="billing`:        `Invalid filter at position 14: unterminated quoted value.`,
+		"name)or(1=1":          `Invalid filter at position 5: expected an operator after "name" - one of [=in= =out= != >= <= !~ = > < ~].`,
+	} {
+		w := filter(expression)
+		assert.Equal(t, http.StatusBadRequest, w.Code, expression)
+		assert.Equal(t, message, decodeResponse(t, w)["error"].(map[string]interface{})["message"], expression)
+	}
+}
+
+func TestCursorPagination(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	// Ties in version_count and created_at are broken by ID
+	createdAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 7; i++ {
+		service, err := repository.CreateService(&repository.Service{Name: "service-" + strconv.Itoa(i), UserID: 1, OrganizationID: 1})
+		if err != nil {
+			t.Fatalf(`Failed to create service in DB for test`)
+		}
+		dbInstance.Model(service).UpdateColumns(map[string]interface{}{"version_count": i % 3, "created_at": createdAt.Add(time.Duration(i%2) * time.Hour)})
+	}
+
+	ids := func(w *httptest.ResponseRecorder) ([]string, map[string]interface{}) {
+		assert.Equal(t, http.StatusOK, w.Code)
+		response := decodeResponse(t, w)
+		ids := []string{}
+		for _, row := range response["data"].([]interface{}) {
+			ids = append(ids, row.(map[string]interface{})["ID"].(string))
+		}
+		return ids, response["meta"].(map[string]interface{})
+	}
+
+	for _, sort := range []string{"id", "name", "created_at", "updated_at", "version_count"} {
+		for _, order := range []string{"asc", "desc"} {
+			query := "/services?sort_field=" + sort + "&sort_order=" + order
+			expected, _ := ids(sendRequest(t, router, "GET", query+"&page_size_limit=100", "", 1))
+
+			// Walk forwards through pages of 3, then backwards from the last page
+			var pages [][]string
+			var visited []string
+			page, meta := ids(sendRequest(t, router, "GET", query+"&page_size_limit=3", "", 1))
+			assert.Nil(t, meta["prev_cursor"])
+			for {
+				pages = append(pages, page)
+				visited = append(visited, page...)
+				if meta["next_cursor"] == nil {
+					break
+				}
+				page, meta = ids(sendRequest(t, router, "GET", "/services?page_size_limit=3&cursor="+meta["next_cursor"].(string), "", 1))
+			}
+			assert.Equal(t, expected, visited, query)
+			assert.Len(t, pages, 3, query)
+
+			for i := len(pages) - 2; i >= 0; i-- {
+				page, meta = ids(sendRequest(t, router, "GET", "/services?page_size_limit=3&cursor="+meta["prev_cursor"].(string), "", 1))
+				assert.Equal(t, pages[i], page, query)
+			}
+			assert.Nil(t, meta["prev_cursor"], query)
+		}
+	}
+
+	// Offset pagination still works, and links to the neighbouring pages with cursors
+	page, meta := ids(sendRequest(t, router, "GET", "/services?page_size_limit=3&page_number=2", "", 1))
+	assert.Equal(t, float64(2), meta["PageNumber"])
+	assert.NotNil(t, meta["next_cursor"])
+	previous, _ := ids(sendRequest(t, router, "GET", "/services?page_size_limit=3&cursor="+meta["prev_cursor"].(string), "", 1))
+	first, _ := ids(sendRequest(t, router, "GET", "/services?page_size_limit=3", "", 1))
+	assert.Equal(t, first, previous)
+	assert.Len(t, page, 3)
+
+	cursor := meta["next_cursor"].(string)
+
+	w := sendRequest(t, router, "GET", "/services?cursor="+cursor[:len(cursor)-2]+"xx", "", 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = sendRequest(t, router, "GET", "/services?sort_field=name&cursor="+cursor, "", 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = sendRequest(t, router, "GET", "/services?page_number=2&cursor="+cursor, "", 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Cursors only work for the list they were issued for
+	otherOrgID, otherUserID := createTestTenant(t, dbInstance, "Other Corp.")
+	repository.CreateService(&repository.Service{Name: "other", UserID: otherUserID, OrganizationID: otherOrgID})
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/services?cursor="+cursor, nil)
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, otherUserID, otherOrgID))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestVersionCursorPagination(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	service, _ := repository.CreateService(&repository.Service{Name: "payments", UserID: 1, OrganizationID: 1})
+	for _, name := range []string{"1.0.0", "legacy", "2.0.0-rc.1", "1.10.0", "nightly", "2.0.0", "1.2.0"} {
+		if _, err := repository.CreateVersion(&repository.Version{Name: name, ServiceID: service.ID, UserID: 1, OrganizationID: 1}); err != nil {
+			t.Fatalf(`Failed to create version in DB for test`)
+		}
+	}
+
+	for _, order := range []string{"asc", "desc"} {
+		query := "/services/" + service.ID + "/versions?sort_field=semver&sort_order=" + order
+
+		var visited []interface{}
+		w := sendRequest(t, router, "GET", query+"&page_size_limit=2", "", 1)
+		for {
+			assert.Equal(t, http.StatusOK, w.Code)
+			response := decodeResponse(t, w)
+			for _, version := range response["data"].([]interface{}) {
+				visited = append(visited, version.(map[string]interface{})["Name"])
+			}
+			next := response["meta"].(map[string]interface{})["next_cursor"]
+			if next == nil {
+				break
+			}
+			w = sendRequest(t, router, "GET", "/services/"+service.ID+"/versions?page_size_limit=2&cursor="+next.(string), "", 1)
+		}
+
+		expected := []interface{}{"1.0.0", "1.2.0", "1.10.0", "2.0.0-rc.1", "2.0.0", "legacy", "nightly"}
+		if order == "desc" {
+			expected = []interface{}{"2.0.0", "2.0.0-rc.1", "1.10.0", "1.2.0", "1.0.0", "nightly", "legacy"}
+		}
+		assert.Equal(t, expected, visited, order)
+	}
+
+	// Cursors of one service's versions can't be used for another service, or for services
+	w := sendRequest(t, router, "GET", "/services/"+service.ID+"/versions?page_size_limit=2", "", 1)
+	cursor := decodeResponse(t, w)["meta"].(map[string]interface{})["next_cursor"].(string)
+
+	other, _ := repository.CreateService(&repository.Service{Name: "billing", UserID: 1, OrganizationID: 1})
+	w = sendRequest(t, router, "GET", "/services/"+other.ID+"/versions?cursor="+cursor, "", 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = sendRequest(t, router, "GET", "/services?cursor="+cursor, "", 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPaginationTotalsAndLinks(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	for i := 0; i < 7; i++ {
+		repository.CreateService(&repository.Service{Name: "service-" + strconv.Itoa(i), UserID: 1, OrganizationID: 1})
+	}
+	repository.CreateService(&repository.Service{Name: "other", UserID: 1, OrganizationID: 1})
+
+	names := func(response map[string]interface{}) []string {
+		names := []string{}
+		for _, service := range response["data"].([]interface{}) {
+			names = append(names, service.(map[string]interface{})["Name"].(string))
+		}
+		return names
+	}
+
+	filter := "filter=" + url.QueryEscape("name~service-*")
+	w := sendRequest(t, router, "GET", "/services?sort_field=name&sort_order=desc&page_size_limit=3&"+filter, "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	response := decodeResponse(t, w)
+	meta := response["meta"].(map[string]interface{})
+	links := response["links"].(map[string]interface{})
+
+	// Counts follow the filter
+	assert.Equal(t, float64(7), meta["total_count"])
+	assert.Equal(t, float64(3), meta["total_pages"])
+	assert.Nil(t, links["prev"])
+	assert.Contains(t, w.Header().Get("Link"), `rel="next"`)
+	assert.Contains(t, w.Header().Get("Link"), `rel="last"`)
+	assert.NotContains(t, w.Header().Get("Link"), `rel="prev"`)
+
+	// The last page holds the last rows, and has no next page
+	w = sendRequest(t, router, "GET", links["last"].(string), "", 1)
+	response = decodeResponse(t, w)
+	assert.Equal(t, []string{"service-2", "service-1", "service-0"}, names(response))
+	assert.Nil(t, response["links"].(map[string]interface{})["next"])
+	assert.Nil(t, response["meta"].(map[string]interface{})["next_cursor"])
+
+	w = sendRequest(t, router, "GET", response["links"].(map[string]interface{})["prev"].(string), "", 1)
+	response = decodeResponse(t, w)
+	assert.Equal(t, []string{"service-5", "service-4", "service-3"}, names(response))
+
+	// Links keep the filter, page size and sort order
+	w = sendRequest(t, router, "GET", response["links"].(map[string]interface{})["first"].(string), "", 1)
+	response = decodeResponse(t, w)
+	assert.Equal(t, []string{"service-6", "service-5", "service-4"}, names(response))
+
+	w = sendRequest(t, router, "GET", "/services?include_total_count=false", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, decodeResponse(t, w)["meta"], "total_count")
+
+	w = sendRequest(t, router, "GET", "/services?include_total_count=maybe", "", 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Single resources have no links
+	w = sendRequest(t, router, "GET", "/ping", "", 1)
+	assert.NotContains(t, decodeResponse(t, w), "links")
+
+	service, _ := repository.CreateService(&repository.Service{Name: "payments", UserID: 1, OrganizationID: 1})
+	repository.CreateVersion(&repository.Version{Name: "1.0.0", ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+	repository.CreateVersion(&repository.Version{Name: "1.1.0", ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+
+	w = sendRequest(t, router, "GET", "/services/"+service.ID+"/versions?page_size_limit=1", "", 1)
+	response = decodeResponse(t, w)
+	assert.Equal(t, float64(2), response["meta"].(map[string]interface{})["total_count"])
+	assert.Equal(t, float64(2), response["meta"].(map[string]interface{})["total_pages"])
+	assert.NotNil(t, response["links"].(map[string]interface{})["next"])
+}
+
+func TestMultiColumnSorting(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	for i, name := range []string{"delta", "alpha", "echo", "charlie", "bravo", "foxtrot"} {
+		service, _ := repository.CreateService(&repository.Service{Name: name, UserID: 1, OrganizationID: 1})
+		dbInstance.Model(service).UpdateColumn("version_count", i%2)
+	}
+
+	names := func(w *httptest.ResponseRecorder) ([]string, map[string]interface{}) {
+		assert.Equal(t, http.StatusOK, w.Code)
+		response := decodeResponse(t, w)
+		names := []string{}
+		for _, row := range response["data"].([]interface{}) {
+			names = append(names, row.(map[string]interface{})["Name"].(string))
+		}
+		return names, response["meta"].(map[string]interface{})
+	}
+
+	expected := []string{"alpha", "charlie", "foxtrot", "bravo", "delta", "echo"}
+	all, _ := names(sendRequest(t, router, "GET", "/services?sort=-version_count,name", "", 1))
+	assert.Equal(t, expected, all)
+
+	// Cursors keep every sort field
+	var visited []string
+	page, meta := names(sendRequest(t, router, "GET", "/services?sort=-version_count,%2Bname&page_size_limit=4", "", 1))
+	visited = append(visited, page...)
+	page, meta = names(sendRequest(t, router, "GET", "/services?page_size_limit=4&cursor="+meta["next_cursor"].(string), "", 1))
+	visited = append(visited, page...)
+	assert.Equal(t, expected, visited)
+	assert.Nil(t, meta["next_cursor"])
+
+	w := sendRequest(t, router, "GET", "/services?sort=-version_count,name&cursor="+meta["prev_cursor"].(string), "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = sendRequest(t, router, "GET", "/services?sort=version_count,name&cursor="+meta["prev_cursor"].(string), "", 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The links carry the sort order
+	w = sendRequest(t, router, "GET", "/services?sort=-version_count,name&page_size_limit=2", "", 1)
+	first := decodeResponse(t, w)["links"].(map[string]interface{})["first"].(string)
+	page, _ = names(sendRequest(t, router, "GET", first, "", 1))
+	assert.Equal(t, expected[:2], page)
+
+	for query, message := range map[string]string{
+		"sort=-rating":                  `Invalid sort - unknown field "rating", must be one of [created_at, id, name, updated_at, version_count].`,
+		"sort=name,-name":               `Invalid sort - field "name" is repeated.`,
+		"sort=name,":                    "Invalid sort - empty field name.",
+		"sort=id,name,id,name,id,name":  "Invalid sort - at most 5 fields are allowed.",
+		"sort=name&sort_order=desc":     "Invalid sort - can not be combined with sort_field and sort_order.",
+		"sort_field=rating":             "Invalid sort_field - must be one of [created_at, id, name, updated_at, version_count].",
+		"sort_field=name&sort_order=up": "Invalid sort_order - must be one of [asc, desc].",
+	} {
+		w = sendRequest(t, router, "GET", "/services?"+query, "", 1)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		assert.Equal(t, message, decodeResponse(t, w)["error"].(map[string]interface{})["message"], query)
+	}
+
+	// Versions share the sort syntax, and their own whitelist
+	service, _ := repository.CreateService(&repository.Service{Name: "payments", UserID: 1, OrganizationID: 1})
+	for _, name := range []string{"1.0.0", "2.0.0", "1.1.0", "legacy"} {
+		repository.CreateVersion(&repository.Version{Name: name, ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+	}
+	versions, _, _ := repository.GetServiceVersions(repository.Version{ServiceID: service.ID, OrganizationID: 1}, nil, 1, 10, []repository.SortField{{Name: "name"}}, nil)
+	repository.TransitionVersion(1, service.ID, versions[1].ID, repository.VersionStateDeprecated, nil, nil)
+
+	all, _ = names(sendRequest(t, router, "GET", "/services/"+service.ID+"/versions?sort=state,-semver", "", 1))
+	assert.Equal(t, []string{"2.0.0", "1.0.0", "legacy", "1.1.0"}, all)
+
+	w = sendRequest(t, router, "GET", "/services/"+service.ID+"/versions?sort=version_count", "", 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestServiceLabelsAndSelectors(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	labels := map[string]map[string]string{
+		"payments": {"tier": "1", "env": "prod", "example.com/language": "go"},
+		"billing":  {"tier": "2", "env": "dev"},
+		"search":   {"tier": "3", "env": "prod", "legacy": ""},
+		"mailer":   {},
+	}
+
+	serviceIDs := map[string]string{}
+	for _, name := range []string{"billing", "mailer", "payments", "search"} {
+		service, _ := repository.CreateService(&repository.Service{Name: name, UserID: 1, OrganizationID: 1})
+		serviceIDs[name] = service.ID
+		for key, value := range labels[name] {
+			w := sendRequest(t, router, "PUT", "/services/"+service.ID+"/labels/"+key, `{"value": "`+value+`"}`, 1)
+			assert.Equal(t, http.StatusOK, w.Code, key)
+		}
+	}
+
+	// Setting a label again replaces its value
+	w := sendRequest(t, router, "PUT", "/services/"+serviceIDs["billing"]+"/labels/env", `{"value": "staging"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "staging", decodeResponse(t, w)["data"].(map[string]interface{})["Value"])
+
+	w = sendRequest(t, router, "GET", "/services/"+serviceIDs["payments"]+"/labels", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var keys []string
+	for _, label := range decodeResponse(t, w)["data"].([]interface{}) {
+		keys = append(keys, label.(map[string]interface{})["Key"].(string))
+	}
+	assert.Equal(t, []string{"env", "example.com/language", "tier"}, keys)
+
+	names := func(selector string) []string {
+		w := sendRequest(t, router, "GET", "/services?sort=name&labels="+url.QueryEscape(selector), "", 1)
+		assert.Equal(t, http.StatusOK, w.Code, selector)
+		response := decodeResponse(t, w)
+		names := []string{}
+		for _, service := range response["data"].([]interface{}) {
+			names = append(names, service.(map[string]interface{})["Name"].(string))
+		}
+		assert.Equal(t, float64(len(names)), response["meta"].(map[string]interface{})["total_count"], selector)
+		return names
+	}
+
+	assert.Equal(t, []string{"billing", "payments"}, names("tier in (1,2)"))
+	assert.Equal(t, []string{"billing", "mailer", "payments"}, names("!legacy"))
+	assert.Equal(t, []string{"search"}, names("legacy"))
+	assert.Equal(t, []string{"billing", "mailer"}, names("env!=prod"))
+	assert.Equal(t, []string{"mailer", "search"}, names("tier notin (1, 2)"))
+	assert.Equal(t, []string{"payments"}, names("tier in (1,2),env==prod,!legacy"))
+	assert.Equal(t, []string{"payments"}, names("example.com/language=go"))
+	assert.Equal(t, []string{"search"}, names("legacy="))
+
+	// Selectors combine with filters, sorting and cursors
+	w = sendRequest(t, router, "GET", "/services?labels=tier&filter=name~*a*&sort=-name&page_size_limit=1", "", 1)
+	response := decodeResponse(t, w)
+	assert.Equal(t, "search", response["data"].([]interface{})[0].(map[string]interface{})["Name"])
+	w = sendRequest(t, router, "GET", response["links"].(map[string]interface{})["next"].(string), "", 1)
+	response = decodeResponse(t, w)
+	assert.Equal(t, "payments", response["data"].([]interface{})[0].(map[string]interface{})["Name"])
+	assert.Nil(t, response["meta"].(map[string]interface{})["next_cursor"])
+
+	for selector, message := range map[string]string{
+		"tier in 1":     `Invalid labels at position 9: expected "(" to start the list of values for "in".`,
+		"tier >= 1":     `Invalid labels at position 6: expected an operator after "tier" - one of [= == != in notin].`,
+		"-tier":         `Invalid labels at position 1: invalid label key "-tier".`,
+		"tier=a b":      `Invalid labels at position 8: unexpected 'b'.`,
+		"tier in (1,2":  `Invalid labels at position 13: expected "," or ")" in the list of values.`,
+		"env=prod,":     "Invalid labels at position 10: expected a label key, but the selector ended.",
+		"env=prod/east": `Invalid labels at position 5: invalid label value "prod/east".`,
+	} {
+		w = sendRequest(t, router, "GET", "/services?labels="+url.QueryEscape(selector), "", 1)
+		assert.Equal(t, http.StatusBadRequest, w.Code, selector)
+		assert.Equal(t, message, decodeResponse(t, w)["error"].(map[string]interface{})["message"], selector)
+	}
+
+	w = sendRequest(t, router, "PUT", "/services/"+serviceIDs["mailer"]+"/labels/Not_Valid-", `{}`, 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = sendRequest(t, router, "DELETE", "/services/"+serviceIDs["search"]+"/labels/legacy", "", 1)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = sendRequest(t, router, "DELETE", "/services/"+serviceIDs["search"]+"/labels/legacy", "", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, []string{}, names("legacy"))
+
+	// Labels of other organizations are invisible
+	otherOrgID, otherUserID := createTestTenant(t, dbInstance, "Other Corp.")
+	other, _ := repository.CreateService(&repository.Service{Name: "payments", UserID: otherUserID, OrganizationID: otherOrgID})
+	repository.SetServiceLabel(otherOrgID, other.ID, "tier", "1")
+	assert.Equal(t, []string{"payments"}, names("tier=1"))
+
+	w = sendRequest(t, router, "PUT", "/services/"+other.ID+"/labels/tier", `{"value": "2"}`, 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestTeamOwnership(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	member := repository.User{Name: "Member", Email: "member@poppycorp.com", OrganizationID: 1, Role: repository.RoleViewer}
+	if err := dbInstance.Create(&member).Error; err != nil {
+		t.Fatalf("Error creating user: %v\n", err)
+	}
+
+	createTeam := func(name string) string {
+		w := sendRequest(t, router, "POST", "/teams", `{"name": "`+name+`"}`, 1)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		return decodeResponse(t, w)["data"].(map[string]interface{})["ID"].(string)
+	}
+	payments := createTeam("Payments")
+	platform := createTeam("Platform")
+	sre := createTeam("SRE")
+
+	w := sendRequest(t, router, "POST", "/teams", `{"name": "Payments"}`, 1)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, `a team named "Payments" already exists in this organization.`, decodeResponse(t, w)["error"].(map[string]interface{})["message"])
+
+	// Membership
+	w = sendRequest(t, router, "PUT", "/teams/"+payments+"/members/"+strconv.Itoa(member.ID), "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = sendRequest(t, router, "PUT", "/teams/"+payments+"/members/"+strconv.Itoa(member.ID), "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = sendRequest(t, router, "GET", "/teams/"+payments+"/members", "", 1)
+	members := decodeResponse(t, w)["data"].([]interface{})
+	assert.Len(t, members, 1)
+	assert.Equal(t, "Member", members[0].(map[string]interface{})["Name"])
+
+	w = sendRequest(t, router, "DELETE", "/teams/"+payments+"/members/"+strconv.Itoa(member.ID), "", 1)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = sendRequest(t, router, "DELETE", "/teams/"+payments+"/members/"+strconv.Itoa(member.ID), "", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Only admins manage teams
+	w = sendRequest(t, router, "POST", "/teams", `{"name": "Rogue"}`, member.ID)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Ownership
+	gateway, _ := repository.CreateService(&repository.Service{Name: "gateway", UserID: 1, OrganizationID: 1})
+	ledger, _ := repository.CreateService(&repository.Service{Name: "ledger", UserID: 1, OrganizationID: 1})
+	repository.CreateService(&repository.Service{Name: "mailer", UserID: 1, OrganizationID: 1})
+
+	w = sendRequest(t, router, "PUT", "/services/"+gateway.ID+"/owners", `{"owner_team_id": "`+payments+`", "maintainer_team_ids": ["`+sre+`", "`+platform+`"]}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	owners := decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Equal(t, "Payments", owners["Owner"].(map[string]interface{})["Name"])
+	assert.Equal(t, "Platform", owners["Maintainers"].([]interface{})[0].(map[string]interface{})["Name"])
+	assert.Equal(t, "SRE", owners["Maintainers"].([]interface{})[1].(map[string]interface{})["Name"])
+
+	w = sendRequest(t, router, "PUT", "/services/"+ledger.ID+"/owners", `{"owner_team_id": "`+payments+`"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	serviceNames := func(path string) []string {
+		w := sendRequest(t, router, "GET", path, "", 1)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		names := []string{}
+		for _, service := range decodeResponse(t, w)["data"].([]interface{}) {
+			names = append(names, service.(map[string]interface{})["Name"].(string))
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"gateway", "ledger"}, serviceNames("/services?sort=name&owner_team="+payments))
+	assert.Equal(t, []string{}, serviceNames("/services?owner_team="+sre))
+	assert.Equal(t, []string{"gateway"}, serviceNames("/teams/"+sre+"/services"))
+
+	w = sendRequest(t, router, "GET", "/teams/"+payments+"/services", "", 1)
+	assert.Equal(t, "owner", decodeResponse(t, w)["data"].([]interface{})[0].(map[string]interface{})["Role"])
+
+	// Reassigning ownership replaces the previous owners
+	w = sendRequest(t, router, "PUT", "/services/"+gateway.ID+"/owners", `{"owner_team_id": "`+platform+`"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = sendRequest(t, router, "GET", "/services/"+gateway.ID+"/owners", "", 1)
+	owners = decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Equal(t, "Platform", owners["Owner"].(map[string]interface{})["Name"])
+	assert.Empty(t, owners["Maintainers"])
+	assert.Equal(t, []string{"ledger"}, serviceNames("/services?owner_team="+payments))
+	assert.Equal(t, []string{}, serviceNames("/teams/"+sre+"/services"))
+
+	w = sendRequest(t, router, "PUT", "/services/"+gateway.ID+"/owners", `{"owner_team_id": "`+platform+`", "maintainer_team_ids": ["`+platform+`"]}`, 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Teams of other organizations can't own services
+	otherOrgID, _ := createTestTenant(t, dbInstance, "Other Corp.")
+	otherTeam, _ := repository.CreateTeam(&repository.Team{Name: "Payments", OrganizationID: otherOrgID})
+	w = sendRequest(t, router, "PUT", "/services/"+gateway.ID+"/owners", `{"owner_team_id": "`+otherTeam.ID+`"}`, 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = sendRequest(t, router, "GET", "/teams/"+otherTeam.ID, "", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = sendRequest(t, router, "GET", "/services?owner_team=payments", "", 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestServiceLinks(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	service, _ := repository.CreateService(&repository.Service{Name: "payments", UserID: 1, OrganizationID: 1})
+	linksPath := "/services/" + service.ID + "/links"
+
+	w := sendRequest(t, router, "POST", linksPath, `{"type": "runbook", "title": "Runbook", "url": "https://wiki.example.com/payments/runbook"}`, 1)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	runbook := decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Equal(t, "runbook", runbook["Type"])
+
+	w = sendRequest(t, router, "POST", linksPath, `{"type": "repo", "url": "https://git.example.com/payments"}`, 1)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Links are embedded in the service, ordered by type
+	w = sendRequest(t, router, "GET", "/services/"+service.ID, "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	embedded := decodeResponse(t, w)["data"].(map[string]interface{})["Links"].([]interface{})
+	assert.Len(t, embedded, 2)
+	assert.Equal(t, "repo", embedded[0].(map[string]interface{})["Type"])
+	assert.Equal(t, "runbook", embedded[1].(map[string]interface{})["Type"])
+
+	w = sendRequest(t, router, "PUT", linksPath+"/"+runbook["ID"].(string), `{"type": "docs", "url": "http://docs.example.com/payments"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = sendRequest(t, router, "GET", linksPath+"/"+runbook["ID"].(string), "", 1)
+	updated := decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Equal(t, "docs", updated["Type"])
+	assert.Equal(t, "", updated["Title"])
+	assert.Equal(t, "http://docs.example.com/payments", updated["URL"])
+
+	for _, body := range []string{
+		`{"type": "wiki", "url": "https://wiki.example.com"}`,
+		`{"type": "docs", "url": "javascript:alert(1)"}`,
+		`{"type": "docs", "url": "/relative/path"}`,
+		`{"type": "docs", "url": "https://"}`,
+		`{"type": "docs"}`,
+	} {
+		w = sendRequest(t, router, "POST", linksPath, body, 1)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	w = sendRequest(t, router, "DELETE", linksPath+"/"+runbook["ID"].(string), "", 1)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = sendRequest(t, router, "GET", linksPath+"/"+runbook["ID"].(string), "", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = sendRequest(t, router, "GET", linksPath, "", 1)
+	assert.Len(t, decodeResponse(t, w)["data"].([]interface{}), 1)
+
+	// Links of other organizations are invisible
+	otherOrgID, otherUserID := createTestTenant(t, dbInstance, "Other Corp.")
+	other, _ := repository.CreateService(&repository.Service{Name: "payments", UserID: otherUserID, OrganizationID: otherOrgID})
+	w = sendRequest(t, router, "POST", "/services/"+other.ID+"/links", `{"type": "repo", "url": "https://git.example.com/other"}`, 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = sendRequest(t, router, "GET", "/services/"+other.ID+"/links", "", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestServiceMetadataSchema(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	schemaPath := "/organization/service-metadata-schema"
+
+	// Without a schema, any metadata is accepted
+	w := sendRequest(t, router, "GET", schemaPath, "", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = sendRequest(t, router, "POST", "/services", `{"name": "legacy", "metadata": {"anything": [1, 2]}}`, 1)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	legacy := decodeResponse(t, w)["data"].(map[string]interface{})
+
+	w = sendRequest(t, router, "PUT", schemaPath, `{"type": "object", "properties": {"tier": {"type": "integer"}}, "required": 3}`, 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = sendRequest(t, router, "PUT", schemaPath, `{"$ref": "https://example.com/schema.json"}`, 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	schema := `{
+		"type": "object",
+		"properties": {
+			"tier": {"type": "integer", "minimum": 1, "maximum": 3},
+			"cost_center": {"type": "string", "pattern": "^CC-[0-9]+$"},
+			"pci": {"type": "boolean"},
+			"oncall": {"type": "object", "properties": {"email": {"type": "string", "format": "email"}}}
+		},
+		"required": ["tier"]
+	}`
+	w = sendRequest(t, router, "PUT", schemaPath, schema, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = sendRequest(t, router, "GET", schemaPath, "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []interface{}{"tier"}, decodeResponse(t, w)["data"].(map[string]interface{})["required"])
+
+	// Invalid metadata is rejected with the path of every failing value
+	w = sendRequest(t, router, "POST", "/services", `{"name": "payments", "metadata": {"tier": 5, "cost_center": "finance", "oncall": {"email": "nobody"}}}`, 1)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	errs := decodeResponse(t, w)["error"].(map[string]interface{})["errors"].([]interface{})
+	var paths []string
+	for _, err := range errs {
+		paths = append(paths, err.(map[string]interface{})["path"].(string))
+		assert.NotEmpty(t, err.(map[string]interface{})["message"])
+	}
+	assert.Equal(t, []string{"/metadata/cost_center", "/metadata/oncall/email", "/metadata/tier"}, paths)
+
+	w = sendRequest(t, router, "POST", "/services", `{"name": "payments"}`, 1)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	w = sendRequest(t, router, "POST", "/services", `{"name": "payments", "metadata": {"tier": 1, "cost_center": "CC-100", "pci": true}}`, 1)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	payments := decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"tier": float64(1), "cost_center": "CC-100", "pci": true}, payments["Metadata"])
+
+	w = sendRequest(t, router, "POST", "/services", `{"name": "search", "metadata": {"tier": 2, "cost_center": "CC-200"}}`, 1)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	search := decodeResponse(t, w)["data"].(map[string]interface{})
+
+	// Updates are validated as well - existing services are checked the next time they change
+	w = sendRequest(t, router, "PUT", "/services/"+legacy["ID"].(string), `{"name": "legacy", "metadata": {"anything": [1, 2]}}`, 1)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/services/"+search["ID"].(string), bytes.NewBufferString(`{"metadata": {"tier": "two"}}`))
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, 1, 1))
+	req.Header.Set("Content-Type", resources.MergePatchMediaType)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	w = sendRequest(t, router, "PUT", "/services/"+legacy["ID"].(string), `{"name": "legacy", "metadata": {"tier": 3}}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	filter := func(expression string) []string {
+		w := sendRequest(t, router, "GET", "/services?sort=name&filter="+url.QueryEscape(expression), "", 1)
+		assert.Equal(t, http.StatusOK, w.Code, expression)
+		var names []string
+		for _, service := range decodeResponse(t, w)["data"].([]interface{}) {
+			names = append(names, service.(map[string]interface{})["Name"].(string))
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"payments"}, filter("metadata.tier=1"))
+	assert.Equal(t, []string{"legacy", "search"}, filter("metadata.tier>=2"))
+	assert.Equal(t, []string{"payments"}, filter("metadata.pci=true"))
+	assert.Equal(t, []string{"search"}, filter(`metadata.cost_center="CC-200"`))
+	assert.Equal(t, []string{"payments", "search"}, filter("metadata.cost_center~CC-*"))
+	assert.Equal(t, []string{"payments", "search"}, filter("metadata.tier=in=(1,2),name!=legacy"))
+	assert.Empty(t, filter("metadata.missing=1"))
+
+	for expression, message := range map[string]string{
+		"metadata=1":        `Invalid filter at position 9: expected "." and a key after "metadata", for example metadata.tier.`,
+		"metadata.=1":       `Invalid filter at position 10: expected a key after "metadata." - keys are made of letters, digits, "_" and "-".`,
+		"metadata.tier.x=1": `Invalid filter at position 14: expected an operator after "metadata.tier" - one of [=in= =out= != >= <= !~ = > < ~].`,
+	} {
+		w := sendRequest(t, router, "GET", "/services?filter="+url.QueryEscape(expression), "", 1)
+		assert.Equal(t, http.StatusBadRequest, w.Code, expression)
+		assert.Equal(t, message, decodeResponse(t, w)["error"].(map[string]interface{})["message"], expression)
+	}
+
+	// Without a schema, metadata is no longer checked
+	w = sendRequest(t, router, "DELETE", schemaPath, "", 1)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = sendRequest(t, router, "POST", "/services", `{"name": "untyped", "metadata": {"tier": "gold"}}`, 1)
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestServiceDependencies(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	ids := map[string]string{}
+	for _, name := range []string{"web", "api", "db", "cache", "worker"} {
+		service, _ := repository.CreateService(&repository.Service{Name: name, UserID: 1, OrganizationID: 1})
+		ids[name] = service.ID
+	}
+
+	depend := func(from string, to string, body string) *httptest.ResponseRecorder {
+		return sendRequest(t, router, "PUT", "/services/"+ids[from]+"/dependencies/"+ids[to], body, 1)
+	}
+
+	// web -> api -> db, api -> cache, worker -> db
+	assert.Equal(t, http.StatusOK, depend("web", "api", `{"version_range": "^2.0.0"}`).Code)
+	assert.Equal(t, http.StatusOK, depend("api", "db", "").Code)
+	assert.Equal(t, http.StatusOK, depend("api", "cache", `{"version_range": ">=1.0.0 <3.0.0"}`).Code)
+	assert.Equal(t, http.StatusOK, depend("worker", "db", "").Code)
+
+	// Declaring a dependency again replaces its version range
+	w := depend("web", "api", `{"version_range": "~2.1"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "~2.1", decodeResponse(t, w)["data"].(map[string]interface{})["VersionRange"])
+
+	assert.Equal(t, http.StatusBadRequest, depend("web", "db", `{"version_range": "not a range"}`).Code)
+
+	// Cycles are rejected, with the path closing the cycle
+	w = depend("db", "web", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, []interface{}{ids["db"], ids["web"], ids["api"], ids["db"]}, decodeResponse(t, w)["error"].(map[string]interface{})["cycle"])
+	assert.Equal(t, http.StatusConflict, depend("api", "api", "").Code)
+
+	names := func(path string) []string {
+		w := sendRequest(t, router, "GET", path, "", 1)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		var names []string
+		for _, node := range decodeResponse(t, w)["data"].(map[string]interface{})["Nodes"].([]interface{}) {
+			node := node.(map[string]interface{})
+			names = append(names, node["Name"].(string)+":"+strconv.Itoa(int(node["Depth"].(float64))))
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"api:1"}, names("/services/"+ids["web"]+"/dependencies"))
+	assert.Equal(t, []string{"api:1", "cache:2", "db:2"}, names("/services/"+ids["web"]+"/dependencies?depth=5"))
+	assert.Equal(t, []string{"api:1", "worker:1"}, names("/services/"+ids["db"]+"/dependencies?direction=downstream"))
+	assert.Equal(t, []string{"api:1", "worker:1", "web:2"}, names("/services/"+ids["db"]+"/blast-radius"))
+	assert.Empty(t, names("/services/"+ids["web"]+"/blast-radius"))
+
+	w = sendRequest(t, router, "GET", "/services/"+ids["db"]+"/blast-radius", "", 1)
+	assert.Equal(t, float64(3), decodeResponse(t, w)["meta"].(map[string]interface{})["AffectedServices"])
+
+	for _, query := range []string{"direction=sideways", "depth=0", "depth=11", "depth=all"} {
+		w = sendRequest(t, router, "GET", "/services/"+ids["web"]+"/dependencies?"+query, "", 1)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	// Deleted services drop out of the graph, but their dependencies still count for cycles
+	w = sendRequest(t, router, "DELETE", "/services/"+ids["api"], "", 1)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, []string{"worker:1"}, names("/services/"+ids["db"]+"/blast-radius"))
+	assert.Equal(t, http.StatusNotFound, depend("db", "api", "").Code)
+	assert.Equal(t, http.StatusConflict, depend("cache", "web", "").Code)
+
+	w = sendRequest(t, router, "DELETE", "/services/"+ids["worker"]+"/dependencies/"+ids["db"], "", 1)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = sendRequest(t, router, "DELETE", "/services/"+ids["worker"]+"/dependencies/"+ids["db"], "", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, names("/services/"+ids["db"]+"/blast-radius"))
+
+	// Services of other organizations can't be depended on
+	otherOrgID, otherUserID := createTestTenant(t, dbInstance, "Other Corp.")
+	other, _ := repository.CreateService(&repository.Service{Name: "db", UserID: otherUserID, OrganizationID: otherOrgID})
+	w = sendRequest(t, router, "PUT", "/services/"+ids["web"]+"/dependencies/"+other.ID, "", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDependencyGraphExport(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	ids := map[string]string{}
+	for _, name := range []string{"web", "api", "db", "billing", "legacy \"v1\""} {
+		service, _ := repository.CreateService(&repository.Service{Name: name, UserID: 1, OrganizationID: 1})
+		ids[name] = service.ID
+	}
+
+	repository.SetServiceDependency(1, ids["web"], ids["api"], ">=2.0.0 <3.0.0")
+	repository.SetServiceDependency(1, ids["api"], ids["db"], "")
+	repository.SetServiceDependency(1, ids["billing"], ids["db"], "")
+	repository.SetServiceLabel(1, ids["web"], "tier", "1")
+	repository.SetServiceLabel(1, ids["api"], "tier", "1")
+
+	version, _ := repository.CreateVersion(&repository.Version{Name: "v1.0.0", ServiceID: ids["db"], UserID: 1, OrganizationID: 1})
+	repository.CreateVersion(&repository.Version{Name: "v2.0.0", ServiceID: ids["db"], UserID: 1, OrganizationID: 1})
+	dbInstance.Model(&repository.Version{}).Where("id = ?", version.ID).Update("state", repository.VersionStateDeprecated)
+
+	jsonGraph := func(query string) map[string]interface{} {
+		w := sendRequest(t, router, "GET", "/graph?"+query, "", 1)
+		assert.Equal(t, http.StatusOK, w.Code, query)
+		return decodeResponse(t, w)["graph"].(map[string]interface{})
+	}
+
+	// The whole graph, keyed by ULIDs and labelled with names
+	graph := jsonGraph("")
+	nodes := graph["nodes"].(map[string]interface{})
+	assert.Len(t, nodes, 5)
+	assert.Equal(t, "db", nodes[ids["db"]].(map[string]interface{})["label"])
+	assert.Equal(t, map[string]interface{}{"deprecated": true, "deprecated_versions": []interface{}{"v1.0.0"}}, nodes[ids["db"]].(map[string]interface{})["metadata"])
+	assert.Equal(t, false, nodes[ids["api"]].(map[string]interface{})["metadata"].(map[string]interface{})["deprecated"])
+	edges := graph["edges"].([]interface{})
+	assert.Len(t, edges, 3)
+	assert.Equal(t, map[string]interface{}{"source": ids["api"], "target": ids["db"], "relation": "depends_on", "metadata": map[string]interface{}{"version_range": ""}}, edges[0])
+
+	// Scoped to a root, a direction and a depth
+	assert.Len(t, jsonGraph("root=" + ids["api"])["nodes"], 3)
+	assert.Len(t, jsonGraph("root=" + ids["db"] + "&direction=downstream&depth=1")["nodes"], 3)
+	assert.Len(t, jsonGraph("root=" + ids["db"] + "&direction=downstream")["nodes"], 4)
+	assert.Len(t, jsonGraph("root=" + ids["db"] + "&direction=upstream")["nodes"], 1)
+
+	// Scoped to a label selector - the root is always included
+	graph = jsonGraph("labels=" + url.QueryEscape("tier=1"))
+	assert.Len(t, graph["nodes"], 2)
+	assert.Len(t, graph["edges"], 1)
+	graph = jsonGraph("root=" + ids["db"] + "&labels=" + url.QueryEscape("tier=1"))
+	assert.Len(t, graph["nodes"], 3)
+	assert.Len(t, graph["edges"], 2)
+
+	w := sendRequest(t, router, "GET", "/graph?format=dot&labels=tier%3D1", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/vnd.graphviz; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `digraph services {
+  rankdir=LR;
+  node [shape=box];
+  "`+ids["api"]+`" [label="api"];
+  "`+ids["web"]+`" [label="web"];
+  "`+ids["web"]+`" -> "`+ids["api"]+`" [label=">=2.0.0 <3.0.0"];
+}
+`, w.Body.String())
+
+	w = sendRequest(t, router, "GET", "/graph?format=dot&root="+ids["billing"], "", 1)
+	assert.Contains(t, w.Body.String(), `"`+ids["db"]+`" [label="db\ndeprecated: v1.0.0", style=dashed, color=orange];`)
+
+	w = sendRequest(t, router, "GET", "/graph?format=mermaid", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	mermaid := w.Body.String()
+	assert.True(t, strings.HasPrefix(mermaid, "flowchart LR\n"))
+	assert.Contains(t, mermaid, "  "+ids["legacy \"v1\""]+"[\"legacy #quot;v1#quot;\"]\n")
+	assert.Contains(t, mermaid, "  "+ids["db"]+"[\"db<br/>deprecated: v1.0.0\"]\n")
+	assert.Contains(t, mermaid, "  "+ids["web"]+" -->|\"#gt;=2.0.0 #lt;3.0.0\"| "+ids["api"]+"\n")
+	assert.Contains(t, mermaid, "  class "+ids["db"]+" deprecated\n")
+
+	for _, query := range []string{"format=svg", "root=nope", "depth=2", "root=" + ids["db"] + "&direction=sideways", "root=" + ids["db"] + "&depth=11", "labels=" + url.QueryEscape("tier in")} {
+		w = sendRequest(t, router, "GET", "/graph?"+query, "", 1)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	w = sendRequest(t, router, "GET", "/graph?root=01ARZ3NDEKTSV4RRFFQ69G5FAV", "", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestEnvironmentsAndDeployments(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	// Organizations start with dev, staging and prod
+	w := sendRequest(t, router, "GET", "/environments", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	environments := map[string]string{}
+	var names []string
+	for _, environment := range decodeResponse(t, w)["data"].([]interface{}) {
+		environment := environment.(map[string]interface{})
+		environments[environment["Name"].(string)] = environment["ID"].(string)
+		names = append(names, environment["Name"].(string))
+	}
+	assert.Equal(t, []string{"dev", "staging", "prod"}, names)
+
+	w = sendRequest(t, router, "POST", "/environments", `{"name": "eu-prod", "description": "Production in the EU"}`, 1)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	environments["eu-prod"] = decodeResponse(t, w)["data"].(map[string]interface{})["ID"].(string)
+
+	assert.Equal(t, http.StatusConflict, sendRequest(t, router, "POST", "/environments", `{"name": "prod"}`, 1).Code)
+	assert.Equal(t, http.StatusBadRequest, sendRequest(t, router, "POST", "/environments", `{"name": "Prod EU"}`, 1).Code)
+
+	service, _ := repository.CreateService(&repository.Service{Name: "payments", UserID: 1, OrganizationID: 1})
+	other, _ := repository.CreateService(&repository.Service{Name: "search", UserID: 1, OrganizationID: 1})
+	v1, _ := repository.CreateVersion(&repository.Version{Name: "v1.0.0", ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+	v2, _ := repository.CreateVersion(&repository.Version{Name: "v2.0.0", ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+	searchVersion, _ := repository.CreateVersion(&repository.Version{Name: "v0.1.0", ServiceID: other.ID, UserID: 1, OrganizationID: 1})
+
+	deploymentsPath := "/services/" + service.ID + "/deployments"
+	deploy := func(path string, versionID string, environment string, extra string) *httptest.ResponseRecorder {
+		return sendRequest(t, router, "POST", path, `{"version_id": "`+versionID+`", "environment_id": "`+environments[environment]+`"`+extra+`}`, 1)
+	}
+
+	w = deploy(deploymentsPath, v1.ID, "prod", `, "deployed_at": "2026-01-01T10:00:00Z"`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	first := decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Equal(t, "succeeded", first["Status"])
+	assert.Equal(t, "v1.0.0", first["VersionName"])
+	assert.Equal(t, "prod", first["EnvironmentName"])
+	assert.Equal(t, float64(1), first["UserID"])
+
+	assert.Equal(t, http.StatusCreated, deploy(deploymentsPath, v2.ID, "staging", "").Code)
+	assert.Equal(t, http.StatusCreated, deploy("/services/"+other.ID+"/deployments", searchVersion.ID, "prod", "").Code)
+
+	// A failed deployment does not replace what runs in the environment
+	assert.Equal(t, http.StatusCreated, deploy(deploymentsPath, v2.ID, "prod", `, "status": "failed"`).Code)
+
+	w = deploy(deploymentsPath, v2.ID, "prod", `, "status": "in_progress"`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	inProgress := decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Nil(t, inProgress["FinishedAt"])
+
+	current := func() map[string]interface{} {
+		w := sendRequest(t, router, "GET", deploymentsPath+"/current", "", 1)
+		assert.Equal(t, http.StatusOK, w.Code)
+		versions := map[string]interface{}{}
+		for _, entry := range decodeResponse(t, w)["data"].([]interface{}) {
+			entry := entry.(map[string]interface{})
+			name := entry["Environment"].(map[string]interface{})["Name"].(string)
+			versions[name] = nil
+			if entry["Current"] != nil {
+				versions[name] = entry["Current"].(map[string]interface{})["VersionName"]
+			}
+		}
+		return versions
+	}
+	assert.Equal(t, map[string]interface{}{"dev": nil, "staging": "v2.0.0", "prod": "v1.0.0", "eu-prod": nil}, current())
+
+	w = sendRequest(t, router, "PUT", deploymentsPath+"/"+inProgress["ID"].(string)+"/status", `{"status": "succeeded"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotNil(t, decodeResponse(t, w)["data"].(map[string]interface{})["FinishedAt"])
+	assert.Equal(t, "v2.0.0", current()["prod"])
+
+	// Finished deployments stay finished
+	w = sendRequest(t, router, "PUT", deploymentsPath+"/"+inProgress["ID"].(string)+"/status", `{"status": "failed"}`, 1)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// What runs in an environment, across services
+	w = sendRequest(t, router, "GET", "/environments/"+environments["prod"]+"/deployments", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var running []string
+	for _, deployment := range decodeResponse(t, w)["data"].([]interface{}) {
+		deployment := deployment.(map[string]interface{})
+		running = append(running, deployment["ServiceName"].(string)+"@"+deployment["VersionName"].(string))
+	}
+	assert.Equal(t, []string{"payments@v2.0.0", "search@v0.1.0"}, running)
+
+	// History, newest first
+	history := func(query string) []string {
+		w := sendRequest(t, router, "GET", deploymentsPath+query, "", 1)
+		assert.Equal(t, http.StatusOK, w.Code, query)
+		var entries []string
+		for _, deployment := range decodeResponse(t, w)["data"].([]interface{}) {
+			deployment := deployment.(map[string]interface{})
+			entries = append(entries, deployment["EnvironmentName"].(string)+":"+deployment["VersionName"].(string)+":"+deployment["Status"].(string))
+		}
+		return entries
+	}
+	assert.Equal(t, []string{"prod:v2.0.0:succeeded", "prod:v2.0.0:failed", "staging:v2.0.0:succeeded", "prod:v1.0.0:succeeded"}, history(""))
+	assert.Equal(t, []string{"staging:v2.0.0:succeeded"}, history("?environment_id="+environments["staging"]))
+	assert.Equal(t, []string{"staging:v2.0.0:succeeded"}, history("?page_size_limit=1&page_number=3"))
+
+	w = sendRequest(t, router, "GET", deploymentsPath+"/"+first["ID"].(string), "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// A rollout which started earlier, but finished later, is what runs in the environment
+	w = deploy(deploymentsPath, v1.ID, "eu-prod", `, "status": "in_progress", "deployed_at": "2026-01-01T09:00:00Z"`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	slowRollout := decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Equal(t, http.StatusCreated, deploy(deploymentsPath, v2.ID, "eu-prod", `, "deployed_at": "2026-01-01T10:00:00Z"`).Code)
+	assert.Equal(t, "v2.0.0", current()["eu-prod"])
+	assert.Equal(t, http.StatusOK, sendRequest(t, router, "PUT", deploymentsPath+"/"+slowRollout["ID"].(string)+"/status", `{"status": "succeeded"}`, 1).Code)
+	assert.Equal(t, "v1.0.0", current()["eu-prod"])
+
+	// Yanked versions can't be deployed, and versions must belong to the service
+	dbInstance.Model(&repository.Version{}).Where("id = ?", v1.ID).Update("state", repository.VersionStateYanked)
+	assert.Equal(t, http.StatusConflict, deploy(deploymentsPath, v1.ID, "dev", "").Code)
+	assert.Equal(t, http.StatusNotFound, deploy(deploymentsPath, searchVersion.ID, "dev", "").Code)
+	assert.Equal(t, http.StatusBadRequest, deploy(deploymentsPath, v2.ID, "dev", `, "status": "done"`).Code)
+	assert.Equal(t, http.StatusBadRequest, deploy(deploymentsPath, v2.ID, "dev", `, "deployed_at": "2999-01-01T00:00:00Z"`).Code)
+
+	// Environments of other organizations are invisible
+	otherOrgID, otherUserID := createTestTenant(t, dbInstance, "Other Corp.")
+	otherEnvironments, _ := repository.GetEnvironments(otherOrgID)
+	assert.Len(t, otherEnvironments, 3)
+	w = sendRequest(t, router, "POST", deploymentsPath, `{"version_id": "`+v2.ID+`", "environment_id": "`+otherEnvironments[0].ID+`"}`, 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/environments/"+environments["prod"], nil)
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, otherUserID, otherOrgID))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestPromotions(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	editor := repository.User{Name: "Editor", Email: "editor@poppycorp.com", OrganizationID: 1, Role: repository.RoleEditor}
+	dbInstance.Create(&editor)
+
+	// The default environments form the pipeline dev, staging, prod
+	w := sendRequest(t, router, "GET", "/environments", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	environments := map[string]string{}
+	for i, environment := range decodeResponse(t, w)["data"].([]interface{}) {
+		environment := environment.(map[string]interface{})
+		environments[environment["Name"].(string)] = environment["ID"].(string)
+		assert.Equal(t, float64(i+1), environment["PipelinePosition"])
+	}
+
+	w = sendRequest(t, router, "PUT", "/environments/"+environments["prod"]+"/gates", `{"min_soak_minutes": 60, "required_approvals": 1}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, float64(60), decodeResponse(t, w)["data"].(map[string]interface{})["MinSoakMinutes"])
+	assert.Equal(t, http.StatusBadRequest, sendRequest(t, router, "PUT", "/environments/"+environments["prod"]+"/gates", `{"min_soak_minutes": 60, "required_approvals": 11}`, 1).Code)
+	assert.Equal(t, http.StatusBadRequest, sendRequest(t, router, "PUT", "/environments/"+environments["prod"]+"/gates", `{"min_soak_minutes": 60}`, 1).Code)
+	assert.Equal(t, http.StatusForbidden, sendRequest(t, router, "PUT", "/environments/"+environments["prod"]+"/gates", `{"min_soak_minutes": 0, "required_approvals": 0}`, editor.ID).Code)
+
+	service, _ := repository.CreateService(&repository.Service{Name: "payments", UserID: 1, OrganizationID: 1})
+	v1, _ := repository.CreateVersion(&repository.Version{Name: "v1.0.0", ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+
+	promotionsPath := "/services/" + service.ID + "/promotions"
+	promote := func(environment string) *httptest.ResponseRecorder {
+		return sendRequest(t, router, "POST", promotionsPath, `{"version_id": "`+v1.ID+`", "environment_id": "`+environments[environment]+`"}`, 1)
+	}
+	reasons := func(w *httptest.ResponseRecorder) []interface{} {
+		assert.Equal(t, http.StatusConflict, w.Code)
+		body := decodeResponse(t, w)["error"].(map[string]interface{})
+		assert.NotEmpty(t, body["promotion_id"])
+		return body["reasons"].([]interface{})
+	}
+
+	assert.Equal(t, []interface{}{"version v1.0.0 was not deployed successfully to dev"}, reasons(promote("staging")))
+	assert.Contains(t, reasons(promote("dev"))[0], "first environment of the pipeline")
+
+	w = sendRequest(t, router, "POST", "/services/"+service.ID+"/deployments", `{"version_id": "`+v1.ID+`", "environment_id": "`+environments["dev"]+`"}`, 1)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = promote("staging")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	promoted := decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Equal(t, environments["dev"], promoted["Promotion"].(map[string]interface{})["FromEnvironmentID"])
+	assert.Equal(t, "promoted", promoted["Promotion"].(map[string]interface{})["Status"])
+	assert.Equal(t, "staging", promoted["Deployment"].(map[string]interface{})["EnvironmentName"])
+
+	// Just deployed to staging, and not approved
+	assert.Len(t, reasons(promote("prod")), 2)
+
+	// Backdated deployments don't count towards the soak time, which counts from when the server recorded the deployment
+	twoHoursAgo := time.Now().UTC().Add(-2 * time.Hour)
+	w = sendRequest(t, router, "POST", "/services/"+service.ID+"/deployments", `{"version_id": "`+v1.ID+`", "environment_id": "`+environments["staging"]+`", "deployed_at": "`+twoHoursAgo.Format(time.RFC3339)+`"}`, 1)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, reasons(promote("prod"))[0], "has run in staging for 0 minutes")
+
+	// Let the version soak in staging
+	dbInstance.Model(&repository.Deployment{}).Where("environment_id = ?", environments["staging"]).Update("finish_recorded_at", twoHoursAgo)
+
+	// Only admins can skip the pipeline, by deploying to its later environments directly
+	deploy := func(environment string, userID int) int {
+		return sendRequest(t, router, "POST", "/services/"+service.ID+"/deployments", `{"version_id": "`+v1.ID+`", "environment_id": "`+environments[environment]+`", "status": "in_progress"}`, userID).Code
+	}
+	assert.Equal(t, http.StatusForbidden, deploy("prod", editor.ID))
+	assert.Equal(t, http.StatusForbidden, deploy("staging", editor.ID))
+	assert.Equal(t, http.StatusCreated, deploy("dev", editor.ID))
+
+	// Approving your own promotion does not count
+	approvalsPath := "/services/" + service.ID + "/versions/" + v1.ID + "/approvals"
+	assert.Equal(t, http.StatusCreated, sendRequest(t, router, "POST", approvalsPath, `{"environment_id": "`+environments["prod"]+`"}`, 1).Code)
+	assert.Equal(t, []interface{}{"version v1.0.0 has 0 of the 1 approvals prod requires"}, reasons(promote("prod")))
+
+	assert.Equal(t, http.StatusCreated, sendRequest(t, router, "POST", approvalsPath, `{"environment_id": "`+environments["prod"]+`"}`, editor.ID).Code)
+	assert.Equal(t, http.StatusCreated, sendRequest(t, router, "POST", approvalsPath, `{"environment_id": "`+environments["prod"]+`"}`, editor.ID).Code)
+	w = sendRequest(t, router, "GET", approvalsPath, "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, decodeResponse(t, w)["data"], 2)
+
+	assert.Equal(t, http.StatusCreated, promote("prod").Code)
+
+	// Every promotion is recorded, newest first
+	w = sendRequest(t, router, "GET", promotionsPath, "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var statuses []string
+	for _, promotion := range decodeResponse(t, w)["data"].([]interface{}) {
+		promotion := promotion.(map[string]interface{})
+		statuses = append(statuses, promotion["Status"].(string))
+		assert.Equal(t, float64(1), promotion["UserID"])
+	}
+	assert.Equal(t, []string{"promoted", "rejected", "rejected", "rejected", "promoted", "rejected", "rejected"}, statuses)
+
+	// The pipeline can be reordered, leaving environments out of it
+	w = sendRequest(t, router, "PUT", "/environments/pipeline", `{"environment_ids": ["`+environments["dev"]+`", "`+environments["prod"]+`"]}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var names []string
+	for _, environment := range decodeResponse(t, w)["data"].([]interface{}) {
+		names = append(names, environment.(map[string]interface{})["Name"].(string))
+	}
+	assert.Equal(t, []string{"dev", "prod", "staging"}, names)
+	assert.Equal(t, []interface{}{"staging is not part of the promotion pipeline"}, reasons(promote("staging")))
+
+	// Duplicates are rejected as invalid, not reported as missing environments - including IDs differing only in case
+	w = sendRequest(t, router, "PUT", "/environments/pipeline", `{"environment_ids": ["`+environments["dev"]+`", "`+environments["dev"]+`"]}`, 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, decodeResponse(t, w)["error"].(map[string]interface{})["message"], "only be in the pipeline once")
+	assert.Equal(t, http.StatusBadRequest, sendRequest(t, router, "PUT", "/environments/pipeline", `{"environment_ids": ["`+environments["dev"]+`", "`+strings.ToLower(environments["dev"])+`"]}`, 1).Code)
+	_, err := repository.SetEnvironmentPipeline(1, []string{environments["dev"], environments["dev"]})
+	assert.ErrorIs(t, err, repository.ErrDuplicatePipelineEnvironment)
+	assert.Equal(t, http.StatusNotFound, sendRequest(t, router, "PUT", "/environments/pipeline", `{"environment_ids": ["01ARZ3NDEKTSV4RRFFQ69G5FAV"]}`, 1).Code)
+	assert.Equal(t, http.StatusNotFound, sendRequest(t, router, "POST", promotionsPath, `{"version_id": "01ARZ3NDEKTSV4RRFFQ69G5FAV", "environment_id": "`+environments["prod"]+`"}`, 1).Code)
+}
+
+func TestDORAMetrics(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	environments := map[string]string{}
+	for _, environment := range decodeResponse(t, sendRequest(t, router, "GET", "/environments", "", 1))["data"].([]interface{}) {
+		environment := environment.(map[string]interface{})
+		environments[environment["Name"].(string)] = environment["ID"].(string)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	ago := func(hours int) time.Time {
+		return now.Add(-time.Duration(hours) * time.Hour)
+	}
+
+	service, _ := repository.CreateService(&repository.Service{Name: "payments", UserID: 1, OrganizationID: 1})
+	other, _ := repository.CreateService(&repository.Service{Name: "search", UserID: 1, OrganizationID: 1})
+	versions := map[string]string{}
+	for name, createdAt := range map[string]time.Time{"v1.0.0": ago(240), "v2.0.0": ago(120), "v3.0.0": ago(72)} {
+		version, _ := repository.CreateVersion(&repository.Version{Name: name, ServiceID: service.ID, UserID: 1, OrganizationID: 1})
+		dbInstance.Model(&repository.Version{}).Where("id = ?", version.ID).Update("created_at", createdAt)
+		versions[name] = version.ID
+	}
+	searchVersion, _ := repository.CreateVersion(&repository.Version{Name: "v0.1.0", ServiceID: other.ID, UserID: 1, OrganizationID: 1})
+	dbInstance.Model(&repository.Version{}).Where("id = ?", searchVersion.ID).Update("created_at", ago(48))
+
+	deploy := func(serviceID string, versionID string, deployedAt time.Time, extra string) *httptest.ResponseRecorder {
+		return sendRequest(t, router, "POST", "/services/"+serviceID+"/deployments",
+			`{"version_id": "`+versionID+`", "environment_id": "`+environments["prod"]+`", "deployed_at": "`+deployedAt.Format(time.RFC3339)+`"`+extra+`}`, 1)
+	}
+	deploymentID := func(w *httptest.ResponseRecorder) string {
+		assert.Equal(t, http.StatusCreated, w.Code)
+		return decodeResponse(t, w)["data"].(map[string]interface{})["ID"].(string)
+	}
+
+	deploymentID(deploy(service.ID, versions["v1.0.0"], ago(216), ""))
+	rolledBack := deploymentID(deploy(service.ID, versions["v2.0.0"], ago(96), ""))
+	rollback := deploymentID(deploy(service.ID, versions["v1.0.0"], ago(94), `, "rollback_of": "`+rolledBack+`"`))
+	failed := deploymentID(deploy(service.ID, versions["v3.0.0"], ago(48), `, "status": "failed"`))
+	restored := deploymentID(deploy(service.ID, versions["v3.0.0"], ago(42), ""))
+	deploymentID(deploy(other.ID, searchVersion.ID, ago(24), ""))
+
+	// Rollbacks must roll back a successful deployment, once, with a different version
+	assert.Equal(t, http.StatusConflict, deploy(service.ID, versions["v2.0.0"], ago(1), `, "rollback_of": "`+failed+`"`).Code)
+	assert.Equal(t, http.StatusConflict, deploy(service.ID, versions["v3.0.0"], ago(1), `, "rollback_of": "`+restored+`"`).Code)
+	assert.Equal(t, http.StatusConflict, deploy(service.ID, versions["v1.0.0"], ago(1), `, "rollback_of": "`+rolledBack+`"`).Code)
+	assert.Equal(t, http.StatusNotFound, deploy(other.ID, searchVersion.ID, ago(1), `, "rollback_of": "`+restored+`"`).Code)
+	assert.Equal(t, http.StatusBadRequest, deploy(service.ID, versions["v1.0.0"], ago(1), `, "rollback_of": "latest"`).Code)
+
+	w := sendRequest(t, router, "GET", "/services/"+service.ID+"/deployments/"+rollback, "", 1)
+	assert.Equal(t, rolledBack, decodeResponse(t, w)["data"].(map[string]interface{})["RollbackOfID"])
+
+	// Metrics default to the last 30 days of production
+	w = sendRequest(t, router, "GET", "/services/"+service.ID+"/metrics/dora", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := decodeResponse(t, w)
+	assert.Equal(t, "prod", body["meta"].(map[string]interface{})["EnvironmentName"])
+	assert.Equal(t, float64(30), body["meta"].(map[string]interface{})["WindowDays"])
+	metrics := body["data"].(map[string]interface{})
+	assert.Equal(t, float64(4), metrics["Deployments"])
+	assert.Equal(t, float64(3), metrics["SuccessfulDeployments"])
+	assert.Equal(t, float64(1), metrics["Rollbacks"])
+	assert.Equal(t, 0.1, metrics["DeploymentsPerDay"])
+	assert.Equal(t, float64(24), metrics["LeadTimeMedianHours"])
+	assert.Equal(t, float64(2), metrics["FailedChanges"])
+	assert.Equal(t, 0.5, metrics["ChangeFailureRate"])
+	assert.Equal(t, float64(4), metrics["TimeToRestoreMedianHours"])
+
+	w = sendRequest(t, router, "GET", "/services/"+service.ID+"/metrics/dora?window_days=3", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	metrics = decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Equal(t, float64(2), metrics["Deployments"])
+	assert.Equal(t, float64(0), metrics["Rollbacks"])
+	assert.Equal(t, float64(30), metrics["LeadTimeMedianHours"])
+	assert.Equal(t, float64(6), metrics["TimeToRestoreMedianHours"])
+
+	// Metrics which can't be computed are null
+	w = sendRequest(t, router, "GET", "/services/"+service.ID+"/metrics/dora?environment_id="+environments["staging"], "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	metrics = decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Equal(t, float64(0), metrics["Deployments"])
+	assert.Nil(t, metrics["ChangeFailureRate"])
+	assert.Nil(t, metrics["LeadTimeMedianHours"])
+
+	// The organization rollup covers all services, along with each service's own metrics
+	w = sendRequest(t, router, "GET", "/metrics/dora", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	rollup := decodeResponse(t, w)["data"].(map[string]interface{})
+	metrics = rollup["Metrics"].(map[string]interface{})
+	assert.Equal(t, float64(5), metrics["Deployments"])
+	assert.Equal(t, 0.4, metrics["ChangeFailureRate"])
+	assert.Equal(t, 0.13, metrics["DeploymentsPerDay"])
+	services := rollup["Services"].([]interface{})
+	assert.Len(t, services, 2)
+	assert.Equal(t, "payments", services[0].(map[string]interface{})["ServiceName"])
+	assert.Equal(t, float64(1), services[1].(map[string]interface{})["Metrics"].(map[string]interface{})["Deployments"])
+
+	assert.Equal(t, http.StatusBadRequest, sendRequest(t, router, "GET", "/metrics/dora?window_days=0", "", 1).Code)
+	assert.Equal(t, http.StatusBadRequest, sendRequest(t, router, "GET", "/metrics/dora?window_days=366", "", 1).Code)
+	assert.Equal(t, http.StatusNotFound, sendRequest(t, router, "GET", "/metrics/dora?environment_id=01ARZ3NDEKTSV4RRFFQ69G5FAV", "", 1).Code)
+	assert.Equal(t, http.StatusNotFound, sendRequest(t, router, "GET", "/services/01ARZ3NDEKTSV4RRFFQ69G5FAV/metrics/dora", "", 1).Code)
+
+	// Without a pipeline, the environment has to be given
+	assert.Equal(t, http.StatusOK, sendRequest(t, router, "PUT", "/environments/pipeline", `{"environment_ids": []}`, 1).Code)
+	assert.Equal(t, http.StatusBadRequest, sendRequest(t, router, "GET", "/metrics/dora", "", 1).Code)
+	assert.Equal(t, http.StatusOK, sendRequest(t, router, "GET", "/metrics/dora?environment_id="+environments["prod"], "", 1).Code)
+}
+
+func TestWebhooks(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	// The test receiver listens on a loopback address
+	webhooks.AllowPrivateDestinations = true
+	defer func() { webhooks.AllowPrivateDestinations = false }()
+
+	// The receiver records what it was sent, and answers with the status set by the test
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	var mutex sync.Mutex
+	var requests []received
+	status := http.StatusOK
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests = append(requests, received{r.Header, body})
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+	setStatus := func(code int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		status = code
+	}
+	requestCount := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(requests)
+	}
+
+	editor := repository.User{Name: "Editor", Email: "editor@poppycorp.com", OrganizationID: 1, Role: repository.RoleEditor}
+	dbInstance.Create(&editor)
+
+	w := sendRequest(t, router, "POST", "/webhooks", `{"url": "`+receiver.URL+`", "events": ["service.created", "version.created"]}`, 1)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	webhook := decodeResponse(t, w)["data"].(map[string]interface{})
+	secret := webhook["Secret"].(string)
+	assert.True(t, strings.HasPrefix(secret, "whsec_"))
+	assert.Equal(t, true, webhook["Active"])
+	webhookPath := "/webhooks/" + webhook["ID"].(string)
+
+	// Inactive subscriptions don't get deliveries
+	w = sendRequest(t, router, "POST", "/webhooks", `{"url": "`+receiver.URL+`/inactive", "events": ["service.created"], "active": false}`, 1)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	assert.Equal(t, http.StatusBadRequest, sendRequest(t, router, "POST", "/webhooks", `{"url": "`+receiver.URL+`", "events": ["service.renamed"]}`, 1).Code)
+	assert.Equal(t, http.StatusBadRequest, sendRequest(t, router, "POST", "/webhooks", `{"url": "`+receiver.URL+`", "events": []}`, 1).Code)
+	assert.Equal(t, http.StatusBadRequest, sendRequest(t, router, "POST", "/webhooks", `{"url": "ftp://example.com", "events": ["service.created"]}`, 1).Code)
+	assert.Equal(t, http.StatusForbidden, sendRequest(t, router, "POST", "/webhooks", `{"url": "`+receiver.URL+`", "events": ["service.created"]}`, editor.ID).Code)
+
+	// The secret is only returned once
+	w = sendRequest(t, router, "GET", webhookPath, "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, decodeResponse(t, w)["data"].(map[string]interface{})["Secret"])
+
+	w = sendRequest(t, router, "POST", "/services", `{"name": "payments", "description": "Payments"}`, editor.ID)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	serviceID := decodeResponse(t, w)["data"].(map[string]interface{})["ID"].(string)
+
+	// Events the subscription did not ask for are not sent
+	assert.Equal(t, http.StatusOK, sendRequest(t, router, "PUT", "/services/"+serviceID, `{"name": "payments", "description": "Card payments"}`, editor.ID).Code)
+
+	webhooks.DeliverDue(time.Now().UTC())
+	assert.Equal(t, 1, requestCount())
+
+	// Deliveries are signed with the secret
+	delivery := requests[0]
+	assert.Equal(t, "service.created", delivery.header.Get(webhooks.EventHeader))
+	assert.Equal(t, webhooks.Sign(secret, delivery.header.Get(webhooks.TimestampHeader), delivery.body), delivery.header.Get(webhooks.SignatureHeader))
+	assert.NotEqual(t, webhooks.Sign("whsec_other", delivery.header.Get(webhooks.TimestampHeader), delivery.body), delivery.header.Get(webhooks.SignatureHeader))
+	var event map[string]interface{}
+	assert.NoError(t, json.Unmarshal(delivery.body, &event))
+	assert.Equal(t, delivery.header.Get(webhooks.DeliveryHeader), event["id"])
+	assert.Equal(t, "service.created", event["event"])
+	assert.Equal(t, "payments", event["data"].(map[string]interface{})["Name"])
+
+	// Failed deliveries are retried with exponential backoff, until they run out of attempts
+	setStatus(http.StatusServiceUnavailable)
+	assert.Equal(t, http.StatusCreated, sendRequest(t, router, "POST", "/services/"+serviceID+"/versions", `{"name": "v1.0.0"}`, editor.ID).Code)
+
+	now := time.Now().UTC()
+	webhooks.DeliverDue(now)
+	assert.Equal(t, 2, requestCount())
+	webhooks.DeliverDue(now.Add(20 * time.Second))
+	assert.Equal(t, 2, requestCount(), "The first retry is due after 30 seconds")
+	webhooks.DeliverDue(now.Add(31 * time.Second))
+	assert.Equal(t, 3, requestCount())
+
+	// Retries count from when the delivery was sent, not from the time the batch was due at
+	var retried repository.WebhookDelivery
+	dbInstance.Where("event = ?", repository.EventVersionCreated).First(&retried)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), *retried.NextAttemptAt, 5*time.Second)
+	webhooks.DeliverDue(now.Add(50 * time.Second))
+	assert.Equal(t, 3, requestCount(), "The second retry is due a minute after the first")
+	for hours := 1; hours <= 5; hours++ {
+		webhooks.DeliverDue(now.Add(time.Duration(hours) * time.Hour))
+	}
+	assert.Equal(t, 7, requestCount())
+
+	w = sendRequest(t, router, "GET", webhookPath+"/deliveries", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	deliveries := decodeResponse(t, w)["data"].([]interface{})
+	assert.Len(t, deliveries, 2)
+	failed := deliveries[0].(map[string]interface{})
+	assert.Equal(t, "version.created", failed["Event"])
+	assert.Equal(t, "failed", failed["Status"])
+	assert.Equal(t, float64(6), failed["AttemptCount"])
+	assert.Nil(t, failed["NextAttemptAt"])
+	assert.Equal(t, "succeeded", deliveries[1].(map[string]interface{})["Status"])
+
+	deliveryPath := webhookPath + "/deliveries/" + failed["ID"].(string)
+	w = sendRequest(t, router, "GET", deliveryPath, "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	attempts := decodeResponse(t, w)["data"].(map[string]interface{})["Attempts"].([]interface{})
+	assert.Len(t, attempts, 6)
+	assert.Equal(t, float64(http.StatusServiceUnavailable), attempts[0].(map[string]interface{})["StatusCode"])
+
+	// Redelivery sends the same delivery right away, keeping its attempt history
+	setStatus(http.StatusNoContent)
+	w = sendRequest(t, router, "POST", deliveryPath+"/redeliver", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	redelivered := decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Equal(t, "succeeded", redelivered["Status"])
+	assert.Equal(t, float64(1), redelivered["AttemptCount"])
+	assert.Len(t, redelivered["Attempts"], 7)
+	assert.Equal(t, 8, requestCount())
+	assert.Equal(t, failed["ID"], requests[7].header.Get(webhooks.DeliveryHeader))
+
+	assert.Equal(t, http.StatusNotFound, sendRequest(t, router, "POST", webhookPath+"/deliveries/01ARZ3NDEKTSV4RRFFQ69G5FAV/redeliver", "", 1).Code)
+
+	// Subscriptions can be updated, and are private to their organization
+	w = sendRequest(t, router, "PUT", webhookPath, `{"url": "`+receiver.URL+`", "events": ["service.deleted"]}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []interface{}{"service.deleted"}, decodeResponse(t, w)["data"].(map[string]interface{})["Events"])
+
+	assert.Equal(t, http.StatusNoContent, sendRequest(t, router, "DELETE", "/services/"+serviceID, "", editor.ID).Code)
+	webhooks.DeliverDue(time.Now().UTC())
+	assert.Equal(t, 9, requestCount())
+	assert.Equal(t, "service.deleted", requests[8].header.Get(webhooks.EventHeader))
+
+	otherOrgID, otherUserID := createTestTenant(t, dbInstance, "Other Corp.")
+	req, _ := http.NewRequest("GET", webhookPath, nil)
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, otherUserID, otherOrgID))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	assert.Equal(t, http.StatusNoContent, sendRequest(t, router, "DELETE", webhookPath, "", 1).Code)
+	assert.Equal(t, http.StatusNotFound, sendRequest(t, router, "GET", deliveryPath, "", 1).Code)
+}
+
+func TestWebhooksRejectPrivateDestinations(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	received := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = true
+	}))
+	defer receiver.Close()
+
+	// Host names are checked once resolved, so they can't be used to reach internal addresses either
+	destinations := []string{receiver.URL, strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1), "http://169.254.169.254/latest/meta-data", "http://10.0.0.1:8080", "http://[::1]:8080"}
+	var webhookPaths []string
+	for _, destination := range destinations {
+		w := sendRequest(t, router, "POST", "/webhooks", `{"url": "`+destination+`", "events": ["service.created"]}`, 1)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		webhookPaths = append(webhookPaths, "/webhooks/"+decodeResponse(t, w)["data"].(map[string]interface{})["ID"].(string))
+	}
+
+	assert.Equal(t, http.StatusCreated, sendRequest(t, router, "POST", "/services", `{"name": "payments"}`, 1).Code)
+	webhooks.DeliverDue(time.Now().UTC())
+	assert.False(t, received)
+
+	for i, webhookPath := range webhookPaths {
+		w := sendRequest(t, router, "GET", webhookPath+"/deliveries", "", 1)
+		delivery := decodeResponse(t, w)["data"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "pending", delivery["Status"], destinations[i])
+
+		w = sendRequest(t, router, "GET", webhookPath+"/deliveries/"+delivery["ID"].(string), "", 1)
+		attempt := decodeResponse(t, w)["data"].(map[string]interface{})["Attempts"].([]interface{})[0].(map[string]interface{})
+		assert.Contains(t, attempt["Error"], webhooks.ErrPrivateDestination.Error(), destinations[i])
+		assert.Equal(t, "", attempt["ResponseBody"])
+	}
+}
+
+func TestWebhookDeliveriesAreClaimed(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	// Every connection to an in-memory database opens a database of its own
+	sqlDB, _ := dbInstance.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	webhooks.AllowPrivateDestinations = true
+	defer func() { webhooks.AllowPrivateDestinations = false }()
+
+	// Deliveries to /slow are held until the test releases them
+	slowReceived := make(chan struct{}, 1)
+	releaseSlow := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			slowReceived <- struct{}{}
+			<-releaseSlow
+		}
+	}))
+	defer receiver.Close()
+
+	webhookPaths := map[string]string{}
+	for _, path := range []string{"/slow", "/fast"} {
+		w := sendRequest(t, router, "POST", "/webhooks", `{"url": "`+receiver.URL+path+`", "events": ["service.created"]}`, 1)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		webhookPaths[path] = "/webhooks/" + decodeResponse(t, w)["data"].(map[string]interface{})["ID"].(string)
+	}
+
+	assert.Equal(t, http.StatusCreated, sendRequest(t, router, "POST", "/services", `{"name": "payments"}`, 1).Code)
+
+	deliveryPaths := map[string]string{}
+	for path, webhookPath := range webhookPaths {
+		w := sendRequest(t, router, "GET", webhookPath+"/deliveries", "", 1)
+		deliveryPaths[path] = webhookPath + "/deliveries/" + decodeResponse(t, w)["data"].([]interface{})[0].(map[string]interface{})["ID"].(string)
+	}
+
+	// Batches can take a while to send, so the time a batch was due at can be long past by the time a delivery is claimed
+	batchDueAt := time.Now().UTC().Add(-5 * time.Minute)
+	dbInstance.Model(&repository.WebhookDelivery{}).Where("1 = 1").Update("next_attempt_at", batchDueAt.Add(-time.Minute))
+
+	done := make(chan struct{})
+	go func() {
+		webhooks.DeliverDue(batchDueAt)
+		close(done)
+	}()
+	<-slowReceived
+
+	// Other deliveries can be redelivered while a slow receiver is being sent to, but the delivery being sent can't
+	w := sendRequest(t, router, "POST", deliveryPaths["/fast"]+"/redeliver", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "succeeded", decodeResponse(t, w)["data"].(map[string]interface{})["Status"])
+
+	w = sendRequest(t, router, "GET", deliveryPaths["/slow"], "", 1)
+	assert.Equal(t, "sending", decodeResponse(t, w)["data"].(map[string]interface{})["Status"])
+	assert.Equal(t, http.StatusConflict, sendRequest(t, router, "POST", deliveryPaths["/slow"]+"/redeliver", "", 1).Code)
+
+	close(releaseSlow)
+	<-done
+
+	w = sendRequest(t, router, "GET", deliveryPaths["/slow"], "", 1)
+	slow := decodeResponse(t, w)["data"].(map[string]interface{})
+	assert.Equal(t, "succeeded", slow["Status"])
+	assert.Len(t, slow["Attempts"], 1)
+
+	// A delivery whose sender stopped before recording the attempt is sent again once its claim expires
+	assert.Equal(t, http.StatusCreated, sendRequest(t, router, "POST", "/services", `{"name": "billing"}`, 1).Code)
+	w = sendRequest(t, router, "GET", webhookPaths["/fast"]+"/deliveries", "", 1)
+	stuck := repository.WebhookDelivery{ID: decodeResponse(t, w)["data"].([]interface{})[0].(map[string]interface{})["ID"].(string)}
+	now := time.Now().UTC()
+	claimed, err := repository.ClaimWebhookDelivery(&stuck, now, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	claimed, _ = repository.ClaimWebhookDelivery(&stuck, now, now.Add(time.Minute))
+	assert.False(t, claimed, "A claimed delivery can't be claimed again until the claim expires")
+
+	webhooks.DeliverDue(now.Add(2 * time.Minute))
+
+	w = sendRequest(t, router, "GET", webhookPaths["/fast"]+"/deliveries/"+stuck.ID, "", 1)
+	assert.Equal(t, "succeeded", decodeResponse(t, w)["data"].(map[string]interface{})["Status"])
+}
+
+func TestSearchIndexTriggersFromBuildsWithFTS5AreDropped(t *testing.T) {
+	dbInstance := setupTestRepository(t)
+	repository.DBInstance = dbInstance
+	router := setupRouter()
+
+	// A trigger left by a build with FTS5 - builds without FTS5 can't write to services_fts
+	dbInstance.Exec(`CREATE TRIGGER IF NOT EXISTS services_fts_insert AFTER INSERT ON services BEGIN
+		INSERT INTO services_fts (id, name, description) VALUES (new.id, new.name, new.description);
+	END`)
+	if err := repository.Migrate(dbInstance); err != nil {
+		t.Fatalf("Failed to migrate schema: %v", err)
+	}
+
+	assert.Equal(t, http.StatusCreated, sendRequest(t, router, "POST", "/services", `{"name": "payments"}`, 1).Code)
+
+	w := sendRequest(t, router, "GET", "/services/search?q=pay", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, decodeResponse(t, w)["data"], 1)
+}
@@ -1,19 +1,78 @@
 package middleware
 
 import (
+	"fmt"
+	"net/http"
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+	"github.com/harshadixit12/service-catalog-api/resources"
 )
 
-// Middleware function to add user details to the request context
+// Middleware function that authenticates the caller, and adds user details to the request context.
+// Callers must send either a signed JWT as a bearer token, or an API key in the Authorization header -
+// requests with missing or invalid credentials are rejected with 401, before any controller runs.
 func AuthMiddleware() gin.HandlerFunc {
+	verifier, err := NewTokenVerifierFromEnv()
+	if err != nil {
+		// Keys which could not be loaded are left out, so tokens signed with them are rejected.
+		fmt.Printf("Error loading token verification keys: %v\n", err)
+	}
+
 	return func(c *gin.Context) {
-		// Ideal case, we'd parse user's access token from request headers, and validate it, and add
-		// user info to the request
-		// However, we will assume a single user belonging to a single org is calling the API, and mock the details.
+		authorization := c.GetHeader("Authorization")
+
+		var userID, organizationID int
+		if rawKey, found := strings.CutPrefix(authorization, "ApiKey "); found {
+			// Non-human callers, like CI pipelines, authenticate with an API key
+			apiKey, err := repository.GetActiveAPIKey(strings.TrimSpace(rawKey))
+			if err != nil {
+				abortUnauthorized(c, "API key is invalid, revoked or has expired.")
+				return
+			}
+			userID, organizationID = apiKey.UserID, apiKey.OrganizationID
+		} else {
+			rawToken, found := strings.CutPrefix(authorization, "Bearer ")
+			if !found || strings.TrimSpace(rawToken) == "" {
+				abortUnauthorized(c, "Missing bearer token or API key in Authorization header.")
+				return
+			}
+
+			claims, err := verifier.Verify(strings.TrimSpace(rawToken))
+			if err != nil {
+				fmt.Printf("Invalid access token: %v\n", err)
+				abortUnauthorized(c, "Access token is invalid or has expired.")
+				return
+			}
+			userID, _ = claims.UserID()
+			organizationID = claims.OrganizationID
+		}
+
+		// Map the identity to the user and organization stored in our database, so credentials for
+		// unknown or deleted users and organizations are rejected.
+		user, err := repository.GetUserByID(userID)
+		if err != nil || user.OrganizationID != organizationID {
+			abortUnauthorized(c, "User is not authorized.")
+			return
+		}
+
+		if _, err := repository.GetOrganizationByID(user.OrganizationID); err != nil {
+			abortUnauthorized(c, "User is not authorized.")
+			return
+		}
+
 		// Add the user info to the request context
-		c.Set("userID", 1)
-		c.Set("organizationID", 1)
+		c.Set("userID", user.ID)
+		c.Set("organizationID", user.OrganizationID)
+		c.Set("userRole", user.Role)
 
 		c.Next()
 	}
 }
+
+func abortUnauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="service-catalog", ApiKey realm="service-catalog"`)
+	resources.SendError(c, http.StatusUnauthorized, gin.H{"message": message})
+	c.Abort()
+}
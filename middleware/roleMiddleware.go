@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshadixit12/service-catalog-api/repository"
+	"github.com/harshadixit12/service-catalog-api/resources"
+	"github.com/oklog/ulid/v2"
+)
+
+// Middleware function that only lets the request through if the caller has at least the given role.
+// For routes on a single service (with a :serviceId path parameter), per-service role overrides are taken into account.
+// Must be used after AuthMiddleware, which adds the caller's identity to the request context.
+func RequireRole(requiredRole string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, userExists := c.Get("userID")
+		orgID, orgExists := c.Get("organizationID")
+		userRole, roleExists := c.Get("userRole")
+		if !userExists || !orgExists || !roleExists {
+			resources.SendError(c, http.StatusUnauthorized, gin.H{"message": "User is not authorized."})
+			c.Abort()
+			return
+		}
+
+		// Invalid service IDs are left for the controllers to report
+		serviceID := ""
+		if serviceULID, err := ulid.Parse(c.Param("serviceId")); err == nil {
+			serviceID = serviceULID.String()
+		}
+
+		role, err := repository.GetEffectiveRole(orgID.(int), userID.(int), userRole.(string), serviceID)
+		if err != nil {
+			fmt.Printf("Error loading role: %v\n", err)
+			resources.SendError(c, http.StatusInternalServerError, gin.H{"message": "Unable to verify permissions."})
+			c.Abort()
+			return
+		}
+
+		if !repository.RoleSatisfies(role, requiredRole) {
+			resources.SendError(c, http.StatusForbidden, gin.H{"message": fmt.Sprintf("This action requires the %s role.", requiredRole)})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Environment variables used to configure token validation.
+const (
+	hmacSecretEnv = "AUTH_JWT_HS256_SECRET" // Shared secret for HS256 signed tokens
+	jwksFileEnv   = "AUTH_JWKS_FILE"        // Path to a JWKS file containing RSA public keys for RS256 signed tokens
+	issuerEnv     = "AUTH_JWT_ISSUER"       // Optional - expected value of the "iss" claim
+	audienceEnv   = "AUTH_JWT_AUDIENCE"     // Optional - expected value of the "aud" claim
+)
+
+// Claims carried by the access tokens we accept.
+// The subject ("sub") is the ID of the User, and "org_id" is the ID of the Organization the user belongs to.
+type Claims struct {
+	OrganizationID int `json:"org_id"`
+	jwt.RegisteredClaims
+}
+
+// UserID returns the numeric user ID held in the subject claim.
+func (c *Claims) UserID() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+// TokenVerifier validates signed JWTs using the configured HS256 secret and RS256 public keys.
+type TokenVerifier struct {
+	hmacSecret []byte
+	rsaKeys    map[string]*rsa.PublicKey // RSA public keys, indexed by key ID ("kid")
+	issuer     string
+	audience   string
+}
+
+// Builds a TokenVerifier from environment variables.
+// Either, or both of HS256 and RS256 can be enabled - tokens signed with an algorithm that is not configured are rejected.
+func NewTokenVerifierFromEnv() (*TokenVerifier, error) {
+	verifier := &TokenVerifier{
+		hmacSecret: []byte(os.Getenv(hmacSecretEnv)),
+		rsaKeys:    map[string]*rsa.PublicKey{},
+		issuer:     os.Getenv(issuerEnv),
+		audience:   os.Getenv(audienceEnv),
+	}
+
+	if jwksFile := os.Getenv(jwksFileEnv); jwksFile != "" {
+		keys, err := loadJWKSFile(jwksFile)
+		if err != nil {
+			return verifier, err
+		}
+		verifier.rsaKeys = keys
+	}
+
+	return verifier, nil
+}
+
+// Parses the raw token, verifies its signature and registered claims, and returns the claims.
+func (v *TokenVerifier) Verify(rawToken string) (*Claims, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	}
+	if v.issuer != "" {
+		options = append(options, jwt.WithIssuer(v.issuer))
+	}
+	if v.audience != "" {
+		options = append(options, jwt.WithAudience(v.audience))
+	}
+
+	claims := &Claims{}
+	if _, err := jwt.ParseWithClaims(rawToken, claims, v.keyFunc, options...); err != nil {
+		return nil, err
+	}
+
+	if _, err := claims.UserID(); err != nil {
+		return nil, errors.New("token subject is not a valid user ID")
+	}
+
+	if claims.OrganizationID == 0 {
+		return nil, errors.New("token is missing the org_id claim")
+	}
+
+	return claims, nil
+}
+
+// Picks the verification key based on the signing algorithm of the token.
+func (v *TokenVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		if len(v.hmacSecret) == 0 {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		return v.hmacSecret, nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := token.Header["kid"].(string)
+		key, ok := v.rsaKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+}
+
+// A JSON Web Key Set, as described in https://datatracker.ietf.org/doc/html/rfc7517#section-5
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// Reads RSA signing keys from a JWKS file. Keys which are not RSA signature keys are skipped.
+func loadJWKSFile(path string) (map[string]*rsa.PublicKey, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read JWKS file: %w", err)
+	}
+
+	var keySet jwks
+	if err := json.Unmarshal(contents, &keySet); err != nil {
+		return nil, fmt.Errorf("unable to parse JWKS file: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range keySet.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") || (key.Alg != "" && key.Alg != "RS256") {
+			continue
+		}
+
+		publicKey, err := parseRSAPublicKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q in JWKS file: %w", key.Kid, err)
+		}
+		keys[key.Kid] = publicKey
+	}
+
+	return keys, nil
+}
+
+// Builds an RSA public key from the base64url encoded modulus and exponent of a JWK.
+func parseRSAPublicKey(key jwk) (*rsa.PublicKey, error) {
+	modulus, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+
+	exponent, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+
+	e := new(big.Int).SetBytes(exponent)
+	if len(modulus) == 0 || !e.IsInt64() || e.Int64() < 3 {
+		return nil, errors.New("modulus or exponent is out of range")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(e.Int64())}, nil
+}
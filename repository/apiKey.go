@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Prefix of every API key we issue, so keys are easy to recognise (for example, by secret scanners)
+const apiKeyPrefix = "sc_"
+
+// APIKey represents a non-human credential, scoped to an Organization.
+// Requests authenticated with the key act on behalf of the User who created it.
+// Only a SHA-256 hash of the key is stored - the key itself is returned once, when it is created.
+type APIKey struct {
+	ID             string     `gorm:"primaryKey;type:char(36)"`
+	Name           string     `gorm:"type:varchar(256);not null"`                  // Name to identify the key, for example "ci-pipeline"
+	Prefix         string     `gorm:"type:varchar(16);not null"`                   // First characters of the key, to help users identify it
+	KeyHash        string     `gorm:"type:char(64);not null;uniqueIndex" json:"-"` // Hex encoded SHA-256 hash of the key
+	UserID         int        `gorm:"type:int;not null"`                           // ID of user who created the key
+	OrganizationID int        `gorm:"type:int;not null;index"`
+	ExpiresAt      *time.Time `gorm:"default null"` // Key is valid forever if not set
+	RevokedAt      *time.Time `gorm:"default null"`
+	LastUsedAt     *time.Time `gorm:"default null"`
+	CreatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// BeforeCreate GORM hook to generate a ULID before inserting a new API key
+func (k *APIKey) BeforeCreate(tx *gorm.DB) (err error) {
+	k.ID = ulid.Make().String()
+	return
+}
+
+// Generates a new random API key, and returns it along with its hash
+func GenerateAPIKey() (string, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, HashAPIKey(key), nil
+}
+
+// Returns the hex encoded SHA-256 hash of an API key.
+// API keys are high entropy random values, so a fast hash is sufficient here.
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// Creates an API key and inserts into DB
+func CreateAPIKey(apiKey *APIKey) (*APIKey, error) {
+	tx := DBInstance.Session(&gorm.Session{})
+	if err := tx.Create(apiKey).Error; err != nil {
+		return nil, err
+	}
+	return apiKey, nil
+}
+
+// Loads all API keys of an organization, including revoked and expired keys
+func GetAPIKeys(organizationID int) ([]APIKey, error) {
+	var apiKeys []APIKey
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("organization_id = ?", organizationID).Order("created_at desc").Find(&apiKeys).Error; err != nil {
+		return nil, err
+	}
+
+	return apiKeys, nil
+}
+
+// Marks an API key of the organization as revoked, so it can no longer be used
+func RevokeAPIKey(organizationID int, apiKeyID string) (*APIKey, error) {
+	var apiKey APIKey
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", organizationID).First(&apiKey, "id = ?", apiKeyID).Error; err != nil {
+			return err
+		}
+
+		if apiKey.RevokedAt != nil {
+			return nil
+		}
+
+		now := time.Now().UTC()
+		apiKey.RevokedAt = &now
+		return tx.Model(&apiKey).Update("revoked_at", now).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiKey, nil
+}
+
+// Loads the API key matching the given key, as long as it is neither revoked nor expired.
+// Also records when the key was last used.
+func GetActiveAPIKey(key string) (*APIKey, error) {
+	var apiKey APIKey
+
+	tx := DBInstance.Session(&gorm.Session{})
+	now := time.Now().UTC()
+
+	if err := tx.Where("revoked_at IS NULL").
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		First(&apiKey, "key_hash = ?", HashAPIKey(key)).Error; err != nil {
+		return nil, err
+	}
+
+	// The key is valid either way, so failing to record its use does not fail the request
+	if err := tx.Model(&apiKey).UpdateColumn("last_used_at", now).Error; err != nil {
+		fmt.Printf("Error recording API key use: %v\n", err)
+	}
+
+	return &apiKey, nil
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Soft deletes a service of the organization, along with all its non-deleted versions.
+// The versions are marked with the same deletion timestamp as the service, so restoring the service
+// brings back exactly the versions deleted along with it.
+func DeleteService(organizationID int, serviceID string) error {
+	return DBInstance.Transaction(func(tx *gorm.DB) error {
+		var service Service
+		if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).First(&service, "id = ?", serviceID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+
+		if err := tx.Model(&Version{}).Where("service_id = ? AND deleted_at IS NULL", serviceID).Update("deleted_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&service).Update("deleted_at", now).Error
+	})
+}
+
+// Restores a soft deleted service of the organization, along with the versions deleted along with it.
+// Returns a DuplicateNameError if another service of the organization has taken its name in the meantime.
+func RestoreService(organizationID int, serviceID string) (*Service, error) {
+	var service Service
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("deleted_at IS NOT NULL").Where("organization_id = ?", organizationID).First(&service, "id = ?", serviceID).Error; err != nil {
+			return err
+		}
+
+		if err := checkServiceNameAvailable(tx, organizationID, service.Name, service.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&Version{}).Where("service_id = ? AND deleted_at = ?", serviceID, service.DeletedAt).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+
+		service.DeletedAt = nil
+		return tx.Model(&service).Update("deleted_at", nil).Error
+	})
+
+	if err != nil {
+		return nil, translateUniqueNameError(err, "service", service.Name)
+	}
+
+	return &service, nil
+}
+
+// Soft deletes a version of a non-deleted service of the organization, and decrements the version count of the service.
+func DeleteVersion(organizationID int, serviceID string, versionID string) error {
+	return DBInstance.Transaction(func(tx *gorm.DB) error {
+		var version Version
+		if err := activeVersionQuery(tx, organizationID, serviceID).Where("versions.deleted_at IS NULL").First(&version, "versions.id = ?", versionID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&version).Update("deleted_at", time.Now().UTC()).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&Service{}).
+			Where("id = ?", serviceID).
+			Update("version_count", gorm.Expr("version_count - ?", 1)).
+			Error
+	})
+}
+
+// Restores a soft deleted version of a non-deleted service of the organization, and increments the version count of the service.
+// Returns a DuplicateNameError if another version of the service has taken its name in the meantime.
+func RestoreVersion(organizationID int, serviceID string, versionID string) (*Version, error) {
+	var version Version
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := activeVersionQuery(tx, organizationID, serviceID).Where("versions.deleted_at IS NOT NULL").First(&version, "versions.id = ?", versionID).Error; err != nil {
+			return err
+		}
+
+		if err := checkVersionNameAvailable(tx, serviceID, version.Name, version.ID); err != nil {
+			return err
+		}
+
+		var service Service
+		if err := tx.First(&service, "id = ?", serviceID).Error; err != nil {
+			return err
+		}
+
+		if service.VersioningScheme == VersioningSchemeSemver && version.SemverKey == "" {
+			return &InvalidVersionNameError{Names: []string{version.Name}}
+		}
+
+		version.DeletedAt = nil
+		if err := tx.Model(&version).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&Service{}).
+			Where("id = ?", serviceID).
+			Update("version_count", gorm.Expr("version_count + ?", 1)).
+			Error
+	})
+
+	if err != nil {
+		return nil, translateUniqueNameError(err, "version", version.Name)
+	}
+
+	return &version, nil
+}
+
+// Counts of rows removed by PurgeDeleted
+type PurgeResult struct {
+	PurgedServices int64
+	PurgedVersions int64
+}
+
+// Permanently removes the services and versions of the organization which were soft deleted before the cutoff.
+// Versions of purged services are removed as well.
+func PurgeDeleted(organizationID int, cutoff time.Time) (*PurgeResult, error) {
+	result := &PurgeResult{}
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		purgedServiceIDs := tx.Model(&Service{}).Select("id").
+			Where("organization_id = ? AND deleted_at IS NOT NULL AND deleted_at < ?", organizationID, cutoff)
+
+		purgedVersionIDs := tx.Model(&Version{}).Select("id").
+			Where("organization_id = ?", organizationID).
+			Where("(deleted_at IS NOT NULL AND deleted_at < ?) OR service_id IN (?)", cutoff, purgedServiceIDs)
+
+		// Deployments, approvals and promotions of purged versions go along with them
+		for _, model := range []interface{}{&Deployment{}, &VersionApproval{}, &Promotion{}} {
+			if err := tx.Where("version_id IN (?) OR service_id IN (?)", purgedVersionIDs, purgedServiceIDs).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		versions := tx.Where("organization_id = ?", organizationID).
+			Where("(deleted_at IS NOT NULL AND deleted_at < ?) OR service_id IN (?)", cutoff, purgedServiceIDs).
+			Delete(&Version{})
+		if versions.Error != nil {
+			return versions.Error
+		}
+		result.PurgedVersions = versions.RowsAffected
+
+		if err := tx.Where("service_id IN (?)", purgedServiceIDs).Delete(&ServiceRoleAssignment{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("service_id IN (?)", purgedServiceIDs).Delete(&ServiceLabel{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("service_id IN (?)", purgedServiceIDs).Delete(&ServiceOwnership{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("service_id IN (?)", purgedServiceIDs).Delete(&ServiceLink{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("service_id IN (?) OR depends_on_service_id IN (?)", purgedServiceIDs, purgedServiceIDs).Delete(&ServiceDependency{}).Error; err != nil {
+			return err
+		}
+
+		services := tx.Where("organization_id = ? AND deleted_at IS NOT NULL AND deleted_at < ?", organizationID, cutoff).Delete(&Service{})
+		if services.Error != nil {
+			return services.Error
+		}
+		result.PurgedServices = services.RowsAffected
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,244 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Directions a dependency graph can be walked in from a service
+const (
+	DependencyUpstream   = "upstream"   // The services it depends on, and the services those depend on
+	DependencyDownstream = "downstream" // The services depending on it, and the services depending on those
+	DependencyBoth       = "both"       // Both upstream and downstream - only supported for graph exports
+)
+
+// ServiceDependency records that a Service depends on another service of the same organization,
+// optionally pinned to a range of its versions. Dependencies never form a cycle.
+type ServiceDependency struct {
+	ID                 string    `gorm:"primaryKey;type:char(36)"` // ULID as the primary key
+	ServiceID          string    `gorm:"type:char(36);not null;uniqueIndex:idx_service_dependency"`
+	DependsOnServiceID string    `gorm:"type:char(36);not null;uniqueIndex:idx_service_dependency;index"`
+	OrganizationID     int       `gorm:"type:int;not null"`
+	VersionRange       string    `gorm:"type:varchar(256)"` // Semantic version range of the service depended on, like ^1.2.0 - empty for any version
+	CreatedAt          time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt          time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// BeforeCreate GORM hook to generate a ULID before inserting a new dependency
+func (d *ServiceDependency) BeforeCreate(tx *gorm.DB) (err error) {
+	d.ID = ulid.Make().String()
+	return
+}
+
+// DependencyNode is a service reached while walking the dependency graph
+type DependencyNode struct {
+	ID    string
+	Name  string
+	Depth int // Number of dependencies between the service and the service the walk started from
+}
+
+// DependencyGraph is the part of the dependency graph reached from a service
+type DependencyGraph struct {
+	Nodes []DependencyNode    // Services reached, ordered by depth and name - without the service the walk started from
+	Edges []ServiceDependency // Dependencies followed, between the services reached and the service the walk started from
+}
+
+// DependencyCycleError is returned when a new dependency would close a cycle in the dependency graph
+type DependencyCycleError struct {
+	Path []string // IDs of the services on the cycle, starting and ending with the service the dependency was added to
+}
+
+func (e *DependencyCycleError) Error() string {
+	return "the dependency would create a cycle: " + strings.Join(e.Path, " -> ")
+}
+
+// Returns true if the given string is a valid semantic version range, like ^1.2.0 or >=1.0.0 <2.0.0
+func IsValidVersionRange(versionRange string) bool {
+	_, err := semver.NewConstraint(versionRange)
+	return err == nil
+}
+
+// Makes a service depend on another service of the organization, or updates the version range of an existing dependency.
+// Returns gorm.ErrRecordNotFound if either service does not exist in the organization, and
+// a DependencyCycleError if the service depended on already depends on the service, directly or transitively.
+func SetServiceDependency(organizationID int, serviceID string, dependsOnServiceID string, versionRange string) (*ServiceDependency, error) {
+	var dependency ServiceDependency
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Service{}).Where("deleted_at IS NULL").Where("organization_id = ? AND id IN ?", organizationID, []string{serviceID, dependsOnServiceID}).Count(&count).Error; err != nil {
+			return err
+		}
+
+		if (serviceID == dependsOnServiceID && count != 1) || (serviceID != dependsOnServiceID && count != 2) {
+			return gorm.ErrRecordNotFound
+		}
+
+		// Adding service -> dependsOn closes a cycle if dependsOn already reaches service
+		path, err := findDependencyPath(tx, organizationID, dependsOnServiceID, serviceID)
+		if err != nil {
+			return err
+		}
+
+		if path != nil {
+			return &DependencyCycleError{Path: append([]string{serviceID}, path...)}
+		}
+
+		var existing []ServiceDependency
+		if err := tx.Where("service_id = ? AND depends_on_service_id = ?", serviceID, dependsOnServiceID).Limit(1).Find(&existing).Error; err != nil {
+			return err
+		}
+
+		if len(existing) == 0 {
+			dependency = ServiceDependency{ServiceID: serviceID, DependsOnServiceID: dependsOnServiceID, OrganizationID: organizationID, VersionRange: versionRange}
+			return tx.Create(&dependency).Error
+		}
+
+		dependency = existing[0]
+		dependency.VersionRange = versionRange
+		dependency.UpdatedAt = time.Now().UTC()
+		return tx.Model(&dependency).Select("version_range", "updated_at").Updates(&dependency).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &dependency, nil
+}
+
+// Removes the dependency of a non-deleted service of the organization on another service
+func DeleteServiceDependency(organizationID int, serviceID string, dependsOnServiceID string) error {
+	return DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).First(&Service{}, "id = ?", serviceID).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("organization_id = ? AND service_id = ? AND depends_on_service_id = ?", organizationID, serviceID, dependsOnServiceID).Delete(&ServiceDependency{})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
+
+// Finds the dependencies leading from one service to another - the IDs of the services on the way, starting with
+// from and ending with to, or nil if to can't be reached. Dependencies of soft deleted services are followed as well,
+// so restoring a service never brings back a cycle.
+func findDependencyPath(tx *gorm.DB, organizationID int, from string, to string) ([]string, error) {
+	previous := map[string]string{from: ""}
+	frontier := []string{from}
+
+	for len(frontier) > 0 {
+		if _, found := previous[to]; found {
+			break
+		}
+
+		var edges []ServiceDependency
+		if err := tx.Select("service_id", "depends_on_service_id").Where("organization_id = ? AND service_id IN ?", organizationID, frontier).Find(&edges).Error; err != nil {
+			return nil, err
+		}
+
+		frontier = nil
+		for _, edge := range edges {
+			if _, seen := previous[edge.DependsOnServiceID]; !seen {
+				previous[edge.DependsOnServiceID] = edge.ServiceID
+				frontier = append(frontier, edge.DependsOnServiceID)
+			}
+		}
+	}
+
+	if _, found := previous[to]; !found {
+		return nil, nil
+	}
+
+	path := []string{to}
+	for current := to; current != from; {
+		current = previous[current]
+		path = append([]string{current}, path...)
+	}
+
+	return path, nil
+}
+
+// Walks the dependency graph from a non-deleted service of the organization in the given direction, up to maxDepth
+// dependencies away - or as far as it goes, if maxDepth is 0. Soft deleted services, and their dependencies, are left out.
+// Returns gorm.ErrRecordNotFound if the service does not exist in the organization.
+func GetServiceDependencies(organizationID int, serviceID string, direction string, maxDepth int) (*DependencyGraph, error) {
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).First(&Service{}, "id = ?", serviceID).Error; err != nil {
+		return nil, err
+	}
+
+	return walkDependencies(tx, organizationID, []string{serviceID}, direction, maxDepth)
+}
+
+// Loads the services which break if a service goes down - all the services depending on it, directly or transitively
+func GetServiceBlastRadius(organizationID int, serviceID string) (*DependencyGraph, error) {
+	return GetServiceDependencies(organizationID, serviceID, DependencyDownstream, 0)
+}
+
+// Walks the dependency graph breadth first from the given services, one level per query
+func walkDependencies(tx *gorm.DB, organizationID int, roots []string, direction string, maxDepth int) (*DependencyGraph, error) {
+	from, to := "service_id", "depends_on_service_id"
+	if direction == DependencyDownstream {
+		from, to = to, from
+	} else if direction != DependencyUpstream {
+		return nil, fmt.Errorf("unsupported dependency direction %q", direction)
+	}
+
+	graph := &DependencyGraph{Nodes: []DependencyNode{}, Edges: []ServiceDependency{}}
+	depths := map[string]int{}
+	for _, root := range roots {
+		depths[root] = 0
+	}
+
+	frontier := roots
+	for depth := 1; len(frontier) > 0 && (maxDepth == 0 || depth <= maxDepth); depth++ {
+		var rows []struct {
+			ServiceDependency
+			Name string
+		}
+
+		err := tx.Model(&ServiceDependency{}).
+			Select("service_dependencies.*, services.name AS name").
+			Joins("JOIN services ON services.id = service_dependencies."+to).
+			Where("service_dependencies.organization_id = ? AND service_dependencies."+from+" IN ?", organizationID, frontier).
+			Where("services.deleted_at IS NULL").
+			Order("services.name").Order("service_dependencies.id").
+			Scan(&rows).Error
+
+		if err != nil {
+			return nil, err
+		}
+
+		frontier = nil
+		for _, row := range rows {
+			graph.Edges = append(graph.Edges, row.ServiceDependency)
+
+			next := row.DependsOnServiceID
+			if direction == DependencyDownstream {
+				next = row.ServiceID
+			}
+
+			if _, seen := depths[next]; !seen {
+				depths[next] = depth
+				graph.Nodes = append(graph.Nodes, DependencyNode{ID: next, Name: row.Name, Depth: depth})
+				frontier = append(frontier, next)
+			}
+		}
+	}
+
+	return graph, nil
+}
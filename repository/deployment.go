@@ -0,0 +1,299 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Statuses of a deployment
+const (
+	DeploymentInProgress = "in_progress" // The version is being rolled out
+	DeploymentSucceeded  = "succeeded"   // The version runs in the environment
+	DeploymentFailed     = "failed"      // The rollout did not finish, and the previous version still runs
+)
+
+// Deployment records a Version of a Service being deployed to an Environment, by a User
+type Deployment struct {
+	ID               string     `gorm:"primaryKey;type:char(36)"` // ULID as the primary key
+	OrganizationID   int        `gorm:"type:int;not null"`
+	ServiceID        string     `gorm:"type:char(36);not null;index:idx_deployments_service_environment"`
+	EnvironmentID    string     `gorm:"type:char(36);not null;index:idx_deployments_service_environment;index"`
+	VersionID        string     `gorm:"type:char(36);not null;index"`
+	Status           string     `gorm:"type:varchar(16);not null"` // in_progress, succeeded or failed
+	UserID           int        `gorm:"type:int;not null"`         // User who deployed the version
+	DeployedAt       time.Time  `gorm:"not null"`                  // When the deployment started
+	FinishedAt       *time.Time `gorm:"default null"`              // When the deployment succeeded or failed, nil while in progress
+	FinishRecordedAt *time.Time `gorm:"default null"`              // When the server recorded the deployment finishing. Unlike FinishedAt, it can't be backdated by clients.
+	RollbackOfID     string     `gorm:"type:char(36);index"`       // Successful deployment this one rolls back, empty for regular deployments
+	CreatedAt        time.Time  `gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt        time.Time  `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// BeforeCreate GORM hook to generate a ULID before inserting a new deployment
+func (d *Deployment) BeforeCreate(tx *gorm.DB) (err error) {
+	d.ID = ulid.Make().String()
+	return
+}
+
+// DeploymentDetails is a deployment, along with the names of what was deployed where
+type DeploymentDetails struct {
+	Deployment
+	ServiceName     string
+	VersionName     string
+	EnvironmentName string
+}
+
+// EnvironmentDeployment is the version of a service currently deployed to an environment
+type EnvironmentDeployment struct {
+	Environment Environment
+	Current     *DeploymentDetails // Latest successful deployment to the environment, nil if the service was never deployed there
+}
+
+// DeploymentNotAllowedError is returned when a version can't be deployed, or a deployment can't change status
+type DeploymentNotAllowedError struct {
+	Reason string
+}
+
+func (e *DeploymentNotAllowedError) Error() string {
+	return e.Reason
+}
+
+// Returns true if the given string is one of the deployment statuses
+func IsValidDeploymentStatus(status string) bool {
+	return status == DeploymentInProgress || status == DeploymentSucceeded || status == DeploymentFailed
+}
+
+// Records a deployment of a non-deleted version of a service of the organization to one of its environments.
+// Finished deployments get their deployment time as the finish time.
+// A rollback must roll back a successful deployment of the service to the same environment, with a different version.
+// Returns gorm.ErrRecordNotFound if the version, environment or rolled back deployment does not exist in the organization,
+// and a DeploymentNotAllowedError if the version is yanked or retired, or the rollback is not allowed.
+func CreateDeployment(deployment *Deployment) (*DeploymentDetails, error) {
+	var details *DeploymentDetails
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		var err error
+		details, err = createDeployment(tx, deployment)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return details, nil
+}
+
+// Records a deployment within an open transaction - shared with promotions, which deploy the promoted version
+func createDeployment(tx *gorm.DB, deployment *Deployment) (*DeploymentDetails, error) {
+	var version Version
+	if err := activeVersionQuery(tx, deployment.OrganizationID, deployment.ServiceID).Where("versions.deleted_at IS NULL").First(&version, "versions.id = ?", deployment.VersionID).Error; err != nil {
+		return nil, err
+	}
+
+	if version.State == VersionStateYanked || version.State == VersionStateRetired {
+		return nil, &DeploymentNotAllowedError{Reason: fmt.Sprintf("version %s is %s, and can not be deployed", version.Name, version.State)}
+	}
+
+	if err := tx.Where("organization_id = ?", deployment.OrganizationID).First(&Environment{}, "id = ?", deployment.EnvironmentID).Error; err != nil {
+		return nil, err
+	}
+
+	if deployment.RollbackOfID != "" {
+		if err := checkRollback(tx, deployment); err != nil {
+			return nil, err
+		}
+	}
+
+	if deployment.Status != DeploymentInProgress {
+		finishedAt := deployment.DeployedAt
+		finishRecordedAt := time.Now().UTC()
+		deployment.FinishedAt = &finishedAt
+		deployment.FinishRecordedAt = &finishRecordedAt
+	}
+
+	if err := tx.Create(deployment).Error; err != nil {
+		return nil, err
+	}
+
+	return deploymentDetails(tx, deployment.OrganizationID, deployment.ServiceID, deployment.ID)
+}
+
+// Checks that a deployment can roll back the deployment it refers to
+func checkRollback(tx *gorm.DB, deployment *Deployment) error {
+	var rolledBack Deployment
+	if err := tx.Where("organization_id = ? AND service_id = ? AND environment_id = ?", deployment.OrganizationID, deployment.ServiceID, deployment.EnvironmentID).
+		First(&rolledBack, "id = ?", deployment.RollbackOfID).Error; err != nil {
+		return err
+	}
+
+	if rolledBack.Status != DeploymentSucceeded {
+		return &DeploymentNotAllowedError{Reason: fmt.Sprintf("only successful deployments can be rolled back, the deployment %s", rolledBack.Status)}
+	}
+
+	if rolledBack.VersionID == deployment.VersionID {
+		return &DeploymentNotAllowedError{Reason: "a rollback must deploy a different version than the one it rolls back"}
+	}
+
+	var existing []Deployment
+	if err := tx.Where("rollback_of_id = ? AND status <> ?", rolledBack.ID, DeploymentFailed).Limit(1).Find(&existing).Error; err != nil {
+		return err
+	}
+
+	if len(existing) > 0 {
+		return &DeploymentNotAllowedError{Reason: fmt.Sprintf("the deployment is already rolled back by deployment %s", existing[0].ID)}
+	}
+
+	return nil
+}
+
+// Finishes an in-progress deployment of a service of the organization, as succeeded or failed.
+// Returns gorm.ErrRecordNotFound if the deployment does not exist, and a DeploymentNotAllowedError if it already finished.
+func FinishDeployment(organizationID int, serviceID string, deploymentID string, status string) (*DeploymentDetails, error) {
+	var details *DeploymentDetails
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		var deployment Deployment
+		if err := tx.Where("organization_id = ? AND service_id = ?", organizationID, serviceID).First(&deployment, "id = ?", deploymentID).Error; err != nil {
+			return err
+		}
+
+		if deployment.Status != DeploymentInProgress {
+			return &DeploymentNotAllowedError{Reason: fmt.Sprintf("the deployment already finished as %s", deployment.Status)}
+		}
+
+		if status != DeploymentSucceeded && status != DeploymentFailed {
+			return &DeploymentNotAllowedError{Reason: fmt.Sprintf("an in progress deployment can only finish as %s or %s", DeploymentSucceeded, DeploymentFailed)}
+		}
+
+		now := time.Now().UTC()
+		if err := tx.Model(&deployment).Updates(map[string]interface{}{"status": status, "finished_at": now, "finish_recorded_at": now, "updated_at": now}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		details, err = deploymentDetails(tx, organizationID, serviceID, deploymentID)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return details, nil
+}
+
+// Query for deployments along with the names of their service, version and environment
+func deploymentDetailsQuery(tx *gorm.DB, organizationID int) *gorm.DB {
+	return tx.Model(&Deployment{}).
+		Select("deployments.*, services.name AS service_name, versions.name AS version_name, environments.name AS environment_name").
+		Joins("JOIN services ON services.id = deployments.service_id").
+		Joins("JOIN versions ON versions.id = deployments.version_id").
+		Joins("JOIN environments ON environments.id = deployments.environment_id").
+		Where("deployments.organization_id = ?", organizationID)
+}
+
+func deploymentDetails(tx *gorm.DB, organizationID int, serviceID string, deploymentID string) (*DeploymentDetails, error) {
+	var details DeploymentDetails
+
+	if err := deploymentDetailsQuery(tx, organizationID).Where("deployments.service_id = ? AND deployments.id = ?", serviceID, deploymentID).Take(&details).Error; err != nil {
+		return nil, err
+	}
+
+	return &details, nil
+}
+
+// Loads a single deployment of a service of the organization
+func GetDeployment(organizationID int, serviceID string, deploymentID string) (*DeploymentDetails, error) {
+	return deploymentDetails(DBInstance.Session(&gorm.Session{}), organizationID, serviceID, deploymentID)
+}
+
+// Loads the deployment history of a service of the organization, newest first - optionally only to one environment
+func GetServiceDeployments(organizationID int, serviceID string, environmentID string, pageSize int, pageNo int) ([]DeploymentDetails, error) {
+	deployments := []DeploymentDetails{}
+
+	tx := deploymentDetailsQuery(DBInstance.Session(&gorm.Session{}), organizationID).Where("deployments.service_id = ?", serviceID)
+	if environmentID != "" {
+		tx = tx.Where("deployments.environment_id = ?", environmentID)
+	}
+
+	err := tx.Order("julianday(deployments.deployed_at) desc").Order("deployments.id desc").
+		Offset((pageNo - 1) * pageSize).Limit(pageSize).
+		Scan(&deployments).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return deployments, nil
+}
+
+// Query for the last deployment of each service to each environment to succeed - what currently runs there.
+// Deployments are ordered by when they finished, as a long rollout can finish after a later one.
+func currentDeploymentsQuery(tx *gorm.DB, organizationID int) *gorm.DB {
+	latest := tx.Model(&Deployment{}).
+		Select("id, ROW_NUMBER() OVER (PARTITION BY service_id, environment_id ORDER BY julianday(finished_at) DESC, id DESC) AS position").
+		Where("organization_id = ? AND status = ?", organizationID, DeploymentSucceeded)
+
+	return deploymentDetailsQuery(tx, organizationID).
+		Where("deployments.id IN (?)", tx.Table("(?) AS latest", latest).Select("id").Where("position = 1"))
+}
+
+// Loads what is currently deployed of a non-deleted service of the organization, to each of the organization's environments.
+// Returns gorm.ErrRecordNotFound if the service does not exist in the organization.
+func GetServiceCurrentDeployments(organizationID int, serviceID string) ([]EnvironmentDeployment, error) {
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).First(&Service{}, "id = ?", serviceID).Error; err != nil {
+		return nil, err
+	}
+
+	environments, err := GetEnvironments(organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var current []DeploymentDetails
+	if err := currentDeploymentsQuery(tx, organizationID).Where("deployments.service_id = ?", serviceID).Scan(&current).Error; err != nil {
+		return nil, err
+	}
+
+	byEnvironment := map[string]*DeploymentDetails{}
+	for i := range current {
+		byEnvironment[current[i].EnvironmentID] = &current[i]
+	}
+
+	result := make([]EnvironmentDeployment, len(environments))
+	for i, environment := range environments {
+		result[i] = EnvironmentDeployment{Environment: environment, Current: byEnvironment[environment.ID]}
+	}
+
+	return result, nil
+}
+
+// Loads what is currently deployed to an environment of the organization - the version of each non-deleted service, ordered by service name
+func GetEnvironmentCurrentDeployments(organizationID int, environmentID string) ([]DeploymentDetails, error) {
+	current := []DeploymentDetails{}
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	err := currentDeploymentsQuery(tx, organizationID).
+		Where("deployments.environment_id = ? AND services.deleted_at IS NULL", environmentID).
+		Order("services.name").
+		Scan(&current).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return current, nil
+}
+
+// Fills in when finished deployments created before it was recorded were recorded as finished.
+// Their last update is the closest time the server set - their finish time may have been backdated.
+func backfillDeploymentFinishRecordedAt(db *gorm.DB) error {
+	return db.Exec("UPDATE deployments SET finish_recorded_at = updated_at WHERE finished_at IS NOT NULL AND finish_recorded_at IS NULL").Error
+}
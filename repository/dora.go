@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DORAMetrics are the four DORA metrics of deployments to an environment, over a time window.
+// Metrics which can't be computed from the deployments in the window, like the lead time without successful deployments, are nil.
+type DORAMetrics struct {
+	Deployments              int      // Finished deployments in the window, not counting rollbacks
+	SuccessfulDeployments    int      // Deployments which succeeded, including the ones rolled back later
+	Rollbacks                int      // Finished rollbacks in the window
+	DeploymentsPerDay        float64  // Deployment frequency - successful deployments per day of the window
+	LeadTimeMedianHours      *float64 // Lead time for changes - median hours from creating a version to deploying it successfully
+	FailedChanges            int      // Deployments which failed, or succeeded and were rolled back
+	ChangeFailureRate        *float64 // Share of deployments which were failed changes, between 0 and 1
+	TimeToRestoreMedianHours *float64 // Median hours from a failed change to the next successful deployment of the service, for restored failures
+}
+
+// ServiceDORAMetrics are the DORA metrics of a single service, as part of an organization rollup
+type ServiceDORAMetrics struct {
+	ServiceID   string
+	ServiceName string
+	Metrics     DORAMetrics
+}
+
+// OrganizationDORAMetrics are the DORA metrics across all services of an organization, along with the metrics of
+// each service deployed in the window
+type OrganizationDORAMetrics struct {
+	Metrics  DORAMetrics
+	Services []ServiceDORAMetrics
+}
+
+// A deployment, along with what the metrics need from its service and version
+type doraDeployment struct {
+	Deployment
+	ServiceName      string
+	VersionCreatedAt time.Time
+}
+
+// Loads the environment DORA metrics are computed for by default - the last environment of the organization's pipeline.
+// Returns gorm.ErrRecordNotFound if the organization has no pipeline.
+func GetProductionEnvironment(organizationID int) (*Environment, error) {
+	var environment Environment
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("organization_id = ? AND pipeline_position IS NOT NULL", organizationID).Order("pipeline_position desc").First(&environment).Error; err != nil {
+		return nil, err
+	}
+
+	return &environment, nil
+}
+
+// Computes the DORA metrics of a non-deleted service of the organization, for its deployments to an environment since the window start.
+// Returns gorm.ErrRecordNotFound if the service does not exist in the organization.
+func GetServiceDORAMetrics(organizationID int, serviceID string, environmentID string, windowStart time.Time) (*DORAMetrics, error) {
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).First(&Service{}, "id = ?", serviceID).Error; err != nil {
+		return nil, err
+	}
+
+	deployments, err := loadDORADeployments(tx.Where("deployments.service_id = ?", serviceID), organizationID, environmentID, windowStart)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := computeDORAMetrics(deployments, windowStart, time.Now().UTC())
+	return &metrics, nil
+}
+
+// Computes the DORA metrics across the non-deleted services of the organization, for their deployments to an environment
+// since the window start, along with the metrics of each service deployed in the window, ordered by service name
+func GetOrganizationDORAMetrics(organizationID int, environmentID string, windowStart time.Time) (*OrganizationDORAMetrics, error) {
+	tx := DBInstance.Session(&gorm.Session{})
+
+	deployments, err := loadDORADeployments(tx.Where("services.deleted_at IS NULL"), organizationID, environmentID, windowStart)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	result := &OrganizationDORAMetrics{Metrics: computeDORAMetrics(deployments, windowStart, now), Services: []ServiceDORAMetrics{}}
+
+	byService := map[string][]doraDeployment{}
+	for _, deployment := range deployments {
+		byService[deployment.ServiceID] = append(byService[deployment.ServiceID], deployment)
+	}
+
+	for serviceID, serviceDeployments := range byService {
+		result.Services = append(result.Services, ServiceDORAMetrics{
+			ServiceID:   serviceID,
+			ServiceName: serviceDeployments[0].ServiceName,
+			Metrics:     computeDORAMetrics(serviceDeployments, windowStart, now),
+		})
+	}
+
+	sort.Slice(result.Services, func(i, j int) bool {
+		return result.Services[i].ServiceName < result.Services[j].ServiceName
+	})
+
+	return result, nil
+}
+
+// Loads the deployments to an environment of the organization since the window start, oldest first
+func loadDORADeployments(tx *gorm.DB, organizationID int, environmentID string, windowStart time.Time) ([]doraDeployment, error) {
+	var deployments []doraDeployment
+
+	err := tx.Model(&Deployment{}).
+		Select("deployments.*, services.name AS service_name, versions.created_at AS version_created_at").
+		Joins("JOIN services ON services.id = deployments.service_id").
+		Joins("JOIN versions ON versions.id = deployments.version_id").
+		Where("deployments.organization_id = ? AND deployments.environment_id = ?", organizationID, environmentID).
+		Where("julianday(deployments.deployed_at) >= julianday(?)", formatStoredTimestamp(windowStart)).
+		Order("julianday(deployments.deployed_at)").Order("deployments.id").
+		Scan(&deployments).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return deployments, nil
+}
+
+// Computes the DORA metrics of deployments, sorted oldest first.
+// Rollbacks are not changes of their own - they mark the deployment they roll back as a failed change, and restore it.
+func computeDORAMetrics(deployments []doraDeployment, windowStart time.Time, windowEnd time.Time) DORAMetrics {
+	var metrics DORAMetrics
+	var leadTimes, restoreTimes []float64
+
+	rollbacks := map[string]*doraDeployment{}
+	for i := range deployments {
+		if deployments[i].RollbackOfID != "" && deployments[i].Status == DeploymentSucceeded {
+			rollbacks[deployments[i].RollbackOfID] = &deployments[i]
+		}
+	}
+
+	for i, deployment := range deployments {
+		if deployment.FinishedAt == nil {
+			continue
+		}
+
+		if deployment.RollbackOfID != "" {
+			metrics.Rollbacks++
+			continue
+		}
+
+		metrics.Deployments++
+
+		if deployment.Status == DeploymentSucceeded {
+			metrics.SuccessfulDeployments++
+			leadTimes = append(leadTimes, deployment.FinishedAt.Sub(deployment.VersionCreatedAt).Hours())
+
+			rollback, rolledBack := rollbacks[deployment.ID]
+			if !rolledBack {
+				continue
+			}
+
+			metrics.FailedChanges++
+			restoreTimes = append(restoreTimes, rollback.FinishedAt.Sub(*deployment.FinishedAt).Hours())
+			continue
+		}
+
+		// A failed deployment is restored by the next successful deployment of the service
+		metrics.FailedChanges++
+		for _, next := range deployments[i+1:] {
+			if next.ServiceID == deployment.ServiceID && next.Status == DeploymentSucceeded && next.FinishedAt != nil && next.FinishedAt.After(*deployment.FinishedAt) {
+				restoreTimes = append(restoreTimes, next.FinishedAt.Sub(*deployment.FinishedAt).Hours())
+				break
+			}
+		}
+	}
+
+	if days := windowEnd.Sub(windowStart).Hours() / 24; days > 0 {
+		metrics.DeploymentsPerDay = roundMetric(float64(metrics.SuccessfulDeployments) / days)
+	}
+
+	metrics.LeadTimeMedianHours = median(leadTimes)
+	metrics.TimeToRestoreMedianHours = median(restoreTimes)
+
+	if metrics.Deployments > 0 {
+		rate := roundMetric(float64(metrics.FailedChanges) / float64(metrics.Deployments))
+		metrics.ChangeFailureRate = &rate
+	}
+
+	return metrics
+}
+
+// Returns the median of the values rounded to 2 decimals, or nil if there are none
+func median(values []float64) *float64 {
+	if len(values) == 0 {
+		return nil
+	}
+
+	sort.Float64s(values)
+
+	middle := len(values) / 2
+	result := values[middle]
+	if len(values)%2 == 0 {
+		result = (values[middle-1] + values[middle]) / 2
+	}
+
+	result = roundMetric(result)
+	return &result
+}
+
+func roundMetric(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Environments every organization starts with
+var defaultEnvironments = []Environment{
+	{Name: "dev", Description: "Development"},
+	{Name: "staging", Description: "Pre-production"},
+	{Name: "prod", Description: "Production"},
+}
+
+// Environment is a place versions of services are deployed to, like staging or prod.
+// Names are unique within an organization. Environments in the promotion pipeline have gates
+// a version must pass before it is promoted to them - see promotion.go.
+type Environment struct {
+	ID                string    `gorm:"primaryKey;type:char(36)"` // ULID as the primary key
+	OrganizationID    int       `gorm:"type:int;not null;uniqueIndex:idx_environments_organization_name"`
+	Name              string    `gorm:"type:varchar(63);not null;uniqueIndex:idx_environments_organization_name"`
+	Description       string    `gorm:"type:varchar(1024)"`
+	PipelinePosition  *int      `gorm:"default null"`       // Position in the promotion pipeline, starting at 1 - nil for environments outside of it
+	MinSoakMinutes    int       `gorm:"not null;default:0"` // Minutes a version must have run in the previous environment before it is promoted here
+	RequiredApprovals int       `gorm:"not null;default:0"` // Approvals a version needs before it is promoted here
+	CreatedAt         time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt         time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// BeforeCreate GORM hook to generate a ULID before inserting a new environment
+func (e *Environment) BeforeCreate(tx *gorm.DB) (err error) {
+	e.ID = ulid.Make().String()
+	return
+}
+
+// Environment names are lowercase letters, digits and "-", like prod or eu-staging
+var environmentNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// Returns true if the given string is a valid environment name
+func IsValidEnvironmentName(name string) bool {
+	return environmentNamePattern.MatchString(name)
+}
+
+// Creates the default environments, as a pipeline from dev to prod
+func createDefaultEnvironments(tx *gorm.DB, organizationID int) error {
+	environments := make([]Environment, len(defaultEnvironments))
+	for i, environment := range defaultEnvironments {
+		position := i + 1
+		environments[i] = Environment{OrganizationID: organizationID, Name: environment.Name, Description: environment.Description, PipelinePosition: &position}
+	}
+	return tx.Create(&environments).Error
+}
+
+// Gives the organizations created before environments existed the default environments
+func backfillDefaultEnvironments(db *gorm.DB) error {
+	var organizationIDs []int
+
+	if err := db.Model(&Organization{}).Where("id NOT IN (?)", db.Model(&Environment{}).Select("organization_id")).Pluck("id", &organizationIDs).Error; err != nil {
+		return err
+	}
+
+	for _, organizationID := range organizationIDs {
+		if err := createDefaultEnvironments(db, organizationID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Creates an environment in the organization.
+// Returns a DuplicateNameError if the organization already has an environment with the same name.
+func CreateEnvironment(environment *Environment) (*Environment, error) {
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		var existing []Environment
+		if err := tx.Where("organization_id = ? AND name = ?", environment.OrganizationID, environment.Name).Limit(1).Find(&existing).Error; err != nil {
+			return err
+		}
+
+		if len(existing) > 0 {
+			return &DuplicateNameError{Resource: "environment", Name: environment.Name, ExistingID: existing[0].ID}
+		}
+
+		return tx.Create(environment).Error
+	})
+
+	if err != nil {
+		return nil, translateUniqueNameError(err, "environment", environment.Name)
+	}
+
+	return environment, nil
+}
+
+// Loads all environments of an organization in pipeline order, followed by the environments outside of the pipeline, oldest first
+func GetEnvironments(organizationID int) ([]Environment, error) {
+	var environments []Environment
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("organization_id = ?", organizationID).Order("pipeline_position IS NULL").Order("pipeline_position").Order("id").Find(&environments).Error; err != nil {
+		return nil, err
+	}
+
+	return environments, nil
+}
+
+// Loads a single environment by ID, from the given organization.
+// Environments of other organizations are treated as not found.
+func GetEnvironmentByID(organizationID int, environmentID string) (*Environment, error) {
+	var environment Environment
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("organization_id = ?", organizationID).First(&environment, "id = ?", environmentID).Error; err != nil {
+		return nil, err
+	}
+
+	return &environment, nil
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Operators supported in filter conditions
+const (
+	FilterEqual          = "="
+	FilterNotEqual       = "!="
+	FilterGreater        = ">"
+	FilterGreaterOrEqual = ">="
+	FilterLess           = "<"
+	FilterLessOrEqual    = "<="
+	FilterLike           = "~"     // Matches a pattern, where * matches any characters
+	FilterNotLike        = "!~"    // Does not match a pattern
+	FilterIn             = "=in="  // Equal to one of the values
+	FilterNotIn          = "=out=" // Not equal to any of the values
+)
+
+var filterOperatorSQL = map[string]string{
+	FilterEqual:          "=",
+	FilterNotEqual:       "<>",
+	FilterGreater:        ">",
+	FilterGreaterOrEqual: ">=",
+	FilterLess:           "<",
+	FilterLessOrEqual:    "<=",
+	FilterLike:           "LIKE",
+	FilterNotLike:        "NOT LIKE",
+	FilterIn:             "IN",
+	FilterNotIn:          "NOT IN",
+}
+
+// FilterExpression is a tree of conditions on the columns of a table - either a single condition,
+// or a group of expressions which must all (And) or any (Or) match.
+// Column names must be whitelisted by the caller, while values are always passed as query parameters.
+type FilterExpression struct {
+	Column   string        // Column the condition applies to
+	Key      string        // Top-level key of the JSON object in the column the condition applies to, if any
+	Operator string        // One of the Filter operators
+	Values   []interface{} // Value to compare with - or values, for the IN operators. Times are compared as points in time.
+	And      []FilterExpression
+	Or       []FilterExpression
+}
+
+// Builds the GORM clause for the expression
+func (f FilterExpression) Clause() (clause.Expression, error) {
+	if len(f.And) > 0 || len(f.Or) > 0 {
+		children := f.And
+		if len(f.Or) > 0 {
+			children = f.Or
+		}
+
+		expressions := make([]clause.Expression, 0, len(children))
+		for _, child := range children {
+			expression, err := child.Clause()
+			if err != nil {
+				return nil, err
+			}
+			expressions = append(expressions, expression)
+		}
+
+		if len(f.Or) > 0 {
+			return clause.Or(expressions...), nil
+		}
+		return clause.And(expressions...), nil
+	}
+
+	operator, ok := filterOperatorSQL[f.Operator]
+	if !ok {
+		return nil, fmt.Errorf("unsupported filter operator %q", f.Operator)
+	}
+
+	if len(f.Values) == 0 {
+		return nil, fmt.Errorf("missing value for filter on %s", f.Column)
+	}
+
+	var column interface{} = clause.Column{Name: f.Column}
+
+	// Conditions on a key of a JSON column compare the value extracted from the JSON - services without the key never match
+	if f.Key != "" {
+		column = clause.Expr{SQL: "json_extract(?, ?)", Vars: []interface{}{column, `$."` + f.Key + `"`}}
+	}
+
+	// Timestamps are stored as text with a timezone offset, so they are compared as julian days instead
+	if _, isTime := f.Values[0].(time.Time); isTime {
+		if f.Operator == FilterIn || f.Operator == FilterNotIn || f.Operator == FilterLike || f.Operator == FilterNotLike {
+			return nil, fmt.Errorf("filter operator %q is not supported for times", f.Operator)
+		}
+		return clause.Expr{SQL: "julianday(?) " + operator + " julianday(?)", Vars: []interface{}{column, f.Values[0]}}, nil
+	}
+
+	switch f.Operator {
+	case FilterIn, FilterNotIn:
+		return clause.Expr{SQL: "? " + operator + " ?", Vars: []interface{}{column, f.Values}}, nil
+	case FilterLike, FilterNotLike:
+		pattern, ok := f.Values[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("filter pattern for %s must be a string", f.Column)
+		}
+		return clause.Expr{SQL: "? " + operator + " ? ESCAPE '\\'", Vars: []interface{}{column, likePattern(pattern)}}, nil
+	}
+
+	return clause.Expr{SQL: "? " + operator + " ?", Vars: []interface{}{column, f.Values[0]}}, nil
+}
+
+// Turns a pattern where * matches any characters into a LIKE pattern, escaping the LIKE wildcards
+func likePattern(pattern string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`, `*`, `%`)
+	return replacer.Replace(pattern)
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+)
+
+// GraphScope limits the part of the dependency graph of an organization which is loaded
+type GraphScope struct {
+	RootID    string             // Service the graph is walked from - empty for the whole graph
+	Direction string             // Direction the graph is walked in from the root - upstream, downstream or both
+	Depth     int                // Number of dependencies the graph is walked from the root, 0 for no limit
+	Labels    []LabelRequirement // Only services matching the label selector are included, other than the root
+}
+
+// GraphNode is a service in the dependency graph
+type GraphNode struct {
+	ID                 string
+	Name               string
+	DeprecatedVersions []string // Names of the non-deleted versions of the service in the deprecated state, ordered by name
+}
+
+// ServiceGraph is the dependency graph of the services of an organization, or a part of it
+type ServiceGraph struct {
+	Nodes []GraphNode         // Services, ordered by name
+	Edges []ServiceDependency // Dependencies between the services, ordered by the names of the services
+}
+
+// Loads the non-deleted services of an organization in the scope, along with the dependencies between them and their
+// deprecated versions. Returns gorm.ErrRecordNotFound if the root service does not exist in the organization.
+func GetServiceGraph(organizationID int, scope GraphScope) (*ServiceGraph, error) {
+	tx := DBInstance.Session(&gorm.Session{})
+
+	var reachedIDs []string
+	if scope.RootID != "" {
+		if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).First(&Service{}, "id = ?", scope.RootID).Error; err != nil {
+			return nil, err
+		}
+
+		reachedIDs = []string{scope.RootID}
+		for _, direction := range []string{DependencyUpstream, DependencyDownstream} {
+			if scope.Direction != DependencyBoth && scope.Direction != direction {
+				continue
+			}
+
+			reached, err := walkDependencies(tx, organizationID, []string{scope.RootID}, direction, scope.Depth)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, node := range reached.Nodes {
+				reachedIDs = append(reachedIDs, node.ID)
+			}
+		}
+	}
+
+	query := tx.Model(&Service{}).Select("id", "name").Where("deleted_at IS NULL AND organization_id = ?", organizationID)
+	if scope.RootID != "" {
+		query = query.Where("id IN ?", reachedIDs)
+	}
+
+	if len(scope.Labels) > 0 {
+		labelled, err := labelledServices(scope.Labels)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("(id IN (?) OR id = ?)", labelled.Select("services.id"), scope.RootID)
+	}
+
+	var services []Service
+	if err := query.Order("name").Order("id").Find(&services).Error; err != nil {
+		return nil, err
+	}
+
+	graph := &ServiceGraph{Nodes: make([]GraphNode, len(services)), Edges: []ServiceDependency{}}
+
+	ids := make([]string, len(services))
+	positions := map[string]int{}
+	for i, service := range services {
+		ids[i] = service.ID
+		positions[service.ID] = i
+		graph.Nodes[i] = GraphNode{ID: service.ID, Name: service.Name, DeprecatedVersions: []string{}}
+	}
+
+	if len(ids) == 0 {
+		return graph, nil
+	}
+
+	var versions []Version
+	if err := tx.Select("service_id", "name").
+		Where("organization_id = ? AND service_id IN ? AND state = ? AND deleted_at IS NULL", organizationID, ids, VersionStateDeprecated).
+		Order("name").
+		Find(&versions).Error; err != nil {
+		return nil, err
+	}
+
+	for _, version := range versions {
+		node := &graph.Nodes[positions[version.ServiceID]]
+		node.DeprecatedVersions = append(node.DeprecatedVersions, version.Name)
+	}
+
+	if err := tx.Select("service_dependencies.*").
+		Joins("JOIN services AS dependents ON dependents.id = service_dependencies.service_id").
+		Joins("JOIN services AS dependencies ON dependencies.id = service_dependencies.depends_on_service_id").
+		Where("service_dependencies.organization_id = ? AND service_dependencies.service_id IN ? AND service_dependencies.depends_on_service_id IN ?", organizationID, ids, ids).
+		Order("dependents.name").Order("dependencies.name").
+		Find(&graph.Edges).Error; err != nil {
+		return nil, err
+	}
+
+	return graph, nil
+}
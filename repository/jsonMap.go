@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// JSONMap is a JSON object stored in a text column, used for free form metadata.
+type JSONMap map[string]interface{}
+
+// Scan implements sql.Scanner, decoding the JSON stored in the column
+func (m *JSONMap) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("unsupported type %T for JSONMap", value)
+	}
+
+	if len(data) == 0 {
+		*m = nil
+		return nil
+	}
+
+	return json.Unmarshal(data, m)
+}
+
+// Value implements driver.Valuer, encoding the map as JSON
+func (m JSONMap) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
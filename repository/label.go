@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ServiceLabel is a key/value label on a Service, for example tier=1 or language=go.
+// Labels without a value work as tags. A service has at most one label with each key.
+type ServiceLabel struct {
+	ID             int       `gorm:"unique;primaryKey;autoIncrement"`
+	ServiceID      string    `gorm:"type:char(36);not null;uniqueIndex:idx_service_label"`
+	OrganizationID int       `gorm:"type:int;not null"`
+	Key            string    `gorm:"type:varchar(317);not null;uniqueIndex:idx_service_label;index:idx_service_label_key_value"`
+	Value          string    `gorm:"type:varchar(63);not null;default:'';index:idx_service_label_key_value"`
+	CreatedAt      time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt      time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// Label keys and values follow the Kubernetes syntax - a name of up to 63 letters, digits, "-", "_" and ".",
+// starting and ending with a letter or digit. Keys can have a DNS subdomain prefix, like example.com/tier.
+var (
+	labelNamePattern   = regexp.MustCompile(`^[A-Za-z0-9]([-_.A-Za-z0-9]{0,61}[A-Za-z0-9])?$`)
+	labelPrefixPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// Returns true if the given string is a valid label key, with an optional prefix
+func IsValidLabelKey(key string) bool {
+	if prefix, name, found := strings.Cut(key, "/"); found {
+		return len(prefix) <= 253 && labelPrefixPattern.MatchString(prefix) && labelNamePattern.MatchString(name)
+	}
+	return labelNamePattern.MatchString(key)
+}
+
+// Returns true if the given string is a valid label value. Values can be empty.
+func IsValidLabelValue(value string) bool {
+	return value == "" || labelNamePattern.MatchString(value)
+}
+
+// Operators of label selector requirements
+const (
+	LabelExists       = "exists" // The service has the label
+	LabelDoesNotExist = "!"      // The service does not have the label
+	LabelEquals       = "="      // The label has the value
+	LabelNotEquals    = "!="     // The label does not have the value, or the service does not have the label
+	LabelIn           = "in"     // The label has one of the values
+	LabelNotIn        = "notin"  // The label has none of the values, or the service does not have the label
+)
+
+// LabelRequirement is one condition of a label selector, like tier in (1,2). A service matches a selector
+// when it matches all of its requirements. Keys and values must be validated by the caller.
+type LabelRequirement struct {
+	Key      string
+	Operator string
+	Values   []string
+}
+
+// Joins the labels table to a query over services, so only services matching the requirement are left.
+// Requirements on the presence of a label use an inner join, and requirements on its absence a left join
+// to the labels which rule the service out - both served by the unique index on the service and key.
+func (requirement LabelRequirement) join(tx *gorm.DB, alias string) (*gorm.DB, error) {
+	on := fmt.Sprintf("service_labels AS %[1]s ON %[1]s.service_id = services.id AND %[1]s.key = ?", alias)
+	inValues := fmt.Sprintf(" AND %s.value IN ?", alias)
+
+	switch requirement.Operator {
+	case LabelExists:
+		return tx.Joins("JOIN "+on, requirement.Key), nil
+	case LabelEquals, LabelIn:
+		return tx.Joins("JOIN "+on+inValues, requirement.Key, requirement.Values), nil
+	case LabelDoesNotExist:
+		return tx.Joins("LEFT JOIN "+on, requirement.Key).Where(alias + ".id IS NULL"), nil
+	case LabelNotEquals, LabelNotIn:
+		return tx.Joins("LEFT JOIN "+on+inValues, requirement.Key, requirement.Values).Where(alias + ".id IS NULL"), nil
+	}
+
+	return nil, fmt.Errorf("unsupported label operator %q", requirement.Operator)
+}
+
+// Query for the services matching all the label requirements, to select from instead of the services table
+func labelledServices(selector []LabelRequirement) (*gorm.DB, error) {
+	tx := DBInstance.Session(&gorm.Session{}).Table("services").Select("services.*")
+
+	for i, requirement := range selector {
+		var err error
+		if tx, err = requirement.join(tx, fmt.Sprintf("label_%d", i)); err != nil {
+			return nil, err
+		}
+	}
+
+	return tx, nil
+}
+
+// Loads the labels of a service, ordered by key
+func GetServiceLabels(organizationID int, serviceID string) ([]ServiceLabel, error) {
+	var labels []ServiceLabel
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("organization_id = ? AND service_id = ?", organizationID, serviceID).Order("key").Find(&labels).Error; err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+// Creates or replaces the label with the given key on a non-deleted service of the organization.
+// Returns gorm.ErrRecordNotFound if the service does not exist in the organization.
+func SetServiceLabel(organizationID int, serviceID string, key string, value string) (*ServiceLabel, error) {
+	label := ServiceLabel{ServiceID: serviceID, OrganizationID: organizationID, Key: key, Value: value}
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).First(&Service{}, "id = ?", serviceID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "service_id"}, {Name: "key"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"value": value, "updated_at": time.Now().UTC()}),
+		}).Create(&label).Error; err != nil {
+			return err
+		}
+
+		// Reload the label, since an existing label keeps its ID and creation time
+		return tx.Where("service_id = ? AND key = ?", serviceID, key).First(&label).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &label, nil
+}
+
+// Removes the label with the given key from a non-deleted service of the organization
+func DeleteServiceLabel(organizationID int, serviceID string, key string) error {
+	return DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).First(&Service{}, "id = ?", serviceID).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("organization_id = ? AND service_id = ? AND key = ?", organizationID, serviceID, key).Delete(&ServiceLabel{})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Lifecycle states of a version
+const (
+	VersionStateActive     = "active"     // Supported, and can be used by new consumers
+	VersionStateDeprecated = "deprecated" // Still supported, but consumers should move to a newer version before the sunset date
+	VersionStateYanked     = "yanked"     // Withdrawn because of a defect, and should not be used - can be reinstated if yanked by mistake
+	VersionStateRetired    = "retired"    // No longer supported. Retired versions stay retired.
+)
+
+// States each state can move to
+var versionStateTransitions = map[string][]string{
+	VersionStateActive:     {VersionStateDeprecated, VersionStateYanked, VersionStateRetired},
+	VersionStateDeprecated: {VersionStateActive, VersionStateYanked, VersionStateRetired},
+	VersionStateYanked:     {VersionStateActive, VersionStateRetired},
+	VersionStateRetired:    {},
+}
+
+// Returns true if the given string is one of the lifecycle states
+func IsValidVersionState(state string) bool {
+	_, ok := versionStateTransitions[state]
+	return ok
+}
+
+// Returns the states a version in the given state can move to
+func AllowedVersionTransitions(state string) []string {
+	return versionStateTransitions[state]
+}
+
+// InvalidTransitionError is returned when a version can not move from its current state to the requested one
+type InvalidTransitionError struct {
+	From    string
+	To      string
+	Allowed []string
+}
+
+func (e *InvalidTransitionError) Error() string {
+	if len(e.Allowed) == 0 {
+		return fmt.Sprintf("a %s version can not change state", e.From)
+	}
+	return fmt.Sprintf("a %s version can not move to %s, allowed: %s", e.From, e.To, strings.Join(e.Allowed, ", "))
+}
+
+// InvalidLifecycleDatesError is returned when the deprecation and sunset dates of a transition don't make sense
+type InvalidLifecycleDatesError struct {
+	Reason string
+}
+
+func (e *InvalidLifecycleDatesError) Error() string {
+	return e.Reason
+}
+
+// Moves a non-deleted version to another lifecycle state, and bumps UpdatedAt.
+// Deprecation and sunset dates can only be given when deprecating - deprecatedAt defaults to now, and sunsetAt is optional,
+// but must be after deprecatedAt. Retiring or yanking a version keeps its dates as a record, while reinstating it clears them.
+// Returns gorm.ErrRecordNotFound if the version does not exist in a non-deleted service of the organization,
+// an InvalidTransitionError if the version can not move to the state, and an InvalidLifecycleDatesError for invalid dates.
+func TransitionVersion(organizationID int, serviceID string, versionID string, state string, deprecatedAt *time.Time, sunsetAt *time.Time) (*Version, error) {
+	var version Version
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := activeVersionQuery(tx, organizationID, serviceID).Where("versions.deleted_at IS NULL").First(&version, "versions.id = ?", versionID).Error; err != nil {
+			return err
+		}
+
+		if !canTransition(version.State, state) {
+			return &InvalidTransitionError{From: version.State, To: state, Allowed: AllowedVersionTransitions(version.State)}
+		}
+
+		if state != VersionStateDeprecated && (deprecatedAt != nil || sunsetAt != nil) {
+			return &InvalidLifecycleDatesError{Reason: "deprecation and sunset dates can only be set when deprecating a version"}
+		}
+
+		now := time.Now().UTC()
+
+		switch state {
+		case VersionStateDeprecated:
+			if deprecatedAt == nil {
+				deprecatedAt = &now
+			}
+			if sunsetAt != nil && !sunsetAt.After(*deprecatedAt) {
+				return &InvalidLifecycleDatesError{Reason: "the sunset date must be after the deprecation date"}
+			}
+			version.DeprecatedAt, version.SunsetAt = toUTC(deprecatedAt), toUTC(sunsetAt)
+		case VersionStateActive:
+			version.DeprecatedAt, version.SunsetAt = nil, nil
+		}
+
+		version.State = state
+		version.UpdatedAt = now
+
+		// Select the columns explicitly, so dates can be cleared as well
+		return tx.Model(&version).Select("state", "deprecated_at", "sunset_at", "updated_at").Updates(&version).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &version, nil
+}
+
+// Returns true if a version in state from can move to state to
+func canTransition(from string, to string) bool {
+	for _, allowed := range versionStateTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+func toUTC(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Types of links a service can have
+const (
+	LinkTypeRepo      = "repo"      // Source code repository
+	LinkTypeRunbook   = "runbook"   // How to operate the service, and handle its incidents
+	LinkTypeDashboard = "dashboard" // Monitoring dashboards
+	LinkTypeDocs      = "docs"      // Documentation
+	LinkTypeOnCall    = "on-call"   // On-call schedule or escalation policy
+	LinkTypeChat      = "chat"      // Chat channel of the team running the service
+)
+
+// ServiceLink is a typed link from a Service to where things about it live - its repository, runbook, dashboards and so on.
+// A service can have several links of the same type, for example one dashboard per region.
+type ServiceLink struct {
+	ID             string    `gorm:"primaryKey;type:char(36)"` // ULID as the primary key
+	ServiceID      string    `gorm:"type:char(36);not null;index"`
+	OrganizationID int       `gorm:"type:int;not null"`
+	Type           string    `gorm:"type:varchar(16);not null"`
+	Title          string    `gorm:"type:varchar(256)"`
+	URL            string    `gorm:"type:varchar(2048);not null"`
+	CreatedAt      time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt      time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// BeforeCreate GORM hook to generate a ULID before inserting a new link
+func (l *ServiceLink) BeforeCreate(tx *gorm.DB) (err error) {
+	l.ID = ulid.Make().String()
+	return
+}
+
+// Returns true if the given string is an absolute http or https URL, with a host.
+// Other schemes are rejected, so links like javascript: can't end up in a UI rendering the catalog.
+func IsValidLinkURL(link string) bool {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// Loads the links of a service, ordered by type and then creation
+func GetServiceLinks(organizationID int, serviceID string) ([]ServiceLink, error) {
+	links := []ServiceLink{}
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("organization_id = ? AND service_id = ?", organizationID, serviceID).Order("type").Order("id").Find(&links).Error; err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// Loads a single link of a service
+func GetServiceLink(organizationID int, serviceID string, linkID string) (*ServiceLink, error) {
+	var link ServiceLink
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("organization_id = ? AND service_id = ?", organizationID, serviceID).First(&link, "id = ?", linkID).Error; err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// Adds a link to a non-deleted service of the organization.
+// Returns gorm.ErrRecordNotFound if the service does not exist in the organization.
+func CreateServiceLink(link *ServiceLink) (*ServiceLink, error) {
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", link.OrganizationID).First(&Service{}, "id = ?", link.ServiceID).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(link).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// Updates the type, title and URL of a link of a non-deleted service, and bumps UpdatedAt.
+// Returns gorm.ErrRecordNotFound if the service or the link does not exist in the organization.
+func UpdateServiceLink(organizationID int, serviceID string, linkID string, linkType string, title string, linkURL string) (*ServiceLink, error) {
+	var link ServiceLink
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).First(&Service{}, "id = ?", serviceID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("organization_id = ? AND service_id = ?", organizationID, serviceID).First(&link, "id = ?", linkID).Error; err != nil {
+			return err
+		}
+
+		link.Type = linkType
+		link.Title = title
+		link.URL = linkURL
+		link.UpdatedAt = time.Now().UTC()
+
+		// Select the columns explicitly, so an empty title is saved as well
+		return tx.Model(&link).Select("type", "title", "url", "updated_at").Updates(&link).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// Removes a link from a non-deleted service of the organization
+func DeleteServiceLink(organizationID int, serviceID string, linkID string) error {
+	return DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).First(&Service{}, "id = ?", serviceID).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("organization_id = ? AND service_id = ?", organizationID, serviceID).Delete(&ServiceLink{}, "id = ?", linkID)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gorm.io/gorm"
+)
+
+// MetadataError is a single way in which metadata does not match a schema
+type MetadataError struct {
+	Path    string // JSON pointer to the failing value, for example /metadata/cost_center
+	Message string
+}
+
+// MetadataValidationError is returned when the metadata of a service does not match the metadata schema of its organization
+type MetadataValidationError struct {
+	Errors []MetadataError
+}
+
+func (e *MetadataValidationError) Error() string {
+	return "metadata does not match the schema of the organization"
+}
+
+// InvalidSchemaError is returned when an organization registers a metadata schema which is not a valid JSON Schema
+type InvalidSchemaError struct {
+	Reason string
+}
+
+func (e *InvalidSchemaError) Error() string {
+	return e.Reason
+}
+
+// Compiled metadata schemas, by organization ID - recompiled when the schema of the organization changes
+var compiledMetadataSchemas sync.Map
+
+type compiledMetadataSchema struct {
+	source string
+	schema *jsonschema.Schema
+}
+
+// Compiles a JSON Schema. Schemas without $schema are read as draft 2020-12, and formats like "email" are asserted.
+// References to other documents are not followed, so a schema can't make the server read files or call URLs.
+func compileMetadataSchema(source string) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	compiler.AssertFormat = true
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("references to other documents are not supported: %s", url)
+	}
+
+	if err := compiler.AddResource("metadata.json", strings.NewReader(source)); err != nil {
+		return nil, err
+	}
+
+	return compiler.Compile("metadata.json")
+}
+
+// Loads the metadata schema of an organization - nil if it has none
+func GetServiceMetadataSchema(organizationID int) (JSONMap, error) {
+	organization, err := GetOrganizationByID(organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return organization.ServiceMetadataSchema, nil
+}
+
+// Registers the schema the metadata of the organization's services must match, replacing the previous one.
+// A nil schema removes it. Returns an InvalidSchemaError if the schema is not a valid JSON Schema.
+// Existing services are not checked - their metadata is validated the next time they are updated.
+func SetServiceMetadataSchema(organizationID int, schema JSONMap) error {
+	if schema != nil {
+		source, err := json.Marshal(schema)
+		if err != nil {
+			return err
+		}
+
+		if _, err := compileMetadataSchema(string(source)); err != nil {
+			return &InvalidSchemaError{Reason: err.Error()}
+		}
+	}
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	result := tx.Model(&Organization{}).Where("deleted_at IS NULL").Where("id = ?", organizationID).Update("service_metadata_schema", schema)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Returns a MetadataValidationError if the metadata does not match the metadata schema of the organization.
+// Metadata is always valid in organizations without a schema. Missing metadata is validated as an empty object.
+func validateServiceMetadata(tx *gorm.DB, organizationID int, metadata JSONMap) error {
+	var organization Organization
+	if err := tx.Select("id", "service_metadata_schema").First(&organization, "id = ?", organizationID).Error; err != nil {
+		return err
+	}
+
+	if organization.ServiceMetadataSchema == nil {
+		return nil
+	}
+
+	schema, err := metadataSchemaFor(organization)
+	if err != nil {
+		return err
+	}
+
+	if metadata == nil {
+		metadata = JSONMap{}
+	}
+
+	// Validate the metadata the way it will be read back - as decoded JSON
+	document, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+
+	var instance interface{}
+	if err := decoder.Decode(&instance); err != nil {
+		return err
+	}
+
+	validationErr, ok := schema.Validate(instance).(*jsonschema.ValidationError)
+	if !ok {
+		return nil
+	}
+
+	invalid := &MetadataValidationError{}
+	collectMetadataErrors(validationErr, invalid)
+
+	sort.SliceStable(invalid.Errors, func(i, j int) bool {
+		return invalid.Errors[i].Path < invalid.Errors[j].Path
+	})
+
+	return invalid
+}
+
+// Compiled metadata schema of an organization, from the cache if the schema hasn't changed
+func metadataSchemaFor(organization Organization) (*jsonschema.Schema, error) {
+	source, err := json.Marshal(organization.ServiceMetadataSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached, ok := compiledMetadataSchemas.Load(organization.ID); ok && cached.(compiledMetadataSchema).source == string(source) {
+		return cached.(compiledMetadataSchema).schema, nil
+	}
+
+	schema, err := compileMetadataSchema(string(source))
+	if err != nil {
+		return nil, err
+	}
+
+	compiledMetadataSchemas.Store(organization.ID, compiledMetadataSchema{source: string(source), schema: schema})
+	return schema, nil
+}
+
+// Flattens a tree of validation errors into the errors at its leaves, which point at the failing values
+func collectMetadataErrors(validationErr *jsonschema.ValidationError, invalid *MetadataValidationError) {
+	if len(validationErr.Causes) == 0 {
+		invalid.Errors = append(invalid.Errors, MetadataError{Path: "/metadata" + validationErr.InstanceLocation, Message: validationErr.Message})
+		return
+	}
+
+	for _, cause := range validationErr.Causes {
+		collectMetadataErrors(cause, invalid)
+	}
+}
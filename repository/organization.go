@@ -2,18 +2,43 @@ package repository
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Represents an Organization.
 // Contains hasMany relationship with other entites like Service, Users and Version
 // https://gorm.io/docs/has_many.html
 type Organization struct {
-	ID        int        `gorm:"unique;primaryKey;autoIncrement"`
-	Name      string     `gorm:"type:varchar(256);not null"` // Name of the Organization
-	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP"`
-	UpdatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP"`
-	DeletedAt *time.Time `gorm:"default null"`
-	Users     []User     `gorm:"foreignKey:OrganizationID"`
-	Services  []Service  `gorm:"foreignKey:OrganizationID"`
-	Versions  []Version  `gorm:"foreignKey:OrganizationID"`
+	ID                    int        `gorm:"unique;primaryKey;autoIncrement"`
+	Name                  string     `gorm:"type:varchar(256);not null"` // Name of the Organization
+	ServiceMetadataSchema JSONMap    `gorm:"type:text"`                  // JSON Schema the metadata of services must match - see metadataSchema.go
+	CreatedAt             time.Time  `gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt             time.Time  `gorm:"default:CURRENT_TIMESTAMP"`
+	DeletedAt             *time.Time `gorm:"default null"`
+	Users                 []User     `gorm:"foreignKey:OrganizationID"`
+	Services              []Service  `gorm:"foreignKey:OrganizationID"`
+	Versions              []Version  `gorm:"foreignKey:OrganizationID"`
+}
+
+// AfterCreate GORM hook to give new organizations the default environments.
+// Databases which are not migrated yet get them from backfillDefaultEnvironments once they are.
+func (o *Organization) AfterCreate(tx *gorm.DB) (err error) {
+	if !tx.Migrator().HasTable(&Environment{}) {
+		return nil
+	}
+	return createDefaultEnvironments(tx, o.ID)
+}
+
+// Loads a single non-deleted organization by ID
+func GetOrganizationByID(organizationID int) (*Organization, error) {
+	var organization Organization
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("deleted_at IS NULL").First(&organization, "id = ?", organizationID).Error; err != nil {
+		return nil, err
+	}
+
+	return &organization, nil
 }
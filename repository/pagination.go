@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Layout the SQLite driver uses to store timestamps
+const storedTimestampLayout = "2006-01-02 15:04:05.999999999-07:00"
+
+// ErrInvalidKeyset is returned when a keyset does not match the sort keys of the query
+var ErrInvalidKeyset = errors.New("keyset does not match the sort order")
+
+// SortKey is a column, or an expression over columns, results are ordered by.
+// Columns must be whitelisted - they are used in queries as is.
+type SortKey struct {
+	Column    string
+	Desc      bool
+	Timestamp bool // Timestamps are stored as text, some with a timezone offset and some without - so they are compared as julian days
+}
+
+// SQL for the key, and for a value compared with it
+func (key SortKey) sql() (string, string) {
+	if key.Timestamp {
+		return "julianday(" + key.Column + ")", "julianday(?)"
+	}
+	return key.Column, "?"
+}
+
+// Keyset is a position in an ordered list of results, used for cursor (keyset) pagination instead of offsets.
+// It holds the sort key values of the last row of the previous page - or, when paging backwards, of the first row of the next page.
+// A backward keyset without values is the end of the list, so it loads the last page.
+type Keyset struct {
+	Values   []interface{}
+	Backward bool
+}
+
+// Orders the query by the sort keys, and limits it to one page. With a keyset, the page starts right after
+// (or, backwards, ends right before) the keyset, otherwise at the offset of the page number.
+// One row more than the page size is loaded, so finishPage can tell if there are more results.
+func paginate(tx *gorm.DB, keys []SortKey, keyset *Keyset, pageNo int, pageSize int) *gorm.DB {
+	backward := keyset != nil && keyset.Backward
+
+	for _, key := range keys {
+		column, _ := key.sql()
+
+		// Paging backwards walks the list in reverse, and finishPage restores the order
+		if key.Desc != backward {
+			tx = tx.Order(column + " desc")
+		} else {
+			tx = tx.Order(column + " asc")
+		}
+	}
+
+	if keyset == nil {
+		return tx.Offset((pageNo - 1) * pageSize).Limit(pageSize + 1)
+	}
+
+	if len(keyset.Values) == 0 {
+		return tx.Limit(pageSize + 1)
+	}
+
+	// Rows after the keyset: (a > x) OR (a = x AND b > y) OR (a = x AND b = y AND c > z) ...
+	var conditions []string
+	var args []interface{}
+	for i, key := range keys {
+		var parts []string
+		for j := 0; j < i; j++ {
+			column, value := keys[j].sql()
+			parts = append(parts, column+" = "+value)
+			args = append(args, keyset.Values[j])
+		}
+
+		operator := ">"
+		if key.Desc != backward {
+			operator = "<"
+		}
+		column, value := key.sql()
+		parts = append(parts, column+" "+operator+" "+value)
+		args = append(args, keyset.Values[i])
+
+		conditions = append(conditions, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	return tx.Where("("+strings.Join(conditions, " OR ")+")", args...).Limit(pageSize + 1)
+}
+
+// Drops the extra row loaded by paginate, and reports whether there are more results in the direction of paging.
+func finishPage[T any](rows []T, pageSize int, keyset *Keyset) ([]T, bool) {
+	hasMore := len(rows) > pageSize
+	if hasMore {
+		rows = rows[:pageSize]
+	}
+
+	if keyset != nil && keyset.Backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	return rows, hasMore
+}
+
+// Returns ErrInvalidKeyset if the keyset does not have a value for every sort key, and is not the end of the list
+func checkKeyset(keys []SortKey, keyset *Keyset) error {
+	if keyset != nil && len(keyset.Values) != len(keys) && !(keyset.Backward && len(keyset.Values) == 0) {
+		return ErrInvalidKeyset
+	}
+	return nil
+}
+
+func formatStoredTimestamp(t time.Time) string {
+	return t.Format(storedTimestampLayout)
+}
@@ -0,0 +1,335 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Outcomes of a promotion
+const (
+	PromotionPromoted = "promoted" // The gates passed, and the version was deployed to the target environment
+	PromotionRejected = "rejected" // A gate failed, and nothing was deployed
+)
+
+// VersionApproval records a User approving a Version of a Service for promotion to an Environment
+type VersionApproval struct {
+	ID             string    `gorm:"primaryKey;type:char(36)"` // ULID as the primary key
+	OrganizationID int       `gorm:"type:int;not null"`
+	ServiceID      string    `gorm:"type:char(36);not null;index"`
+	VersionID      string    `gorm:"type:char(36);not null;uniqueIndex:idx_version_approval"`
+	EnvironmentID  string    `gorm:"type:char(36);not null;uniqueIndex:idx_version_approval"`
+	UserID         int       `gorm:"type:int;not null;uniqueIndex:idx_version_approval"` // User who approved the version
+	CreatedAt      time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// BeforeCreate GORM hook to generate a ULID before inserting a new approval
+func (a *VersionApproval) BeforeCreate(tx *gorm.DB) (err error) {
+	a.ID = ulid.Make().String()
+	return
+}
+
+// Promotion records a User promoting a Version of a Service from one environment of the pipeline to the next.
+// Rejected promotions are recorded as well, along with the gates they failed.
+type Promotion struct {
+	ID                string    `gorm:"primaryKey;type:char(36)"` // ULID as the primary key
+	OrganizationID    int       `gorm:"type:int;not null"`
+	ServiceID         string    `gorm:"type:char(36);not null;index"`
+	VersionID         string    `gorm:"type:char(36);not null;index"`
+	FromEnvironmentID string    `gorm:"type:char(36)"` // Previous environment of the pipeline, empty if the target is not in the pipeline or first in it
+	ToEnvironmentID   string    `gorm:"type:char(36);not null"`
+	DeploymentID      string    `gorm:"type:char(36)"`             // Deployment to the target environment, empty for rejected promotions
+	Status            string    `gorm:"type:varchar(16);not null"` // promoted or rejected
+	Reason            string    `gorm:"type:varchar(1024)"`        // Failed gates of a rejected promotion, separated by "; "
+	UserID            int       `gorm:"type:int;not null"`         // User who triggered the promotion
+	CreatedAt         time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// BeforeCreate GORM hook to generate a ULID before inserting a new promotion
+func (p *Promotion) BeforeCreate(tx *gorm.DB) (err error) {
+	p.ID = ulid.Make().String()
+	return
+}
+
+// PromotionResult is a successful promotion, along with the deployment it created
+type PromotionResult struct {
+	Promotion  Promotion
+	Deployment *DeploymentDetails
+}
+
+// PromotionRejectedError is returned when a version does not pass the gates of the environment it is promoted to
+type PromotionRejectedError struct {
+	PromotionID string   // The recorded rejected promotion
+	Reasons     []string // Every gate the version failed
+}
+
+func (e *PromotionRejectedError) Error() string {
+	return "the promotion was rejected: " + strings.Join(e.Reasons, "; ")
+}
+
+// ErrDuplicatePipelineEnvironment is returned when an environment is given more than once for the pipeline
+var ErrDuplicatePipelineEnvironment = errors.New("an environment can only be in the pipeline once")
+
+// Sets the promotion pipeline of the organization to the given environments, in order.
+// Environments left out are removed from the pipeline, but keep their gates.
+// Returns ErrDuplicatePipelineEnvironment if an environment is given twice, and
+// gorm.ErrRecordNotFound if any of the environments does not exist in the organization.
+func SetEnvironmentPipeline(organizationID int, environmentIDs []string) ([]Environment, error) {
+	// Checked first, as duplicates would otherwise make the count below look like a missing environment
+	seen := map[string]bool{}
+	for _, environmentID := range environmentIDs {
+		if seen[environmentID] {
+			return nil, ErrDuplicatePipelineEnvironment
+		}
+		seen[environmentID] = true
+	}
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Environment{}).Where("organization_id = ? AND id IN (?)", organizationID, environmentIDs).Count(&count).Error; err != nil {
+			return err
+		}
+
+		if int(count) != len(environmentIDs) {
+			return gorm.ErrRecordNotFound
+		}
+
+		now := time.Now().UTC()
+		if err := tx.Model(&Environment{}).Where("organization_id = ?", organizationID).
+			Updates(map[string]interface{}{"pipeline_position": nil, "updated_at": now}).Error; err != nil {
+			return err
+		}
+
+		for i, environmentID := range environmentIDs {
+			if err := tx.Model(&Environment{}).Where("organization_id = ? AND id = ?", organizationID, environmentID).
+				Update("pipeline_position", i+1).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return GetEnvironments(organizationID)
+}
+
+// Sets the promotion gates of an environment of the organization
+func SetEnvironmentGates(organizationID int, environmentID string, minSoakMinutes int, requiredApprovals int) (*Environment, error) {
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", organizationID).First(&Environment{}, "id = ?", environmentID).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&Environment{}).Where("id = ?", environmentID).
+			Updates(map[string]interface{}{"min_soak_minutes": minSoakMinutes, "required_approvals": requiredApprovals, "updated_at": time.Now().UTC()}).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return GetEnvironmentByID(organizationID, environmentID)
+}
+
+// Records the approval of a non-deleted version of a service of the organization, for promotion to one of its environments.
+// Approving the same version for the same environment again keeps the first approval.
+// Returns gorm.ErrRecordNotFound if the version or environment does not exist in the organization.
+func ApproveVersion(approval *VersionApproval) (*VersionApproval, error) {
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := activeVersionQuery(tx, approval.OrganizationID, approval.ServiceID).Where("versions.deleted_at IS NULL").First(&Version{}, "versions.id = ?", approval.VersionID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("organization_id = ?", approval.OrganizationID).First(&Environment{}, "id = ?", approval.EnvironmentID).Error; err != nil {
+			return err
+		}
+
+		var existing []VersionApproval
+		if err := tx.Where("version_id = ? AND environment_id = ? AND user_id = ?", approval.VersionID, approval.EnvironmentID, approval.UserID).Limit(1).Find(&existing).Error; err != nil {
+			return err
+		}
+
+		if len(existing) > 0 {
+			*approval = existing[0]
+			return nil
+		}
+
+		return tx.Create(approval).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return approval, nil
+}
+
+// Loads the approvals of a non-deleted version of a service of the organization, oldest first.
+// Returns gorm.ErrRecordNotFound if the version does not exist in the organization.
+func GetVersionApprovals(organizationID int, serviceID string, versionID string) ([]VersionApproval, error) {
+	approvals := []VersionApproval{}
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := activeVersionQuery(tx, organizationID, serviceID).Where("versions.deleted_at IS NULL").First(&Version{}, "versions.id = ?", versionID).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("organization_id = ? AND version_id = ?", organizationID, versionID).Order("id").Find(&approvals).Error; err != nil {
+		return nil, err
+	}
+
+	return approvals, nil
+}
+
+// Promotes a non-deleted version of a service of the organization to an environment of its pipeline, deploying it there.
+// The version must have been deployed successfully to the previous environment of the pipeline, and pass the gates of the
+// target environment - run there for its minimum soak time, and have its required approvals from users other than the one promoting.
+// Every promotion is recorded. Returns gorm.ErrRecordNotFound if the version or environment does not exist in the organization,
+// and a PromotionRejectedError listing the failed gates if the version can not be promoted.
+func PromoteVersion(promotion *Promotion, status string) (*PromotionResult, error) {
+	var result *PromotionResult
+	var reasons []string
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		var err error
+		reasons, err = checkPromotionGates(tx, promotion)
+		if err != nil || len(reasons) > 0 {
+			return err
+		}
+
+		deployment, err := createDeployment(tx, &Deployment{
+			OrganizationID: promotion.OrganizationID,
+			ServiceID:      promotion.ServiceID,
+			VersionID:      promotion.VersionID,
+			EnvironmentID:  promotion.ToEnvironmentID,
+			Status:         status,
+			UserID:         promotion.UserID,
+			DeployedAt:     time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+
+		promotion.DeploymentID = deployment.ID
+		promotion.Status = PromotionPromoted
+		if err := tx.Create(promotion).Error; err != nil {
+			return err
+		}
+
+		result = &PromotionResult{Promotion: *promotion, Deployment: deployment}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reasons) > 0 {
+		promotion.Status = PromotionRejected
+		promotion.Reason = truncateReason(strings.Join(reasons, "; "))
+		if err := DBInstance.Create(promotion).Error; err != nil {
+			return nil, err
+		}
+		return nil, &PromotionRejectedError{PromotionID: promotion.ID, Reasons: reasons}
+	}
+
+	return result, nil
+}
+
+// Checks a promotion against the pipeline and the gates of its target environment, and fills in its previous environment.
+// Returns the failed gates, or an error if the version or target environment does not exist.
+func checkPromotionGates(tx *gorm.DB, promotion *Promotion) ([]string, error) {
+	var version Version
+	if err := activeVersionQuery(tx, promotion.OrganizationID, promotion.ServiceID).Where("versions.deleted_at IS NULL").First(&version, "versions.id = ?", promotion.VersionID).Error; err != nil {
+		return nil, err
+	}
+
+	var target Environment
+	if err := tx.Where("organization_id = ?", promotion.OrganizationID).First(&target, "id = ?", promotion.ToEnvironmentID).Error; err != nil {
+		return nil, err
+	}
+
+	if target.PipelinePosition == nil {
+		return []string{fmt.Sprintf("%s is not part of the promotion pipeline", target.Name)}, nil
+	}
+
+	if *target.PipelinePosition == 1 {
+		return []string{fmt.Sprintf("%s is the first environment of the pipeline - versions are deployed to it, not promoted", target.Name)}, nil
+	}
+
+	var previous Environment
+	if err := tx.Where("organization_id = ? AND pipeline_position = ?", promotion.OrganizationID, *target.PipelinePosition-1).First(&previous).Error; err != nil {
+		return nil, err
+	}
+	promotion.FromEnvironmentID = previous.ID
+
+	var reasons []string
+
+	if version.State == VersionStateYanked || version.State == VersionStateRetired {
+		reasons = append(reasons, fmt.Sprintf("version %s is %s, and can not be deployed", version.Name, version.State))
+	}
+
+	// The soak time counts from the first time the version was recorded succeeding in the previous environment.
+	// Not from the finish time, which clients can backdate.
+	var deployed []Deployment
+	if err := tx.Where("version_id = ? AND environment_id = ? AND status = ?", version.ID, previous.ID, DeploymentSucceeded).
+		Order("julianday(finish_recorded_at)").Limit(1).Find(&deployed).Error; err != nil {
+		return nil, err
+	}
+
+	if len(deployed) == 0 {
+		reasons = append(reasons, fmt.Sprintf("version %s was not deployed successfully to %s", version.Name, previous.Name))
+	} else if soaked := time.Since(*deployed[0].FinishRecordedAt); soaked < time.Duration(target.MinSoakMinutes)*time.Minute {
+		reasons = append(reasons, fmt.Sprintf("version %s has run in %s for %d minutes, %s requires %d", version.Name, previous.Name, int(soaked.Minutes()), target.Name, target.MinSoakMinutes))
+	}
+
+	if target.RequiredApprovals > 0 {
+		var approvals int64
+		if err := tx.Model(&VersionApproval{}).
+			Where("version_id = ? AND environment_id = ? AND user_id <> ?", version.ID, target.ID, promotion.UserID).
+			Count(&approvals).Error; err != nil {
+			return nil, err
+		}
+
+		if int(approvals) < target.RequiredApprovals {
+			reasons = append(reasons, fmt.Sprintf("version %s has %d of the %d approvals %s requires", version.Name, approvals, target.RequiredApprovals, target.Name))
+		}
+	}
+
+	return reasons, nil
+}
+
+// Cuts a rejection reason down to the size of its column
+func truncateReason(reason string) string {
+	if len(reason) > 1024 {
+		return reason[:1021] + "..."
+	}
+	return reason
+}
+
+// Loads the promotion history of a service of the organization, newest first - including rejected promotions
+func GetServicePromotions(organizationID int, serviceID string, pageSize int, pageNo int) ([]Promotion, error) {
+	promotions := []Promotion{}
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	err := tx.Where("organization_id = ? AND service_id = ?", organizationID, serviceID).
+		Order("id desc").
+		Offset((pageNo - 1) * pageSize).Limit(pageSize).
+		Find(&promotions).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return promotions, nil
+}
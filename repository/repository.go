@@ -20,22 +20,60 @@ func InitDatabase() (*gorm.DB, error) {
 	}
 
 	// creates tables if they don't exist)
-	err = DBInstance.AutoMigrate(&Organization{}, &User{}, &Service{}, &Version{})
+	err = Migrate(DBInstance)
 	if err != nil {
 		fmt.Printf("Error automigrating schema: %v\n", err)
 		return nil, err
 	}
 
-	// Create a dummy organisation and user, and ignore errors if already present
-	orgResult := DBInstance.Create(&Organization{Name: "Poppy Corp."})
+	// Create a dummy organisation and user, unless they are already present
+	orgResult := DBInstance.Where(Organization{Name: "Poppy Corp."}).FirstOrCreate(&Organization{})
 	if orgResult.Error != nil {
 		fmt.Printf("Error creating org: %v\n", orgResult.Error)
 	}
 
-	userResult := DBInstance.Create(&User{Name: "Poppy Corp.", Email: "user_1@poppycorp.com", OrganizationID: 1})
+	userResult := DBInstance.Where(User{Email: "user_1@poppycorp.com"}).Attrs(User{Name: "Poppy Corp.", OrganizationID: 1, Role: RoleAdmin}).FirstOrCreate(&User{})
 	if userResult.Error != nil {
 		fmt.Printf("Error creating user: %v\n", userResult.Error)
 	}
 
 	return DBInstance, nil
 }
+
+// Creates or updates the tables for all our models, along with indexes GORM cannot manage for us.
+func Migrate(db *gorm.DB) error {
+	// Checked before AutoMigrate adds the role column, which would give every existing user the viewer default
+	usersPredateRoles := db.Migrator().HasTable(&User{}) && !db.Migrator().HasColumn(&User{}, "Role")
+
+	if err := db.AutoMigrate(&Organization{}, &User{}, &Service{}, &Version{}, &APIKey{}, &ServiceRoleAssignment{}, &ServiceLabel{}, &Team{}, &TeamMember{}, &ServiceOwnership{}, &ServiceLink{}, &ServiceDependency{}, &Environment{}, &Deployment{}, &VersionApproval{}, &Promotion{}, &WebhookSubscription{}, &WebhookDelivery{}, &WebhookDeliveryAttempt{}); err != nil {
+		return err
+	}
+
+	if usersPredateRoles {
+		if err := backfillUserRoles(db); err != nil {
+			return err
+		}
+	}
+
+	if err := ensureUniqueNameIndexes(db); err != nil {
+		return err
+	}
+
+	if err := ensureServiceSearchIndex(db); err != nil {
+		return err
+	}
+
+	if err := ensurePrimaryOwnerIndex(db); err != nil {
+		return err
+	}
+
+	if err := backfillDefaultEnvironments(db); err != nil {
+		return err
+	}
+
+	if err := backfillDeploymentFinishRecordedAt(db); err != nil {
+		return err
+	}
+
+	return backfillSemverKeys(db)
+}
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Roles a user can have in an organization, or on a single service.
+const (
+	RoleViewer = "viewer" // Can read the catalog
+	RoleEditor = "editor" // Can also create services and versions
+	RoleAdmin  = "admin"  // Can also manage API keys and role assignments
+)
+
+// Rank of each role - a role grants everything a lower ranked role does.
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// Returns true if the given string is one of the supported roles
+func IsValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// Returns true if role grants at least the permissions of requiredRole
+func RoleSatisfies(role string, requiredRole string) bool {
+	return roleRanks[role] >= roleRanks[requiredRole]
+}
+
+// Makes every existing user an admin. Used when upgrading a database created before roles existed, since its users
+// could write to the whole catalog, and silently downgrading them to viewers would lock them out.
+func backfillUserRoles(db *gorm.DB) error {
+	return db.Model(&User{}).Where("1 = 1").Update("role", RoleAdmin).Error
+}
+
+// ServiceRoleAssignment overrides the organization wide role of a User for a single Service.
+// For example, a viewer can be made an editor of the services their team owns.
+type ServiceRoleAssignment struct {
+	ID             int       `gorm:"unique;primaryKey;autoIncrement"`
+	ServiceID      string    `gorm:"type:char(36);not null;uniqueIndex:idx_service_role_assignment"`
+	UserID         int       `gorm:"type:int;not null;uniqueIndex:idx_service_role_assignment"`
+	OrganizationID int       `gorm:"type:int;not null"`
+	Role           string    `gorm:"type:varchar(16);not null"`
+	CreatedAt      time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt      time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// Returns the role of the user for the given service - the per-service override if there is one,
+// and the organization wide role otherwise. Organization admins are always admins.
+func GetEffectiveRole(organizationID int, userID int, userRole string, serviceID string) (string, error) {
+	if userRole == RoleAdmin || serviceID == "" {
+		return userRole, nil
+	}
+
+	var assignments []ServiceRoleAssignment
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("organization_id = ? AND user_id = ? AND service_id = ?", organizationID, userID, serviceID).Limit(1).Find(&assignments).Error; err != nil {
+		return "", err
+	}
+
+	if len(assignments) == 0 {
+		return userRole, nil
+	}
+
+	return assignments[0].Role, nil
+}
+
+// Loads all non-deleted users of an organization
+func GetUsers(organizationID int) ([]User, error) {
+	var users []User
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// ErrLastAdmin is returned when the only admin of an organization would stop being an admin,
+// as nobody would be left to grant the role back
+var ErrLastAdmin = errors.New("the organization must keep at least one admin")
+
+// Updates the organization wide role of a user.
+// Returns ErrLastAdmin if the user is the only admin of the organization, and would not be an admin anymore.
+func SetUserRole(organizationID int, userID int, role string) (*User, error) {
+	var user User
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).First(&user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+
+		if user.Role == RoleAdmin && role != RoleAdmin {
+			var otherAdmins int64
+			if err := tx.Model(&User{}).Where("deleted_at IS NULL").
+				Where("organization_id = ? AND role = ? AND id <> ?", organizationID, RoleAdmin, user.ID).
+				Count(&otherAdmins).Error; err != nil {
+				return err
+			}
+
+			if otherAdmins == 0 {
+				return ErrLastAdmin
+			}
+		}
+
+		user.Role = role
+		return tx.Model(&user).Update("role", role).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Loads the per-service role overrides of a service
+func GetServiceRoleAssignments(organizationID int, serviceID string) ([]ServiceRoleAssignment, error) {
+	var assignments []ServiceRoleAssignment
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("organization_id = ? AND service_id = ?", organizationID, serviceID).Order("user_id").Find(&assignments).Error; err != nil {
+		return nil, err
+	}
+
+	return assignments, nil
+}
+
+// Creates or replaces the role override of a user for a service.
+// Both the user and the service must belong to the organization, otherwise gorm.ErrRecordNotFound is returned.
+func SetServiceRole(organizationID int, serviceID string, userID int, role string) (*ServiceRoleAssignment, error) {
+	assignment := ServiceRoleAssignment{ServiceID: serviceID, UserID: userID, OrganizationID: organizationID, Role: role}
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).First(&Service{}, "id = ?", serviceID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).First(&User{}, "id = ?", userID).Error; err != nil {
+			return err
+		}
+
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "service_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"role", "updated_at"}),
+		}).Create(&assignment).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &assignment, nil
+}
+
+// Removes the role override of a user for a service
+func DeleteServiceRole(organizationID int, serviceID string, userID int) error {
+	tx := DBInstance.Session(&gorm.Session{})
+
+	result := tx.Where("organization_id = ? AND service_id = ? AND user_id = ?", organizationID, serviceID, userID).Delete(&ServiceRoleAssignment{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package repository
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// Markers wrapped around matched terms in search highlights and snippets
+const (
+	SearchHighlightStart = "<mark>"
+	SearchHighlightEnd   = "</mark>"
+)
+
+// Number of words in description snippets
+const searchSnippetWords = 16
+
+// Words, as split by the FTS5 tokenizer
+var searchWordPattern = regexp.MustCompile(`[\pL\pN]+`)
+
+// ServiceSearchResult is a service matching a search query, along with how well it matched
+type ServiceSearchResult struct {
+	Service
+	Score              float64 // Relevance of the match - higher is better. Only comparable within the results of one query.
+	NameHighlight      string  // Name of the service, with matched terms wrapped in <mark> tags
+	DescriptionSnippet string  // Part of the description around the matched terms, with matched terms wrapped in <mark> tags
+}
+
+// True if SQLite was built with FTS5 (go build -tags sqlite_fts5), set when migrating.
+// Without it, searches fall back to LIKE queries - slower, and with a simpler ranking.
+var fullTextSearchEnabled bool
+
+// Creates the services_fts virtual table, and the triggers which keep it in sync with the services table.
+// Soft deleted services stay in the index, and are filtered out when searching.
+func ensureServiceSearchIndex(db *gorm.DB) error {
+	var existing int64
+	if err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'services_fts'").Scan(&existing).Error; err != nil {
+		return err
+	}
+
+	var fts5Available bool
+	if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5Available).Error; err != nil {
+		return err
+	}
+
+	fullTextSearchEnabled = fts5Available
+	if !fts5Available {
+		fmt.Println("SQLite was built without FTS5, service search will use LIKE queries. Build with -tags sqlite_fts5 to enable full-text search.")
+
+		// Triggers left by a build with FTS5 would make every write to the services table fail, as they write to
+		// services_fts. The index itself is left in place, and rebuilt by the next build with FTS5.
+		for _, trigger := range []string{"services_fts_insert", "services_fts_delete", "services_fts_update"} {
+			if err := db.Exec("DROP TRIGGER IF EXISTS " + trigger).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var triggerCount int64
+	if err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'services_fts_%'").Scan(&triggerCount).Error; err != nil {
+		return err
+	}
+	triggersExisted := triggerCount == 3
+
+	// The service ID is stored unindexed instead of using an external content table, since the rowids of the
+	// services table (which has a text primary key) can change when the database is vacuumed.
+	if err := db.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS services_fts USING fts5(id UNINDEXED, name, description)").Error; err != nil {
+		return err
+	}
+
+	triggers := []string{
+		`CREATE TRIGGER IF NOT EXISTS services_fts_insert AFTER INSERT ON services BEGIN
+			INSERT INTO services_fts (id, name, description) VALUES (new.id, new.name, new.description);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS services_fts_delete AFTER DELETE ON services BEGIN
+			DELETE FROM services_fts WHERE id = old.id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS services_fts_update AFTER UPDATE OF name, description ON services BEGIN
+			UPDATE services_fts SET name = new.name, description = new.description WHERE id = old.id;
+		END`,
+	}
+
+	for _, trigger := range triggers {
+		if err := db.Exec(trigger).Error; err != nil {
+			return err
+		}
+	}
+
+	// Index the services created before the search index existed, or changed by a build without FTS5, which does not
+	// keep the index in sync
+	if existing == 0 || !triggersExisted {
+		if err := db.Exec("DELETE FROM services_fts").Error; err != nil {
+			return err
+		}
+		return db.Exec("INSERT INTO services_fts (id, name, description) SELECT id, name, description FROM services").Error
+	}
+
+	return nil
+}
+
+// Searches the non-deleted services of an organization by name and description, most relevant first.
+// Every term of the query must match the start of a word, so "pay" finds "payments-gateway".
+// Matches in the name rank higher than matches in the description.
+func SearchServices(organizationID int, query string, pageSize int, pageNo int) ([]ServiceSearchResult, error) {
+	terms := searchTerms(query)
+	results := []ServiceSearchResult{}
+
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	if !fullTextSearchEnabled {
+		return searchServicesWithLike(organizationID, terms, pageSize, pageNo)
+	}
+
+	// Quote each term, so it is matched as a prefix and never parsed as FTS5 query syntax
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + term + `"*`
+	}
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	err := tx.Raw(`SELECT services.*,
+			-bm25(services_fts, 0, 10.0, 1.0) AS score,
+			highlight(services_fts, 1, ?, ?) AS name_highlight,
+			snippet(services_fts, 2, ?, ?, '…', 16) AS description_snippet
+		FROM services_fts
+		JOIN services ON services.id = services_fts.id
+		WHERE services_fts MATCH ? AND services.organization_id = ? AND services.deleted_at IS NULL
+		ORDER BY bm25(services_fts, 0, 10.0, 1.0), services.id
+		LIMIT ? OFFSET ?`,
+		SearchHighlightStart, SearchHighlightEnd, SearchHighlightStart, SearchHighlightEnd,
+		strings.Join(quoted, " "), organizationID, pageSize, (pageNo-1)*pageSize).
+		Scan(&results).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// Fallback for SQLite builds without FTS5. Terms match the start of words like with FTS5, and descriptions are cut
+// down to a snippet the same way, but services are ranked by the number of terms matching the name, then the description.
+// LIKE cannot match the start of words, so it only narrows down the services, which are then matched, ranked and
+// paginated in memory.
+func searchServicesWithLike(organizationID int, terms []string, pageSize int, pageNo int) ([]ServiceSearchResult, error) {
+	var candidates []Service
+
+	tx := DBInstance.Session(&gorm.Session{}).Where("deleted_at IS NULL").Where("organization_id = ?", organizationID)
+
+	for _, term := range terms {
+		// Terms only contain letters and digits, so they never contain LIKE wildcards
+		pattern := "%" + term + "%"
+		tx = tx.Where("(name LIKE ? OR description LIKE ?)", pattern, pattern)
+	}
+
+	if err := tx.Order("id").Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	results := []ServiceSearchResult{}
+
+	for _, candidate := range candidates {
+		score, matched := 0.0, true
+		for _, term := range terms {
+			prefix := searchTermsPattern([]string{term})
+			inName, inDescription := prefix.MatchString(candidate.Name), prefix.MatchString(candidate.Description)
+			if !inName && !inDescription {
+				matched = false
+				break
+			}
+			if inName {
+				score += 10
+			}
+			if inDescription {
+				score++
+			}
+		}
+
+		if matched {
+			results = append(results, ServiceSearchResult{Service: candidate, Score: score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	offset := (pageNo - 1) * pageSize
+	if offset >= len(results) {
+		return []ServiceSearchResult{}, nil
+	}
+	results = results[offset:min(offset+pageSize, len(results))]
+
+	matcher := searchTermsPattern(terms)
+	for i := range results {
+		results[i].NameHighlight = highlightTerms(matcher, results[i].Name)
+		results[i].DescriptionSnippet = highlightTerms(matcher, searchSnippet(matcher, results[i].Description))
+	}
+
+	return results, nil
+}
+
+// Splits a search query into terms, the same way the FTS5 tokenizer splits words - on anything but letters and digits.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Case insensitive pattern matching words starting with any of the terms. The first group is the character before the word.
+func searchTermsPattern(terms []string) *regexp.Regexp {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	return regexp.MustCompile(`(?i)(^|[^\pL\pN])((?:` + strings.Join(quoted, "|") + `)[\pL\pN]*)`)
+}
+
+// Wraps the words matching the pattern in highlight markers
+func highlightTerms(pattern *regexp.Regexp, text string) string {
+	return pattern.ReplaceAllString(text, "${1}"+SearchHighlightStart+"${2}"+SearchHighlightEnd)
+}
+
+// Cuts text down to the words around the first word matching the pattern, like the FTS5 snippet function.
+// Cut off text is replaced with an ellipsis.
+func searchSnippet(pattern *regexp.Regexp, text string) string {
+	words := searchWordPattern.FindAllStringIndex(text, -1)
+	if len(words) <= searchSnippetWords {
+		return text
+	}
+
+	first := 0
+	if match := pattern.FindStringSubmatchIndex(text); match != nil {
+		for first < len(words)-1 && words[first][0] < match[4] {
+			first++
+		}
+	}
+
+	// Keep a few words before the match for context, and fill the rest of the snippet after it
+	start := max(0, min(first-searchSnippetWords/4, len(words)-searchSnippetWords))
+	end := start + searchSnippetWords
+
+	snippet := text[words[start][0]:words[end-1][1]]
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(words) {
+		snippet += "…"
+	}
+	return snippet
+}
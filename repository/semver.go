@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"gorm.io/gorm"
+)
+
+// Versioning schemes a service can use
+const (
+	VersioningSchemeFree   = "free"   // Version names are free text
+	VersioningSchemeSemver = "semver" // Version names must be valid Semantic Versions - https://semver.org/spec/v2.0.0.html
+)
+
+// InvalidVersionNameError is returned when a version of a service in semver mode has a name which is not a valid Semantic Version
+type InvalidVersionNameError struct {
+	Names []string
+}
+
+func (e *InvalidVersionNameError) Error() string {
+	return fmt.Sprintf("version names must be valid semantic versions (for example 1.4.0 or v2.0.0-rc.1), invalid: %s", strings.Join(e.Names, ", "))
+}
+
+// Parses a version name as a Semantic Version 2.0, including pre-release and build metadata.
+// A leading "v", as commonly used in git tags, is allowed.
+func ParseSemver(name string) (*semver.Version, error) {
+	trimmed := strings.TrimPrefix(name, "v")
+
+	version, err := semver.StrictNewVersion(trimmed)
+	if err != nil {
+		return nil, err
+	}
+
+	// The parser accepts empty pre-release and build parts (like "1.0.0-"), which the specification does not
+	withoutBuild, build, hasBuild := strings.Cut(trimmed, "+")
+	_, prerelease, hasPrerelease := strings.Cut(withoutBuild, "-")
+	for _, part := range []struct {
+		present bool
+		value   string
+	}{{hasPrerelease, prerelease}, {hasBuild, build}} {
+		if !part.present {
+			continue
+		}
+		for _, identifier := range strings.Split(part.value, ".") {
+			if identifier == "" {
+				return nil, fmt.Errorf("empty identifier in %q", name)
+			}
+		}
+	}
+
+	return version, nil
+}
+
+// Returns a string which sorts in the same order as the semantic precedence of the version, so versions
+// can be ordered and compared in SQL. Build metadata does not affect precedence, so it is left out.
+//
+// Major, minor and patch are zero padded. Releases are marked with "~" and pre-releases with "!", so a
+// pre-release sorts before its release. Pre-release identifiers are separated by "," - which sorts before
+// any character allowed in an identifier, so a shorter list of identifiers sorts first. Numeric identifiers are
+// prefixed with "0" and their length, so they compare numerically and before alphanumeric ones, prefixed with "1".
+func semverSortKey(version *semver.Version) string {
+	key := fmt.Sprintf("%020d.%020d.%020d", version.Major(), version.Minor(), version.Patch())
+
+	if version.Prerelease() == "" {
+		return key + "~"
+	}
+
+	identifiers := strings.Split(version.Prerelease(), ".")
+	for i, identifier := range identifiers {
+		if isNumericIdentifier(identifier) {
+			identifiers[i] = fmt.Sprintf("0%03d%s", len(identifier), identifier)
+		} else {
+			identifiers[i] = "1" + identifier
+		}
+	}
+
+	return key + "!" + strings.Join(identifiers, ",")
+}
+
+func isNumericIdentifier(identifier string) bool {
+	for _, char := range identifier {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+	return identifier != ""
+}
+
+// Fills in the semantic version fields of a version from its name.
+// Names which are not semantic versions are only rejected if the service is in semver mode.
+func setSemverFields(version *Version, versioningScheme string) error {
+	parsed, err := ParseSemver(version.Name)
+	if err != nil {
+		if versioningScheme == VersioningSchemeSemver {
+			return &InvalidVersionNameError{Names: []string{version.Name}}
+		}
+
+		version.SemverKey = ""
+		version.IsPrerelease = false
+		return nil
+	}
+
+	version.SemverKey = semverSortKey(parsed)
+	version.IsPrerelease = parsed.Prerelease() != ""
+	return nil
+}
+
+// Returns an InvalidVersionNameError if any non-deleted version of the service is not a valid semantic version,
+// so a service can only be moved to semver mode once all its versions are.
+func checkVersionsAreSemver(tx *gorm.DB, serviceID string) error {
+	var names []string
+
+	if err := tx.Model(&Version{}).Where("service_id = ? AND deleted_at IS NULL AND semver_key = ''", serviceID).Order("name").Pluck("name", &names).Error; err != nil {
+		return err
+	}
+
+	if len(names) > 0 {
+		return &InvalidVersionNameError{Names: names}
+	}
+
+	return nil
+}
+
+// Loads the highest stable (not a pre-release) version of a non-deleted service in the organization,
+// by semantic precedence. Yanked and retired versions are skipped.
+func GetLatestVersion(organizationID int, serviceID string) (*Version, error) {
+	var version Version
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := activeVersionQuery(tx, organizationID, serviceID).
+		Where("versions.deleted_at IS NULL AND versions.semver_key != '' AND versions.is_prerelease = ?", false).
+		Where("versions.state NOT IN ?", []string{VersionStateYanked, VersionStateRetired}).
+		Order("versions.semver_key desc").
+		First(&version).Error; err != nil {
+		return nil, err
+	}
+
+	return &version, nil
+}
+
+// Fills in the semantic version fields of versions created before they existed.
+// Only versions without a sort key are looked at - after the first run, these are the versions whose names are not semantic versions.
+func backfillSemverKeys(db *gorm.DB) error {
+	var versions []Version
+
+	if err := db.Where("semver_key = ''").Find(&versions).Error; err != nil {
+		return err
+	}
+
+	for _, version := range versions {
+		parsed, err := ParseSemver(version.Name)
+		if err != nil {
+			continue
+		}
+
+		if err := db.Model(&version).UpdateColumns(map[string]interface{}{"semver_key": semverSortKey(parsed), "is_prerelease": parsed.Prerelease() != ""}).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -8,20 +8,23 @@ import (
 )
 
 // Service represents a service in the User's organization.
-// Could improve: unique name constraints for services within an org might be needed.
+// Names are unique within an org, ignoring soft deleted services - see uniqueness.go
 // Contains hasMany relationship with Version
 // https://gorm.io/docs/has_many.html
 type Service struct {
-	ID             string     `gorm:"primaryKey;type:char(36)"`   // ULID as the primary key - size 26 chars
-	Name           string     `gorm:"type:varchar(256);not null"` // Name of the service
-	Description    string     `gorm:"type:varchar(1024)"`         // Description about the service
-	UserID         int        `gorm:"type:int;not null"`          // ID of user who created the service
-	OrganizationID int        `gorm:"type:int;not null"`
-	CreatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP"`
-	UpdatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP"`
-	DeletedAt      *time.Time `gorm:"default null"`
-	VersionCount   int        `gorm:"type:int;not null;default:0"`
-	Versions       []Version  `gorm:"foreignKey:ServiceID"`
+	ID               string        `gorm:"primaryKey;type:char(36)"`   // ULID as the primary key - size 26 chars
+	Name             string        `gorm:"type:varchar(256);not null"` // Name of the service
+	Description      string        `gorm:"type:varchar(1024)"`         // Description about the service
+	UserID           int           `gorm:"type:int;not null"`          // ID of user who created the service
+	OrganizationID   int           `gorm:"type:int;not null"`
+	CreatedAt        time.Time     `gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt        time.Time     `gorm:"default:CURRENT_TIMESTAMP"`
+	DeletedAt        *time.Time    `gorm:"default null"`
+	VersionCount     int           `gorm:"type:int;not null;default:0"`
+	VersioningScheme string        `gorm:"type:varchar(16);not null;default:free"` // free or semver - in semver mode, version names must be semantic versions
+	Metadata         JSONMap       `gorm:"type:text"`                              // Custom fields, validated against the metadata schema of the organization
+	Versions         []Version     `gorm:"foreignKey:ServiceID"`
+	Links            []ServiceLink `gorm:"foreignKey:ServiceID"` // Only loaded for single services
 }
 
 // BeforeCreate GORM hook to generate a ULID before inserting a new service
@@ -31,41 +34,168 @@ func (s *Service) BeforeCreate(tx *gorm.DB) (err error) {
 }
 
 // Creates a Service and inserts into DB
+// Returns a DuplicateNameError if the organization already has a service with the same name, and
+// a MetadataValidationError if the metadata does not match the metadata schema of the organization.
 func CreateService(service *Service) (*Service, error) {
-	tx := DBInstance.Session(&gorm.Session{})
-	value := tx.Create(service)
-	if value.Error != nil {
-		return nil, value.Error
+	if service.VersioningScheme == "" {
+		service.VersioningScheme = VersioningSchemeFree
+	}
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := checkServiceNameAvailable(tx, service.OrganizationID, service.Name, ""); err != nil {
+			return err
+		}
+
+		if err := validateServiceMetadata(tx, service.OrganizationID, service.Metadata); err != nil {
+			return err
+		}
+
+		return tx.Create(service).Error
+	})
+
+	if err != nil {
+		return nil, translateUniqueNameError(err, "service", service.Name)
 	}
 	return service, nil
 }
 
-// Loads all non-deleted services and returns an array.
-func GetServices(organizationID int, pageSize int, pageNo int, sortField string, sortOrder string, filterField string, filterValue string) ([]Service, error) {
+// ServiceListFilter narrows down a list of services. The zero value matches every service.
+type ServiceListFilter struct {
+	Expression  *FilterExpression  // Columns must be whitelisted by the caller
+	Labels      []LabelRequirement // Label selector - services must match all the requirements
+	OwnerTeamID string             // Only services primarily owned by the team
+}
+
+// Loads a page of non-deleted services matching the filter, and returns an array - along with whether there are more
+// services after the page (or before it, when paging backwards). Pages start after the keyset, if given, and at the page number otherwise.
+// The sort fields must be whitelisted by the caller - see ServiceSortFields.
+func GetServices(organizationID int, pageSize int, pageNo int, sortFields []SortField, filter ServiceListFilter, keyset *Keyset) ([]Service, bool, error) {
 	var services []Service
 
-	tx := DBInstance.Session(&gorm.Session{})
+	keys := buildSortKeys(serviceSortableFields, sortFields)
+	if err := checkKeyset(keys, keyset); err != nil {
+		return nil, false, err
+	}
 
-	if filterField != "" && filterValue != "" {
-		tx = tx.Where(filterField+" = ?", filterValue)
+	tx, err := serviceListQuery(organizationID, filter)
+	if err != nil {
+		return nil, false, err
 	}
 
-	if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).Order(sortField + " " + sortOrder).Offset((pageNo - 1) * pageSize).Limit(pageSize).Find(&services).Error; err != nil {
-		return nil, err
+	if err := paginate(tx, keys, keyset, pageNo, pageSize).Find(&services).Error; err != nil {
+		return nil, false, err
 	}
 
-	return services, nil
+	services, hasMore := finishPage(services, pageSize, keyset)
+	return services, hasMore, nil
 }
 
-// Loads a single service by ID
-func GetServiceByID(serviceId string) (*Service, error) {
+// Counts the non-deleted services matching the filter
+func CountServices(organizationID int, filter ServiceListFilter) (int64, error) {
+	var count int64
+
+	tx, err := serviceListQuery(organizationID, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Query for the non-deleted services of an organization matching the filter
+func serviceListQuery(organizationID int, filter ServiceListFilter) (*gorm.DB, error) {
+	tx := DBInstance.Session(&gorm.Session{}).Model(&Service{})
+
+	// The label joins are wrapped in a subquery named services, so the columns of the labels table don't clash
+	// with the filter and sort columns. SQLite flattens it into a single query.
+	if len(filter.Labels) > 0 {
+		labelled, err := labelledServices(filter.Labels)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Table("(?) AS services", labelled)
+	}
+
+	if filter.Expression != nil {
+		filterClause, err := filter.Expression.Clause()
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where(filterClause)
+	}
+
+	if filter.OwnerTeamID != "" {
+		owned := DBInstance.Session(&gorm.Session{}).Model(&ServiceOwnership{}).Select("service_id").
+			Where("team_id = ? AND role = ?", filter.OwnerTeamID, OwnershipOwner)
+		tx = tx.Where("id IN (?)", owned)
+	}
+
+	return tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID), nil
+}
+
+// Loads a single non-deleted service by ID, from the given organization.
+// Services of other organizations are treated as not found.
+func GetServiceByID(organizationID int, serviceId string) (*Service, error) {
 	var service Service
 
 	tx := DBInstance.Session(&gorm.Session{})
 
-	if err := tx.First(&service, "id=?", serviceId).Error; err != nil {
+	if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).First(&service, "id=?", serviceId).Error; err != nil {
 		return nil, err
 	}
 
 	return &service, nil
 }
+
+// Updates the name, description, versioning scheme and metadata of a non-deleted service in the given organization, and bumps UpdatedAt.
+// An empty versioning scheme keeps the service's current scheme.
+// Returns gorm.ErrRecordNotFound if the service does not exist in the organization,
+// a DuplicateNameError if another service of the organization has the same name,
+// an InvalidVersionNameError if the service is moved to semver mode while some of its versions are not semantic versions, and
+// a MetadataValidationError if the metadata does not match the metadata schema of the organization.
+func UpdateService(organizationID int, serviceId string, name string, description string, versioningScheme string, metadata JSONMap) (*Service, error) {
+	var service Service
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).First(&service, "id = ?", serviceId).Error; err != nil {
+			return err
+		}
+
+		if err := checkServiceNameAvailable(tx, organizationID, name, service.ID); err != nil {
+			return err
+		}
+
+		if versioningScheme == "" {
+			versioningScheme = service.VersioningScheme
+		}
+
+		if versioningScheme == VersioningSchemeSemver && service.VersioningScheme != VersioningSchemeSemver {
+			if err := checkVersionsAreSemver(tx, service.ID); err != nil {
+				return err
+			}
+		}
+
+		if err := validateServiceMetadata(tx, organizationID, metadata); err != nil {
+			return err
+		}
+
+		service.Name = name
+		service.Description = description
+		service.VersioningScheme = versioningScheme
+		service.Metadata = metadata
+		service.UpdatedAt = time.Now().UTC()
+
+		// Select the columns explicitly, so an empty description and metadata are saved as well
+		return tx.Model(&service).Select("name", "description", "versioning_scheme", "metadata", "updated_at").Updates(&service).Error
+	})
+
+	if err != nil {
+		return nil, translateUniqueNameError(err, "service", name)
+	}
+
+	return &service, nil
+}
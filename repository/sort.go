@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"sort"
+	"strings"
+)
+
+// SortField is a field a list is ordered by, in ascending or descending order
+type SortField struct {
+	Name string
+	Desc bool
+}
+
+// Formats a list of sort fields the way clients send them - comma separated, with a "-" before descending fields.
+// For example "-version_count,name".
+func FormatSort(fields []SortField) string {
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		parts[i] = field.Name
+		if field.Desc {
+			parts[i] = "-" + field.Name
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// How a list can be sorted by a field - the keys the field orders by, and their values for a row.
+// Most fields have a single key, but semver first puts names which are not semantic versions last, in both orders.
+type sortableField[T any] struct {
+	keys   func(desc bool) []SortKey
+	values func(row T) []interface{}
+}
+
+func columnField[T any](column string, timestamp bool, value func(row T) interface{}) sortableField[T] {
+	return sortableField[T]{
+		keys: func(desc bool) []SortKey {
+			return []SortKey{{Column: column, Desc: desc, Timestamp: timestamp}}
+		},
+		values: func(row T) []interface{} {
+			return []interface{}{value(row)}
+		},
+	}
+}
+
+// Fields services can be sorted by
+var serviceSortableFields = map[string]sortableField[Service]{
+	"id":            columnField("id", false, func(s Service) interface{} { return s.ID }),
+	"name":          columnField("name", false, func(s Service) interface{} { return s.Name }),
+	"created_at":    columnField("created_at", true, func(s Service) interface{} { return formatStoredTimestamp(s.CreatedAt) }),
+	"updated_at":    columnField("updated_at", true, func(s Service) interface{} { return formatStoredTimestamp(s.UpdatedAt) }),
+	"version_count": columnField("version_count", false, func(s Service) interface{} { return s.VersionCount }),
+}
+
+// Fields versions can be sorted by. Sorting by semver orders versions by semantic precedence.
+var versionSortableFields = map[string]sortableField[Version]{
+	"id":         columnField("id", false, func(v Version) interface{} { return v.ID }),
+	"name":       columnField("name", false, func(v Version) interface{} { return v.Name }),
+	"state":      columnField("state", false, func(v Version) interface{} { return v.State }),
+	"created_at": columnField("created_at", true, func(v Version) interface{} { return formatStoredTimestamp(v.CreatedAt) }),
+	"updated_at": columnField("updated_at", true, func(v Version) interface{} { return formatStoredTimestamp(v.UpdatedAt) }),
+	"semver": {
+		keys: func(desc bool) []SortKey {
+			return []SortKey{{Column: "(semver_key = '')"}, {Column: "semver_key", Desc: desc}}
+		},
+		values: func(v Version) []interface{} {
+			// The value of semver_key = '' in SQLite
+			notSemver := 0
+			if v.SemverKey == "" {
+				notSemver = 1
+			}
+			return []interface{}{notSemver, v.SemverKey}
+		},
+	},
+}
+
+// Whitelists of the fields each list can be sorted by, for validating requests
+var (
+	ServiceSortFields = sortableFieldNames(serviceSortableFields)
+	VersionSortFields = sortableFieldNames(versionSortableFields)
+)
+
+func sortableFieldNames[T any](fields map[string]sortableField[T]) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Sort keys for a list of sort fields, followed by the ID as a tiebreaker - so the order is stable
+// even when rows have the same values. The tiebreaker follows the direction of the first field.
+// Fields which are not sortable are skipped, so callers must validate them against the whitelist.
+func buildSortKeys[T any](fields map[string]sortableField[T], sortFields []SortField) []SortKey {
+	var keys []SortKey
+
+	for _, sortField := range sortFields {
+		field, ok := fields[sortField.Name]
+		if !ok {
+			continue
+		}
+		keys = append(keys, field.keys(sortField.Desc)...)
+
+		// IDs are unique, so nothing after them affects the order
+		if sortField.Name == "id" {
+			return keys
+		}
+	}
+
+	desc := len(sortFields) > 0 && sortFields[0].Desc
+	return append(keys, SortKey{Column: "id", Desc: desc})
+}
+
+// Sort key values of a row, matching the keys from buildSortKeys
+func sortKeyValues[T any](fields map[string]sortableField[T], sortFields []SortField, row T, id string) []interface{} {
+	var values []interface{}
+
+	for _, sortField := range sortFields {
+		field, ok := fields[sortField.Name]
+		if !ok {
+			continue
+		}
+		values = append(values, field.values(row)...)
+
+		if sortField.Name == "id" {
+			return values
+		}
+	}
+
+	return append(values, id)
+}
+
+// Returns the sort key values of a service, for a keyset starting or ending at the service.
+func ServiceKeysetValues(service Service, sortFields []SortField) []interface{} {
+	return sortKeyValues(serviceSortableFields, sortFields, service, service.ID)
+}
+
+// Returns the sort key values of a version, for a keyset starting or ending at the version.
+func VersionKeysetValues(version Version, sortFields []SortField) []interface{} {
+	return sortKeyValues(versionSortableFields, sortFields, version, version.ID)
+}
@@ -0,0 +1,308 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Roles a team can have for a service. A service has at most one owner, and any number of maintainers.
+const (
+	OwnershipOwner      = "owner"      // The team primarily responsible for the service
+	OwnershipMaintainer = "maintainer" // A team which also works on the service
+)
+
+// Team is a group of Users within an Organization, which owns and maintains services.
+// Names are unique within an organization.
+type Team struct {
+	ID             string    `gorm:"primaryKey;type:char(36)"` // ULID as the primary key
+	OrganizationID int       `gorm:"type:int;not null;uniqueIndex:idx_teams_organization_name"`
+	Name           string    `gorm:"type:varchar(256);not null;uniqueIndex:idx_teams_organization_name"`
+	Description    string    `gorm:"type:varchar(1024)"`
+	CreatedAt      time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt      time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// BeforeCreate GORM hook to generate a ULID before inserting a new team
+func (t *Team) BeforeCreate(tx *gorm.DB) (err error) {
+	t.ID = ulid.Make().String()
+	return
+}
+
+// TeamMember makes a User a member of a Team. Users can be members of several teams.
+type TeamMember struct {
+	ID             int       `gorm:"unique;primaryKey;autoIncrement"`
+	TeamID         string    `gorm:"type:char(36);not null;uniqueIndex:idx_team_member"`
+	UserID         int       `gorm:"type:int;not null;uniqueIndex:idx_team_member;index"`
+	OrganizationID int       `gorm:"type:int;not null"`
+	CreatedAt      time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// ServiceOwnership links a Service to a Team which owns or maintains it
+type ServiceOwnership struct {
+	ID             int       `gorm:"unique;primaryKey;autoIncrement"`
+	ServiceID      string    `gorm:"type:char(36);not null;uniqueIndex:idx_service_ownership"`
+	TeamID         string    `gorm:"type:char(36);not null;uniqueIndex:idx_service_ownership;index"`
+	OrganizationID int       `gorm:"type:int;not null"`
+	Role           string    `gorm:"type:varchar(16);not null"` // owner or maintainer
+	CreatedAt      time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// ServiceOwners are the teams owning and maintaining a service
+type ServiceOwners struct {
+	Owner       *Team  // Primary owner of the service, nil if it has none
+	Maintainers []Team // Additional maintainers, ordered by name
+}
+
+// TeamService is a service a team owns or maintains, along with the role of the team
+type TeamService struct {
+	Service
+	Role string // owner or maintainer
+}
+
+// InvalidOwnersError is returned when the teams given as the owners of a service can't own it together
+type InvalidOwnersError struct {
+	Reason string
+}
+
+func (e *InvalidOwnersError) Error() string {
+	return e.Reason
+}
+
+// Makes sure a service has at most one owner, even when two requests race
+func ensurePrimaryOwnerIndex(db *gorm.DB) error {
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_service_ownerships_primary_owner ON service_ownerships (service_id) WHERE role = '" + OwnershipOwner + "'").Error
+}
+
+// Creates a team in the organization.
+// Returns a DuplicateNameError if the organization already has a team with the same name.
+func CreateTeam(team *Team) (*Team, error) {
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		var existing []Team
+		if err := tx.Where("organization_id = ? AND name = ?", team.OrganizationID, team.Name).Limit(1).Find(&existing).Error; err != nil {
+			return err
+		}
+
+		if len(existing) > 0 {
+			return &DuplicateNameError{Resource: "team", Name: team.Name, ExistingID: existing[0].ID}
+		}
+
+		return tx.Create(team).Error
+	})
+
+	if err != nil {
+		return nil, translateUniqueNameError(err, "team", team.Name)
+	}
+
+	return team, nil
+}
+
+// Loads all teams of an organization, ordered by name
+func GetTeams(organizationID int) ([]Team, error) {
+	var teams []Team
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("organization_id = ?", organizationID).Order("name").Find(&teams).Error; err != nil {
+		return nil, err
+	}
+
+	return teams, nil
+}
+
+// Loads a single team by ID, from the given organization.
+// Teams of other organizations are treated as not found.
+func GetTeamByID(organizationID int, teamID string) (*Team, error) {
+	var team Team
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("organization_id = ?", organizationID).First(&team, "id = ?", teamID).Error; err != nil {
+		return nil, err
+	}
+
+	return &team, nil
+}
+
+// Loads the non-deleted users who are members of a team, ordered by ID
+func GetTeamMembers(organizationID int, teamID string) ([]User, error) {
+	var users []User
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	err := tx.Joins("JOIN team_members ON team_members.user_id = users.id").
+		Where("team_members.team_id = ? AND team_members.organization_id = ?", teamID, organizationID).
+		Where("users.deleted_at IS NULL").
+		Order("users.id").
+		Find(&users).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Adds a user to a team. Adding a user who is already a member does nothing.
+// Both the user and the team must belong to the organization, otherwise gorm.ErrRecordNotFound is returned.
+func AddTeamMember(organizationID int, teamID string, userID int) (*TeamMember, error) {
+	member := TeamMember{TeamID: teamID, UserID: userID, OrganizationID: organizationID}
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", organizationID).First(&Team{}, "id = ?", teamID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).First(&User{}, "id = ?", userID).Error; err != nil {
+			return err
+		}
+
+		return tx.Where(TeamMember{TeamID: teamID, UserID: userID}).Attrs(member).FirstOrCreate(&member).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// Removes a user from a team
+func RemoveTeamMember(organizationID int, teamID string, userID int) error {
+	tx := DBInstance.Session(&gorm.Session{})
+
+	result := tx.Where("organization_id = ? AND team_id = ? AND user_id = ?", organizationID, teamID, userID).Delete(&TeamMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Loads the non-deleted services a team owns or maintains, ordered by name
+func GetTeamServices(organizationID int, teamID string) ([]TeamService, error) {
+	services := []TeamService{}
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	err := tx.Model(&Service{}).
+		Select("services.*, service_ownerships.role AS role").
+		Joins("JOIN service_ownerships ON service_ownerships.service_id = services.id").
+		Where("service_ownerships.team_id = ?", teamID).
+		Where("services.deleted_at IS NULL AND services.organization_id = ?", organizationID).
+		Order("services.name").Order("services.id").
+		Scan(&services).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return services, nil
+}
+
+// Loads the teams owning and maintaining a service
+func GetServiceOwners(organizationID int, serviceID string) (*ServiceOwners, error) {
+	return serviceOwners(DBInstance.Session(&gorm.Session{}), organizationID, serviceID)
+}
+
+func serviceOwners(tx *gorm.DB, organizationID int, serviceID string) (*ServiceOwners, error) {
+	var rows []struct {
+		Team
+		Role string
+	}
+
+	err := tx.Model(&Team{}).
+		Select("teams.*, service_ownerships.role AS role").
+		Joins("JOIN service_ownerships ON service_ownerships.team_id = teams.id").
+		Where("service_ownerships.service_id = ? AND service_ownerships.organization_id = ?", serviceID, organizationID).
+		Order("teams.name").
+		Scan(&rows).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	owners := &ServiceOwners{Maintainers: []Team{}}
+	for _, row := range rows {
+		if row.Role == OwnershipOwner {
+			team := row.Team
+			owners.Owner = &team
+		} else {
+			owners.Maintainers = append(owners.Maintainers, row.Team)
+		}
+	}
+
+	return owners, nil
+}
+
+// Replaces the owner and maintainers of a non-deleted service of the organization. An empty owner ID leaves the
+// service without an owner. Returns gorm.ErrRecordNotFound if the service does not exist in the organization, and
+// an InvalidOwnersError if a team does not exist in the organization, or is given both as the owner and a maintainer.
+func SetServiceOwners(organizationID int, serviceID string, ownerTeamID string, maintainerTeamIDs []string) (*ServiceOwners, error) {
+	var owners *ServiceOwners
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", organizationID).First(&Service{}, "id = ?", serviceID).Error; err != nil {
+			return err
+		}
+
+		ownerships := []ServiceOwnership{}
+		roles := map[string]string{}
+
+		if ownerTeamID != "" {
+			roles[ownerTeamID] = OwnershipOwner
+			ownerships = append(ownerships, ServiceOwnership{ServiceID: serviceID, TeamID: ownerTeamID, OrganizationID: organizationID, Role: OwnershipOwner})
+		}
+
+		for _, teamID := range maintainerTeamIDs {
+			if roles[teamID] == OwnershipOwner {
+				return &InvalidOwnersError{Reason: fmt.Sprintf("team %s can't be both the owner and a maintainer", teamID)}
+			}
+			if roles[teamID] == OwnershipMaintainer {
+				continue
+			}
+			roles[teamID] = OwnershipMaintainer
+			ownerships = append(ownerships, ServiceOwnership{ServiceID: serviceID, TeamID: teamID, OrganizationID: organizationID, Role: OwnershipMaintainer})
+		}
+
+		teamIDs := make([]string, 0, len(roles))
+		for teamID := range roles {
+			teamIDs = append(teamIDs, teamID)
+		}
+
+		var teamCount int64
+		if err := tx.Model(&Team{}).Where("organization_id = ? AND id IN ?", organizationID, teamIDs).Count(&teamCount).Error; err != nil {
+			return err
+		}
+
+		if int(teamCount) != len(teamIDs) {
+			return &InvalidOwnersError{Reason: "some of the teams do not exist in this organization"}
+		}
+
+		if err := tx.Where("service_id = ?", serviceID).Delete(&ServiceOwnership{}).Error; err != nil {
+			return err
+		}
+
+		if len(ownerships) > 0 {
+			if err := tx.Create(&ownerships).Error; err != nil {
+				return err
+			}
+		}
+
+		var err error
+		owners, err = serviceOwners(tx, organizationID, serviceID)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return owners, nil
+}
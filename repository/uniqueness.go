@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+)
+
+// DuplicateNameError is returned when a service, version, team or environment would get a name which is already in use -
+// service, team and environment names are unique within an organization, and version names are unique within a service.
+// Soft deleted rows do not count.
+type DuplicateNameError struct {
+	Resource   string // "service", "version", "team" or "environment"
+	Name       string
+	ExistingID string // ID of the row already using the name, if known
+}
+
+func (e *DuplicateNameError) Error() string {
+	if e.Resource == "version" {
+		return fmt.Sprintf("a version named %q already exists for this service", e.Name)
+	}
+	return fmt.Sprintf("a %s named %q already exists in this organization", e.Resource, e.Name)
+}
+
+// Partial unique indexes, which ignore soft deleted rows
+var uniqueNameIndexes = []struct {
+	name    string
+	table   string
+	scope   string // column the name is unique within
+	columns string
+}{
+	{name: "idx_services_organization_name_active", table: "services", scope: "organization_id", columns: "organization_id, name"},
+	{name: "idx_versions_service_name_active", table: "versions", scope: "service_id", columns: "service_id, name"},
+}
+
+// DuplicateName describes a name used by more than one non-deleted row of a table,
+// found in databases created before names were unique.
+type DuplicateName struct {
+	Table          string
+	OrganizationID int
+	ScopeID        string // Organization ID for services, service ID for versions
+	Name           string
+	Count          int
+	IDs            string // Comma separated IDs of the duplicates
+}
+
+// Creates the unique name indexes if they don't exist.
+// Databases created before names were unique might already contain duplicates - these are reported and
+// the index is skipped, so the application still starts. Duplicates must be renamed or deleted, after which
+// the index is created on the next start. New duplicates are rejected by the application in the meantime.
+func ensureUniqueNameIndexes(db *gorm.DB) error {
+	for _, index := range uniqueNameIndexes {
+		duplicates, err := findDuplicateNames(db, index.table, index.scope, 0)
+		if err != nil {
+			return err
+		}
+
+		if len(duplicates) > 0 {
+			fmt.Printf("Skipping unique index %s, %d duplicate names found in %s:\n", index.name, len(duplicates), index.table)
+			for _, duplicate := range duplicates {
+				fmt.Printf("  %s=%s name=%q count=%d ids=%s\n", index.scope, duplicate.ScopeID, duplicate.Name, duplicate.Count, duplicate.IDs)
+			}
+			continue
+		}
+
+		statement := fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (%s) WHERE deleted_at IS NULL", index.name, index.table, index.columns)
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Finds the duplicate service and version names of an organization
+func FindDuplicateNames(organizationID int) ([]DuplicateName, error) {
+	var allDuplicates []DuplicateName
+
+	for _, index := range uniqueNameIndexes {
+		duplicates, err := findDuplicateNames(DBInstance, index.table, index.scope, organizationID)
+		if err != nil {
+			return nil, err
+		}
+		allDuplicates = append(allDuplicates, duplicates...)
+	}
+
+	return allDuplicates, nil
+}
+
+// Finds names used by more than one non-deleted row within the same scope. Looks at all organizations if organizationID is 0.
+func findDuplicateNames(db *gorm.DB, table string, scope string, organizationID int) ([]DuplicateName, error) {
+	duplicates := []DuplicateName{}
+
+	tx := db.Session(&gorm.Session{}).Table(table).
+		Select("? AS \"table\", organization_id, "+scope+" AS scope_id, name, COUNT(*) AS count, GROUP_CONCAT(id) AS ids", table).
+		Where("deleted_at IS NULL")
+
+	if organizationID != 0 {
+		tx = tx.Where("organization_id = ?", organizationID)
+	}
+
+	if err := tx.Group("organization_id, " + scope + ", name").Having("COUNT(*) > 1").Scan(&duplicates).Error; err != nil {
+		return nil, err
+	}
+
+	return duplicates, nil
+}
+
+// Returns a DuplicateNameError if another non-deleted service of the organization has the given name
+func checkServiceNameAvailable(tx *gorm.DB, organizationID int, name string, serviceID string) error {
+	var existing []Service
+
+	if err := tx.Where("deleted_at IS NULL AND organization_id = ? AND name = ? AND id != ?", organizationID, name, serviceID).Limit(1).Find(&existing).Error; err != nil {
+		return err
+	}
+
+	if len(existing) > 0 {
+		return &DuplicateNameError{Resource: "service", Name: name, ExistingID: existing[0].ID}
+	}
+
+	return nil
+}
+
+// Returns a DuplicateNameError if another non-deleted version of the service has the given name
+func checkVersionNameAvailable(tx *gorm.DB, serviceID string, name string, versionID string) error {
+	var existing []Version
+
+	if err := tx.Where("deleted_at IS NULL AND service_id = ? AND name = ? AND id != ?", serviceID, name, versionID).Limit(1).Find(&existing).Error; err != nil {
+		return err
+	}
+
+	if len(existing) > 0 {
+		return &DuplicateNameError{Resource: "version", Name: name, ExistingID: existing[0].ID}
+	}
+
+	return nil
+}
+
+// Maps violations of the unique name indexes (for example, when two requests race) to a DuplicateNameError
+func translateUniqueNameError(err error, resource string, name string) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return &DuplicateNameError{Resource: resource, Name: name}
+	}
+	return err
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // User represents a customer who belongs to an Organization.
@@ -9,6 +11,7 @@ type User struct {
 	ID             int        `gorm:"unique;primaryKey;autoIncrement"`
 	Name           string     `gorm:"type:varchar(256);not null"`
 	Email          string     `gorm:"type:varchar(512);not null"`
+	Role           string     `gorm:"type:varchar(16);not null;default:viewer"` // Organization wide role - viewer, editor or admin
 	OrganizationID int        `gorm:"type:int;not null"`
 	CreatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP"`
 	UpdatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP"`
@@ -16,3 +19,16 @@ type User struct {
 	Services       []Service  `gorm:"foreignKey:UserID"`
 	Versions       []Version  `gorm:"foreignKey:UserID"`
 }
+
+// Loads a single non-deleted user by ID
+func GetUserByID(userID int) (*User, error) {
+	var user User
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("deleted_at IS NULL").First(&user, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -8,11 +8,18 @@ import (
 )
 
 // Version represents a version of the service in the User's organization.
-// Unique name constraint might be useful for <Name, ServiceId> - so no two versions have same name
+// Names are unique within a service, ignoring soft deleted versions - see uniqueness.go
+// Versions start out active, and move through the lifecycle states in lifecycle.go.
 type Version struct {
 	ID             string     `gorm:"primaryKey;type:char(36)"`
 	Name           string     `gorm:"type:varchar(256);not null"`
 	ServiceID      string     `gorm:"type:char(36);not null"`
+	Metadata       JSONMap    `gorm:"type:text"`                                            // Free form metadata about the version, for example the commit it was built from
+	SemverKey      string     `gorm:"type:varchar(512);not null;default:'';index" json:"-"` // Sortable form of the semantic version, empty if the name is not a semantic version
+	IsPrerelease   bool       `gorm:"not null;default:false"`                               // True if the name is a semantic version with a pre-release part, for example 1.0.0-rc.1
+	State          string     `gorm:"type:varchar(16);not null;default:active;index"`       // Lifecycle state - see lifecycle.go
+	DeprecatedAt   *time.Time `gorm:"default null"`                                         // When the version was, or will be, deprecated
+	SunsetAt       *time.Time `gorm:"default null"`                                         // When a deprecated version is expected to be retired
 	UserID         int        `gorm:"type:int;not null"`
 	OrganizationID int        `gorm:"type:int;not null"`
 	CreatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP"`
@@ -27,9 +34,27 @@ func (v *Version) BeforeCreate(tx *gorm.DB) (err error) {
 }
 
 // Creates a Service Version and inserts into DB, also updates the version count
+// The service must belong to the organization of the version, otherwise gorm.ErrRecordNotFound is returned.
+// Returns a DuplicateNameError if the service already has a version with the same name, and
+// an InvalidVersionNameError if the service is in semver mode and the name is not a semantic version.
 func CreateVersion(version *Version) (*Version, error) {
 	// Use a transaction to keep version count in Service consistent.
 	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		var service Service
+		if err := tx.Where("deleted_at IS NULL").Where("organization_id = ?", version.OrganizationID).First(&service, "id = ?", version.ServiceID).Error; err != nil {
+			return err
+		}
+
+		if err := setSemverFields(version, service.VersioningScheme); err != nil {
+			return err
+		}
+
+		version.State = VersionStateActive
+
+		if err := checkVersionNameAvailable(tx, version.ServiceID, version.Name, ""); err != nil {
+			return err
+		}
+
 		if err := tx.Create(version).Error; err != nil {
 			// Return error to rollback
 			return err
@@ -48,22 +73,123 @@ func CreateVersion(version *Version) (*Version, error) {
 	})
 
 	if err != nil {
-		return nil, err
+		return nil, translateUniqueNameError(err, "version", version.Name)
 	}
 
 	return version, nil
 }
 
-// Loads all non deleted versions for a given service, and supports pagination
-func GetServiceVersions(version Version, pageNumber int, pageSize int) ([]Version, error) {
+// Loads a page of non deleted versions for a given service in the version's organization, and supports filtering by state, sorting and pagination.
+// Also returns whether there are more versions after the page (or before it, when paging backwards).
+// Sorting by "semver" orders versions by semantic precedence, with names that are not semantic versions at the end.
+// The sort fields must be whitelisted by the caller - see VersionSortFields.
+func GetServiceVersions(version Version, states []string, pageNumber int, pageSize int, sortFields []SortField, keyset *Keyset) ([]Version, bool, error) {
 	var versions []Version
+
+	keys := buildSortKeys(versionSortableFields, sortFields)
+	if err := checkKeyset(keys, keyset); err != nil {
+		return nil, false, err
+	}
+
+	if err := paginate(versionListQuery(version, states), keys, keyset, pageNumber, pageSize).Find(&versions).Error; err != nil {
+		return nil, false, err
+	}
+
+	versions, hasMore := finishPage(versions, pageSize, keyset)
+	return versions, hasMore, nil
+}
+
+// Counts the non deleted versions for a given service in the version's organization, in any of the states if given
+func CountServiceVersions(version Version, states []string) (int64, error) {
+	var count int64
+
+	if err := versionListQuery(version, states).Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Query for the non deleted versions for a given service in the version's organization, in any of the states if given
+func versionListQuery(version Version, states []string) *gorm.DB {
+	tx := DBInstance.Session(&gorm.Session{}).Model(&Version{})
+
+	if len(states) > 0 {
+		tx = tx.Where("state IN ?", states)
+	}
+
+	return tx.Where("service_id = ?", version.ServiceID).Where("organization_id = ?", version.OrganizationID).Where("deleted_at IS NULL")
+}
+
+// Loads a single non-deleted version of a non-deleted service in the organization, by ID
+func GetVersionByID(organizationID int, serviceID string, versionID string) (*Version, error) {
+	var version Version
+
 	tx := DBInstance.Session(&gorm.Session{})
 
-	value := tx.Where("service_id = ?", version.ServiceID).Where("deleted_at IS NULL").Offset((pageNumber - 1) * pageSize).Limit(pageSize).Find(&versions)
+	if err := activeVersionQuery(tx, organizationID, serviceID).Where("versions.deleted_at IS NULL").First(&version, "versions.id = ?", versionID).Error; err != nil {
+		return nil, err
+	}
 
-	if value.Error != nil {
-		return nil, value.Error
+	return &version, nil
+}
+
+// Loads a single non-deleted version of a non-deleted service in the organization, by name
+func GetVersionByName(organizationID int, serviceID string, name string) (*Version, error) {
+	var version Version
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := activeVersionQuery(tx, organizationID, serviceID).Where("versions.deleted_at IS NULL").Where("versions.name = ?", name).Order("versions.created_at desc").First(&version).Error; err != nil {
+		return nil, err
+	}
+
+	return &version, nil
+}
+
+// Updates the name and metadata of a non-deleted version, and bumps UpdatedAt.
+// Returns gorm.ErrRecordNotFound if the version does not exist in a non-deleted service of the organization, and
+// a DuplicateNameError if another version of the service has the same name, and
+// an InvalidVersionNameError if the service is in semver mode and the name is not a semantic version.
+func UpdateVersion(organizationID int, serviceID string, versionID string, name string, metadata JSONMap) (*Version, error) {
+	var version Version
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := activeVersionQuery(tx, organizationID, serviceID).Where("versions.deleted_at IS NULL").First(&version, "versions.id = ?", versionID).Error; err != nil {
+			return err
+		}
+
+		if err := checkVersionNameAvailable(tx, serviceID, name, version.ID); err != nil {
+			return err
+		}
+
+		var service Service
+		if err := tx.First(&service, "id = ?", serviceID).Error; err != nil {
+			return err
+		}
+
+		version.Name = name
+		version.Metadata = metadata
+		version.UpdatedAt = time.Now().UTC()
+
+		if err := setSemverFields(&version, service.VersioningScheme); err != nil {
+			return err
+		}
+
+		// Select the columns explicitly, so metadata can be cleared as well
+		return tx.Model(&version).Select("name", "metadata", "semver_key", "is_prerelease", "updated_at").Updates(&version).Error
+	})
+
+	if err != nil {
+		return nil, translateUniqueNameError(err, "version", name)
 	}
 
-	return versions, nil
+	return &version, nil
+}
+
+// Query for versions of a given non-deleted service in the organization
+func activeVersionQuery(tx *gorm.DB, organizationID int, serviceID string) *gorm.DB {
+	return tx.Model(&Version{}).
+		Joins("JOIN services ON services.id = versions.service_id AND services.deleted_at IS NULL").
+		Where("versions.organization_id = ? AND versions.service_id = ?", organizationID, serviceID)
 }
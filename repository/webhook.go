@@ -0,0 +1,379 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Catalog change events webhooks can subscribe to
+const (
+	EventServiceCreated = "service.created"
+	EventServiceUpdated = "service.updated"
+	EventServiceDeleted = "service.deleted"
+	EventVersionCreated = "version.created"
+	EventVersionUpdated = "version.updated"
+	EventVersionDeleted = "version.deleted"
+)
+
+// WebhookEvents lists every event type, in the order they are documented
+var WebhookEvents = []string{EventServiceCreated, EventServiceUpdated, EventServiceDeleted, EventVersionCreated, EventVersionUpdated, EventVersionDeleted}
+
+// Statuses of a webhook delivery
+const (
+	WebhookDeliveryPending   = "pending"   // Waiting for its first attempt, or for a retry
+	WebhookDeliverySending   = "sending"   // Claimed by a sender, which is attempting it
+	WebhookDeliverySucceeded = "succeeded" // The receiver answered with a 2xx status
+	WebhookDeliveryFailed    = "failed"    // Every attempt failed, and it won't be retried unless redelivered
+)
+
+// ErrWebhookDeliveryInProgress is returned when redelivering a delivery which is being sent
+var ErrWebhookDeliveryInProgress = errors.New("the delivery is being sent")
+
+// Prefix of every webhook secret we issue, so secrets are easy to recognise
+const webhookSecretPrefix = "whsec_"
+
+// WebhookSubscription sends the catalog change events of an Organization to a URL.
+// Deliveries are signed with the secret, which is returned once, when the subscription is created.
+type WebhookSubscription struct {
+	ID             string    `gorm:"primaryKey;type:char(36)"` // ULID as the primary key
+	OrganizationID int       `gorm:"type:int;not null;index"`
+	URL            string    `gorm:"type:varchar(2048);not null"`
+	Description    string    `gorm:"type:varchar(1024)"`
+	Events         []string  `gorm:"type:text;not null;serializer:json"` // Event types sent to the URL
+	Secret         string    `gorm:"type:varchar(64);not null" json:"-"` // Key the deliveries are signed with, using HMAC-SHA256
+	Active         bool      `gorm:"not null"`                           // Inactive subscriptions don't get new deliveries
+	UserID         int       `gorm:"type:int;not null"`                  // User who created the subscription
+	CreatedAt      time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt      time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// BeforeCreate GORM hook to generate a ULID before inserting a new subscription
+func (s *WebhookSubscription) BeforeCreate(tx *gorm.DB) (err error) {
+	s.ID = ulid.Make().String()
+	return
+}
+
+// WebhookDelivery is an event being sent to a WebhookSubscription, retried until the receiver accepts it
+type WebhookDelivery struct {
+	ID             string          `gorm:"primaryKey;type:char(36)"` // ULID as the primary key, sent to receivers so they can skip duplicates
+	OrganizationID int             `gorm:"type:int;not null"`
+	SubscriptionID string          `gorm:"type:char(36);not null;index"`
+	Event          string          `gorm:"type:varchar(64);not null"`
+	Payload        json.RawMessage `gorm:"type:text;not null"`        // The resource the event is about, as returned by the API
+	Status         string          `gorm:"type:varchar(16);not null"` // pending, succeeded or failed
+	AttemptCount   int             `gorm:"not null;default:0"`        // Attempts since the delivery was created, or last redelivered
+	NextAttemptAt  *time.Time      `gorm:"default null;index"`        // When the delivery is due, or its claim expires while sending. Nil once it succeeded or failed.
+	DeliveredAt    *time.Time      `gorm:"default null"`
+	CreatedAt      time.Time       `gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt      time.Time       `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// BeforeCreate GORM hook to generate a ULID before inserting a new delivery
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) (err error) {
+	d.ID = ulid.Make().String()
+	return
+}
+
+// WebhookDeliveryAttempt records a single attempt of a WebhookDelivery, and how the receiver answered
+type WebhookDeliveryAttempt struct {
+	ID           int       `gorm:"unique;primaryKey;autoIncrement"`
+	DeliveryID   string    `gorm:"type:char(36);not null;index"`
+	StatusCode   int       `gorm:"type:int"`           // HTTP status of the response, 0 if there was none
+	ResponseBody string    `gorm:"type:varchar(1024)"` // Start of the response body
+	Error        string    `gorm:"type:varchar(1024)"` // Why the request failed, empty if the receiver answered
+	DurationMs   int64     `gorm:"not null"`
+	AttemptedAt  time.Time `gorm:"not null"`
+}
+
+// WebhookDeliveryDetails is a delivery along with its attempt history, oldest first
+type WebhookDeliveryDetails struct {
+	WebhookDelivery
+	Attempts []WebhookDeliveryAttempt
+}
+
+// Returns true if the given string is one of the event types
+func IsValidWebhookEvent(event string) bool {
+	for _, known := range WebhookEvents {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Generates a new random webhook signing secret
+func GenerateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return webhookSecretPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// Creates a webhook subscription and inserts into DB
+func CreateWebhookSubscription(subscription *WebhookSubscription) (*WebhookSubscription, error) {
+	tx := DBInstance.Session(&gorm.Session{})
+	if err := tx.Create(subscription).Error; err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// Loads all webhook subscriptions of an organization, oldest first
+func GetWebhookSubscriptions(organizationID int) ([]WebhookSubscription, error) {
+	subscriptions := []WebhookSubscription{}
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("organization_id = ?", organizationID).Order("id").Find(&subscriptions).Error; err != nil {
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+// Loads a single webhook subscription by ID, from the given organization.
+// Subscriptions of other organizations are treated as not found.
+func GetWebhookSubscription(organizationID int, subscriptionID string) (*WebhookSubscription, error) {
+	var subscription WebhookSubscription
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("organization_id = ?", organizationID).First(&subscription, "id = ?", subscriptionID).Error; err != nil {
+		return nil, err
+	}
+
+	return &subscription, nil
+}
+
+// Updates the URL, description, events and state of a webhook subscription of the organization.
+// Deliveries already created keep going to the subscription's new URL.
+func UpdateWebhookSubscription(organizationID int, subscriptionID string, url string, description string, events []string, active bool) (*WebhookSubscription, error) {
+	subscription, err := GetWebhookSubscription(organizationID, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription.URL = url
+	subscription.Description = description
+	subscription.Events = events
+	subscription.Active = active
+	subscription.UpdatedAt = time.Now().UTC()
+
+	tx := DBInstance.Session(&gorm.Session{})
+	if err := tx.Select("url", "description", "events", "active", "updated_at").Save(subscription).Error; err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+// Deletes a webhook subscription of the organization, along with its deliveries and their attempts
+func DeleteWebhookSubscription(organizationID int, subscriptionID string) error {
+	return DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", organizationID).First(&WebhookSubscription{}, "id = ?", subscriptionID).Error; err != nil {
+			return err
+		}
+
+		deliveryIDs := tx.Model(&WebhookDelivery{}).Select("id").Where("subscription_id = ?", subscriptionID)
+		if err := tx.Where("delivery_id IN (?)", deliveryIDs).Delete(&WebhookDeliveryAttempt{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("subscription_id = ?", subscriptionID).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&WebhookSubscription{}, "id = ?", subscriptionID).Error
+	})
+}
+
+// Creates a pending delivery of an event for each active subscription of the organization to the event type, due right away
+func CreateWebhookDeliveries(organizationID int, event string, payload json.RawMessage) ([]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		var subscriptions []WebhookSubscription
+		if err := tx.Where("organization_id = ? AND active = ?", organizationID, true).Order("id").Find(&subscriptions).Error; err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		for _, subscription := range subscriptions {
+			for _, subscribed := range subscription.Events {
+				if subscribed != event {
+					continue
+				}
+
+				delivery := WebhookDelivery{
+					OrganizationID: organizationID,
+					SubscriptionID: subscription.ID,
+					Event:          event,
+					Payload:        payload,
+					Status:         WebhookDeliveryPending,
+					NextAttemptAt:  &now,
+				}
+				if err := tx.Create(&delivery).Error; err != nil {
+					return err
+				}
+				deliveries = append(deliveries, delivery)
+				break
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Loads up to limit deliveries due at the given time, across all organizations, the longest overdue first.
+// Deliveries whose sender stopped before recording the attempt are due again once their claim expires.
+func GetDueWebhookDeliveries(now time.Time, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	err := tx.Where("status IN (?, ?) AND julianday(next_attempt_at) <= julianday(?)", WebhookDeliveryPending, WebhookDeliverySending, formatStoredTimestamp(now)).
+		Order("julianday(next_attempt_at)").Order("id").
+		Limit(limit).
+		Find(&deliveries).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Claims a due delivery for sending until claimedUntil, so no other sender attempts it meanwhile.
+// The claim is a single conditional update, and returns false if the delivery is not due anymore - for example,
+// because another sender claimed it first.
+func ClaimWebhookDelivery(delivery *WebhookDelivery, now time.Time, claimedUntil time.Time) (bool, error) {
+	tx := DBInstance.Session(&gorm.Session{})
+
+	result := tx.Model(&WebhookDelivery{}).
+		Where("id = ? AND status IN (?, ?) AND julianday(next_attempt_at) <= julianday(?)", delivery.ID, WebhookDeliveryPending, WebhookDeliverySending, formatStoredTimestamp(now)).
+		Updates(map[string]interface{}{"status": WebhookDeliverySending, "next_attempt_at": claimedUntil, "updated_at": time.Now().UTC()})
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	delivery.Status = WebhookDeliverySending
+	delivery.NextAttemptAt = &claimedUntil
+	return true, nil
+}
+
+// Records an attempt of a delivery, and moves the delivery to the given status.
+// Pending deliveries are retried at nextAttemptAt, which is ignored for the other statuses.
+func RecordWebhookAttempt(delivery *WebhookDelivery, attempt *WebhookDeliveryAttempt, status string, nextAttemptAt time.Time) error {
+	return DBInstance.Transaction(func(tx *gorm.DB) error {
+		attempt.DeliveryID = delivery.ID
+		if err := tx.Create(attempt).Error; err != nil {
+			return err
+		}
+
+		delivery.Status = status
+		delivery.AttemptCount++
+		delivery.NextAttemptAt = nil
+		switch status {
+		case WebhookDeliveryPending:
+			delivery.NextAttemptAt = &nextAttemptAt
+		case WebhookDeliverySucceeded:
+			delivery.DeliveredAt = &attempt.AttemptedAt
+		}
+		delivery.UpdatedAt = time.Now().UTC()
+
+		return tx.Model(delivery).Select("status", "attempt_count", "next_attempt_at", "delivered_at", "updated_at").Updates(delivery).Error
+	})
+}
+
+// Loads the deliveries of a webhook subscription of the organization, newest first
+func GetWebhookDeliveries(organizationID int, subscriptionID string, pageSize int, pageNo int) ([]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	err := tx.Where("organization_id = ? AND subscription_id = ?", organizationID, subscriptionID).
+		Order("id desc").
+		Offset((pageNo - 1) * pageSize).Limit(pageSize).
+		Find(&deliveries).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Loads a single delivery of a webhook subscription of the organization, along with its attempt history
+func GetWebhookDelivery(organizationID int, subscriptionID string, deliveryID string) (*WebhookDeliveryDetails, error) {
+	var details WebhookDeliveryDetails
+
+	tx := DBInstance.Session(&gorm.Session{})
+
+	if err := tx.Where("organization_id = ? AND subscription_id = ?", organizationID, subscriptionID).First(&details.WebhookDelivery, "id = ?", deliveryID).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("delivery_id = ?", deliveryID).Order("id").Find(&details.Attempts).Error; err != nil {
+		return nil, err
+	}
+
+	return &details, nil
+}
+
+// Gives a delivery of a webhook subscription of the organization a fresh set of attempts, and claims it for sending
+// until claimedUntil. Its attempt history is kept.
+// Returns ErrWebhookDeliveryInProgress if another sender has claimed the delivery.
+func ResetWebhookDelivery(organizationID int, subscriptionID string, deliveryID string, now time.Time, claimedUntil time.Time) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+
+	err := DBInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ? AND subscription_id = ?", organizationID, subscriptionID).First(&delivery, "id = ?", deliveryID).Error; err != nil {
+			return err
+		}
+
+		delivery.Status = WebhookDeliverySending
+		delivery.AttemptCount = 0
+		delivery.NextAttemptAt = &claimedUntil
+		delivery.UpdatedAt = time.Now().UTC()
+
+		// Conditional, so a sender claiming the delivery at the same time is never overridden
+		result := tx.Model(&delivery).
+			Where("(status <> ? OR julianday(next_attempt_at) <= julianday(?))", WebhookDeliverySending, formatStoredTimestamp(now)).
+			Select("status", "attempt_count", "next_attempt_at", "updated_at").Updates(&delivery)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrWebhookDeliveryInProgress
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
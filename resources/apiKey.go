@@ -0,0 +1,9 @@
+package resources
+
+import "time"
+
+// Represents the request body for creating an API key
+type APIKeyRequestBody struct {
+	Name      string     `json:"name" binding:"required,min=1,max=256"` // Name is a string, required should be less than 256 chars long
+	ExpiresAt *time.Time `json:"expires_at"`                            // ExpiresAt is optional, RFC 3339 timestamp after which the key stops working
+}
@@ -0,0 +1,6 @@
+package resources
+
+// Represents the request body for declaring a dependency of a service on another service
+type DependencyRequestBody struct {
+	VersionRange string `json:"version_range" binding:"max=256"` // VersionRange is not required, and must be a semantic version range like ^1.2.0
+}
@@ -0,0 +1,19 @@
+package resources
+
+import (
+	"time"
+)
+
+// Represents the request body for recording a deployment of a version of a service
+type DeploymentRequestBody struct {
+	VersionID     string     `json:"version_id" binding:"required"`                                 // VersionID is required, and must be a version of the service
+	EnvironmentID string     `json:"environment_id" binding:"required"`                             // EnvironmentID is required, and must be an environment of the organization
+	Status        string     `json:"status" binding:"omitempty,oneof=in_progress succeeded failed"` // Status is not required, and defaults to succeeded
+	DeployedAt    *time.Time `json:"deployed_at"`                                                   // DeployedAt is not required, and defaults to now. Can not be in the future.
+	RollbackOf    string     `json:"rollback_of"`                                                   // RollbackOf is not required, and is the ID of the successful deployment this one rolls back
+}
+
+// Represents the request body for finishing an in progress deployment
+type DeploymentStatusRequestBody struct {
+	Status string `json:"status" binding:"required,oneof=succeeded failed"` // Status is required, and must be succeeded or failed
+}
@@ -0,0 +1,18 @@
+package resources
+
+// Represents the request body for creating an environment
+type EnvironmentRequestBody struct {
+	Name        string `json:"name" binding:"required,min=1,max=63"` // Name is required, unique within the organization, and made of lowercase letters, digits and "-"
+	Description string `json:"description" binding:"max=1024"`       // Description is not required, and can be up to 1024 characters
+}
+
+// Represents the request body for setting the promotion pipeline of an organization
+type EnvironmentPipelineRequestBody struct {
+	EnvironmentIDs []string `json:"environment_ids" binding:"required,max=20"` // EnvironmentIDs is required, and lists environments of the organization in promotion order
+}
+
+// Represents the request body for setting the promotion gates of an environment
+type EnvironmentGatesRequestBody struct {
+	MinSoakMinutes    *int `json:"min_soak_minutes" binding:"required,min=0,max=43200"` // MinSoakMinutes is required, and can be up to 30 days
+	RequiredApprovals *int `json:"required_approvals" binding:"required,min=0,max=10"`  // RequiredApprovals is required, and can be up to 10
+}
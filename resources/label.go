@@ -0,0 +1,6 @@
+package resources
+
+// Represents the request body for setting a label on a service
+type LabelRequestBody struct {
+	Value string `json:"value"` // Value of the label - can be left out for labels which work as tags
+}
@@ -0,0 +1,8 @@
+package resources
+
+// Represents the request body for creating or updating a service link
+type LinkRequestBody struct {
+	Type  string `json:"type" binding:"required,oneof=repo runbook dashboard docs on-call chat"` // Type is required, and must be one of the link types
+	Title string `json:"title" binding:"max=256"`                                                // Title is not required, and can be up to 256 characters
+	URL   string `json:"url" binding:"required,max=2048"`                                        // URL is required, and must be an absolute http or https URL
+}
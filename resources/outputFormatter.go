@@ -1,6 +1,9 @@
 package resources
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -13,6 +16,31 @@ func SendSuccess(c *gin.Context, status int, data interface{}, meta interface{})
 	})
 }
 
+// Sends a standard response for a page of a paginated list. The links to the neighbouring pages are sent in the body,
+// and in a Link header (RFC 8288).
+func SendPage(c *gin.Context, status int, data interface{}, meta interface{}, links Links) {
+	var header []string
+	for _, link := range []struct {
+		rel    string
+		target *string
+	}{{"first", links.First}, {"prev", links.Prev}, {"next", links.Next}, {"last", links.Last}} {
+		if link.target != nil {
+			header = append(header, fmt.Sprintf("<%s>; rel=\"%s\"", *link.target, link.rel))
+		}
+	}
+
+	if len(header) > 0 {
+		c.Header("Link", strings.Join(header, ", "))
+	}
+
+	c.JSON(status, Response{
+		Meta:  meta,
+		Data:  data,
+		Error: nil,
+		Links: &links,
+	})
+}
+
 // Sends a standard error response.
 func SendError(c *gin.Context, status int, err interface{}) {
 	c.JSON(status, Response{
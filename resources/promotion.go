@@ -0,0 +1,13 @@
+package resources
+
+// Represents the request body for promoting a version of a service to the next environment of the pipeline
+type PromotionRequestBody struct {
+	VersionID     string `json:"version_id" binding:"required"`                          // VersionID is required, and must be a version of the service
+	EnvironmentID string `json:"environment_id" binding:"required"`                      // EnvironmentID is required, and must be an environment of the pipeline
+	Status        string `json:"status" binding:"omitempty,oneof=in_progress succeeded"` // Status of the resulting deployment is not required, and defaults to succeeded
+}
+
+// Represents the request body for approving a version of a service for promotion to an environment
+type ApprovalRequestBody struct {
+	EnvironmentID string `json:"environment_id" binding:"required"` // EnvironmentID is required, and must be an environment of the organization
+}
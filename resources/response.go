@@ -2,7 +2,16 @@ package resources
 
 // Standard API response structure
 type Response struct {
-	Data  interface{} `json:"data"`  // actual response data
-	Meta  interface{} `json:"meta"`  // metadata about the response, such as pagination information
-	Error interface{} `json:"error"` // error details if status is "error"
+	Data  interface{} `json:"data"`            // actual response data
+	Meta  interface{} `json:"meta"`            // metadata about the response, such as pagination information
+	Error interface{} `json:"error"`           // error details if status is "error"
+	Links *Links      `json:"links,omitempty"` // links to the neighbouring pages, for paginated lists
+}
+
+// Links to the pages of a paginated list, as paths with a query string - like /services?cursor=... Links to pages which don't exist are null.
+type Links struct {
+	First *string `json:"first"`
+	Prev  *string `json:"prev"`
+	Next  *string `json:"next"`
+	Last  *string `json:"last"`
 }
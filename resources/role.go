@@ -0,0 +1,6 @@
+package resources
+
+// Represents the request body for assigning a role to a user
+type RoleRequestBody struct {
+	Role string `json:"role" binding:"required,oneof=viewer editor admin"` // Role is required, and must be one of viewer, editor and admin
+}
@@ -2,6 +2,14 @@ package resources
 
 // Represents the request body for creating a service
 type ServiceRequestBody struct {
-	Name        string `json:"name" binding:"required,min=1,max=256"` // Name is a string, required should be less than 256 chars long
-	Description string `json:"description" binding:"max=1024"`        // Description is not required, and can be up to 1024 characters
+	Name             string                 `json:"name" binding:"required,min=1,max=256"`                   // Name is a string, required should be less than 256 chars long
+	Description      string                 `json:"description" binding:"max=1024"`                          // Description is not required, and can be up to 1024 characters
+	VersioningScheme string                 `json:"versioning_scheme" binding:"omitempty,oneof=free semver"` // VersioningScheme is not required, and must be one of free (default) and semver
+	Metadata         map[string]interface{} `json:"metadata"`                                                // Metadata is optional, and must match the metadata schema of the organization, if it has one
 }
+
+// Media types supported by the PATCH endpoints
+const (
+	MergePatchMediaType = "application/merge-patch+json" // JSON Merge Patch - https://datatracker.ietf.org/doc/html/rfc7396
+	JSONPatchMediaType  = "application/json-patch+json"  // JSON Patch - https://datatracker.ietf.org/doc/html/rfc6902
+)
@@ -0,0 +1,13 @@
+package resources
+
+// Represents the request body for creating a team
+type TeamRequestBody struct {
+	Name        string `json:"name" binding:"required,min=1,max=256"` // Name is required, and unique within the organization
+	Description string `json:"description" binding:"max=1024"`        // Description is not required, and can be up to 1024 characters
+}
+
+// Represents the request body for reassigning the ownership of a service
+type ServiceOwnersRequestBody struct {
+	OwnerTeamID       string   `json:"owner_team_id"`                        // Team primarily owning the service - can be left out for services without an owner
+	MaintainerTeamIDs []string `json:"maintainer_team_ids" binding:"max=50"` // Teams which also maintain the service
+}
@@ -1,9 +1,27 @@
 package resources
 
-import "github.com/oklog/ulid/v2"
+import (
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
 
 // Represents the request body for creating a service version
 type VersionRequestBody struct {
-	Name      string    `json:"name" binding:"required,min=1,max=256"` // Name is a string, required should be less than 256 chars long
-	ServiceID ulid.ULID `json:"description" binding:"max=26"`          // ServiceID is required, and can be up to 26 characters
+	Name      string                 `json:"name" binding:"required,min=1,max=256"` // Name is a string, required should be less than 256 chars long
+	ServiceID ulid.ULID              `json:"description" binding:"max=26"`          // ServiceID is required, and can be up to 26 characters
+	Metadata  map[string]interface{} `json:"metadata"`                              // Metadata is optional, and can be any JSON object
+}
+
+// Represents the request body for updating a service version
+type VersionUpdateRequestBody struct {
+	Name     string                 `json:"name" binding:"required,min=1,max=256"` // Name is a string, required should be less than 256 chars long
+	Metadata map[string]interface{} `json:"metadata"`                              // Metadata is optional, and can be any JSON object
+}
+
+// Represents the request body for moving a service version to another lifecycle state
+type VersionTransitionRequestBody struct {
+	State        string     `json:"state" binding:"required,oneof=active deprecated yanked retired"` // State is required, and must be one of the lifecycle states
+	DeprecatedAt *time.Time `json:"deprecated_at"`                                                   // DeprecatedAt is optional, and only allowed when deprecating. Defaults to now.
+	SunsetAt     *time.Time `json:"sunset_at"`                                                       // SunsetAt is optional, and only allowed when deprecating
 }
@@ -0,0 +1,9 @@
+package resources
+
+// Represents the request body for creating or updating a webhook subscription
+type WebhookRequestBody struct {
+	URL         string   `json:"url" binding:"required,max=2048"`      // URL is required, and must be an absolute http or https URL
+	Description string   `json:"description" binding:"max=1024"`       // Description is not required, and can be up to 1024 characters
+	Events      []string `json:"events" binding:"required,min=1,dive"` // Events is required, and lists the event types sent to the URL
+	Active      *bool    `json:"active"`                               // Active is not required, and defaults to true
+}
@@ -0,0 +1,268 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/harshadixit12/service-catalog-api/repository"
+)
+
+// Headers sent along with every delivery
+const (
+	EventHeader     = "X-Catalog-Event"
+	DeliveryHeader  = "X-Catalog-Delivery"
+	TimestampHeader = "X-Catalog-Timestamp"
+	SignatureHeader = "X-Catalog-Signature"
+)
+
+// Retry policy - the delay doubles after each failed attempt: 30s, 1m, 2m, 4m and 8m
+const (
+	maxAttempts    = 6
+	initialBackoff = 30 * time.Second
+	dueBatchSize   = 100
+)
+
+// Only the start of a receiver's response is kept in the attempt history
+const maxResponseBodyLength = 1024
+
+// How long a sender has to attempt a delivery it claimed, well over the client timeout.
+// Deliveries are claimed in the database instead of locking them in memory, so slow receivers only hold up their own
+// deliveries, and a delivery whose sender stopped is retried once its claim expires.
+const claimDuration = time.Minute
+
+// Set to true to allow deliveries to loopback, private and link-local addresses - for example, to a receiver
+// running next to the server in development. Off by default, as the responses of receivers are shown to admins,
+// who could otherwise read internal services through them.
+const allowPrivateDestinationsEnv = "WEBHOOK_ALLOW_PRIVATE_DESTINATIONS"
+
+// AllowPrivateDestinations reports whether deliveries may be sent to loopback, private and link-local addresses
+var AllowPrivateDestinations = os.Getenv(allowPrivateDestinationsEnv) == "true"
+
+// ErrPrivateDestination is the error of attempts to send a delivery to an address which is not allowed
+var ErrPrivateDestination = errors.New("webhook destination is a private address")
+
+// Addresses are checked when connecting, after the host is resolved, so a host name can't be pointed at an internal
+// address once the URL is accepted. This covers redirects too. Proxies are not used, as they would be checked instead.
+var client = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: checkDestination}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// Shared address space used by carrier-grade NAT, which is not covered by netip.Addr.IsPrivate
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Wakes the background worker up when new deliveries are created
+var wakeUp = make(chan struct{}, 1)
+
+// Event is the body of a delivery
+type Event struct {
+	ID        string          `json:"id"` // ID of the delivery, the same across retries and redeliveries
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Creates deliveries of an event for the subscriptions of the organization, and wakes the worker up to send them.
+// The catalog change already happened, so errors are only logged.
+func Publish(organizationID int, event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		fmt.Printf("Error encoding webhook payload: %v\n", err)
+		return
+	}
+
+	deliveries, err := repository.CreateWebhookDeliveries(organizationID, event, payload)
+	if err != nil {
+		fmt.Printf("Error creating webhook deliveries: %v\n", err)
+		return
+	}
+
+	if len(deliveries) > 0 {
+		select {
+		case wakeUp <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Starts the background worker, which sends due deliveries when woken up, and at every interval for retries
+func Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-wakeUp:
+			}
+			DeliverDue(time.Now().UTC())
+		}
+	}()
+}
+
+// Attempts every delivery due at the given time. Each delivery is claimed right before it is sent, and skipped if
+// another sender - like a redelivery - claimed it first.
+// The given time only decides which deliveries are due. Sending a batch can take minutes, so claims and retries count
+// from the time each delivery is sent.
+func DeliverDue(now time.Time) {
+	deliveries, err := repository.GetDueWebhookDeliveries(now, dueBatchSize)
+	if err != nil {
+		fmt.Printf("Error loading due webhook deliveries: %v\n", err)
+		return
+	}
+
+	for i := range deliveries {
+		claimed, err := repository.ClaimWebhookDelivery(&deliveries[i], now, time.Now().UTC().Add(claimDuration))
+		if err != nil {
+			fmt.Printf("Error claiming webhook delivery %s: %v\n", deliveries[i].ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		if err := attempt(&deliveries[i]); err != nil {
+			fmt.Printf("Error delivering webhook %s: %v\n", deliveries[i].ID, err)
+		}
+	}
+}
+
+// Gives a delivery of a webhook subscription of the organization a fresh set of attempts, and attempts it right away.
+// Failed redeliveries are retried like new deliveries.
+// Returns repository.ErrWebhookDeliveryInProgress if the delivery is being sent.
+func Redeliver(organizationID int, subscriptionID string, deliveryID string) (*repository.WebhookDeliveryDetails, error) {
+	now := time.Now().UTC()
+
+	delivery, err := repository.ResetWebhookDelivery(organizationID, subscriptionID, deliveryID, now, now.Add(claimDuration))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := attempt(delivery); err != nil {
+		return nil, err
+	}
+
+	return repository.GetWebhookDelivery(organizationID, subscriptionID, deliveryID)
+}
+
+// Returns the signature of a delivery body sent at the given Unix timestamp - the hex encoded HMAC-SHA256
+// of the timestamp and body joined by a ".", prefixed with "sha256=".
+// Signing the timestamp lets receivers reject old deliveries being replayed.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sends a claimed delivery to its subscription's URL, and records the attempt.
+// Failed attempts are retried with exponential backoff from the end of the attempt, until the delivery runs out of attempts.
+func attempt(delivery *repository.WebhookDelivery) error {
+	subscription, err := repository.GetWebhookSubscription(delivery.OrganizationID, delivery.SubscriptionID)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(Event{ID: delivery.ID, Event: delivery.Event, CreatedAt: delivery.CreatedAt, Data: delivery.Payload})
+	if err != nil {
+		return err
+	}
+
+	record := &repository.WebhookDeliveryAttempt{AttemptedAt: time.Now().UTC()}
+	record.StatusCode, record.ResponseBody, err = send(subscription, delivery, body, record.AttemptedAt)
+	record.DurationMs = time.Since(record.AttemptedAt).Milliseconds()
+	if err != nil {
+		record.Error = truncate(err.Error())
+	}
+
+	status := repository.WebhookDeliveryPending
+	switch {
+	case err == nil && record.StatusCode >= 200 && record.StatusCode < 300:
+		status = repository.WebhookDeliverySucceeded
+	case delivery.AttemptCount+1 >= maxAttempts:
+		status = repository.WebhookDeliveryFailed
+	}
+
+	nextAttemptAt := time.Now().UTC().Add(initialBackoff << delivery.AttemptCount)
+
+	return repository.RecordWebhookAttempt(delivery, record, status, nextAttemptAt)
+}
+
+// Posts a signed delivery body, and returns the status and start of the body of the response
+func send(subscription *repository.WebhookSubscription, delivery *repository.WebhookDelivery, body []byte, sentAt time.Time) (int, string, error) {
+	request, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+
+	timestamp := strconv.FormatInt(sentAt.Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, delivery.Event)
+	request.Header.Set(DeliveryHeader, delivery.ID)
+	request.Header.Set(TimestampHeader, timestamp)
+	request.Header.Set(SignatureHeader, Sign(subscription.Secret, timestamp, body))
+
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, "", err
+	}
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(io.LimitReader(response.Body, maxResponseBodyLength))
+	if err != nil {
+		return response.StatusCode, "", err
+	}
+
+	return response.StatusCode, string(responseBody), nil
+}
+
+// Rejects connections to loopback, private, link-local, multicast and unspecified addresses, unless they are allowed
+func checkDestination(network string, address string, _ syscall.RawConn) error {
+	if AllowPrivateDestinations {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateDestination, ip)
+	}
+
+	return nil
+}
+
+func truncate(message string) string {
+	if len(message) > maxResponseBodyLength {
+		return message[:maxResponseBodyLength]
+	}
+	return message
+}